@@ -1,25 +1,53 @@
-from fastapi import APIRouter, HTTPException, UploadFile, File, Form, Body
-from fastapi.responses import Response
-from pydantic import BaseModel
-from app.schemas.transcription import TranscriptionRequest
+from fastapi import APIRouter, HTTPException, UploadFile, File, Form, Body, Query, Depends, Request
+from fastapi.responses import Response, JSONResponse, StreamingResponse, PlainTextResponse
+from pydantic import BaseModel, Field, field_validator
+from app.schemas.transcription import normalize_language
+from app.schemas.caption import CaptionStyle
+from app.schemas.metadata import VideoMetadataResponse
 from app.tasks.transcription import transcribe_video_task
+from app.tasks.media import (
+    generate_thumbnail_task, transcode_video_task, package_hls_task, overlay_watermark_task, generate_gif_task,
+    change_speed_task, normalize_loudness_task, rotate_video_task, reframe_video_task, trim_silence_task, hls_prefix
+)
 from app.services.supabase_client import supabase
-from app.services.r2_client import get_r2_client
+from app.core.auth import CurrentUser, get_current_user, ensure_project_owner, require_service, DEV_USER_ID
+from app.services.r2_client import get_r2_client, PartialDeleteError
+from app.core.config import storage_settings, temp_storage_settings
+from app.core.temp_storage import ensure_free_space, InsufficientStorageError
+from app.core.metrics import UPLOAD_BYTES
+from app.core.etag import conditional_json
+from app.core.queue_stats import queue_stats, resize_worker_pools
+from app.core.celery_app import ACTIVE_JOB_STATUSES, cancel_running_task
+from app.core.statuses import (
+    ProjectStatus, JobStatus, PROJECT_TRANSITIONS, can_transition, project_status_sources, job_status_sources
+)
+from app.tasks.notifications import queue_job_webhooks
+from app.services.ffmpeg_service import (
+    get_video_info, list_audio_tracks, probe_metadata, SUPPORTED_VIDEO_CODECS, TRANSCODE_PRESETS,
+    WATERMARK_IMAGE_EXTENSIONS, WATERMARK_POSITIONS, GIF_MAX_DURATION, GIF_MAX_WIDTH, GIF_FPS_RANGE,
+    SPEED_FACTOR_MAX, SPEED_SMOOTH_RANGE, LOUDNESS_TARGET_RANGE, DEFAULT_LOUDNESS_TARGET,
+    detect_silence, NoAudioStreamError, SILENCE_NOISE_DB_RANGE, SILENCE_MIN_DURATION_RANGE, DEFAULT_SILENCE_NOISE_DB,
+    DEFAULT_SILENCE_MIN_DURATION, MAX_SILENCE_CUTS, detect_scenes, DEFAULT_SCENE_THRESHOLD, sniff_container, SNIFF_BYTES
+)
+from app.services.caption_service import segments_to_srt, segments_to_vtt
+from app.services.webhook_service import check_callback_url, UnsafeCallbackURL
 import logging
 import uuid
 import os
 import tempfile
+import shutil
 import asyncio
 import json
-from pathlib import Path
-from typing import Dict, List
+import hashlib
+from datetime import datetime, timedelta, timezone
+from typing import Dict, List, Literal, Optional
 
 # Configure logging
 logging.basicConfig(level=logging.INFO)
 logger = logging.getLogger(__name__)
 
 # Define upload directory
-UPLOAD_TEMP_DIR = Path(__file__).parent.parent / "temp_uploads"
+UPLOAD_TEMP_DIR = temp_storage_settings.upload_dir
 UPLOAD_TEMP_DIR.mkdir(parents=True, exist_ok=True)
 logger.info(f"Using upload temp directory: {UPLOAD_TEMP_DIR}")
 
@@ -27,6 +55,209 @@ router = APIRouter()
 
 class TranscriptionRequest(BaseModel):
     project_id: str
+    caption_style: Optional[CaptionStyle] = None
+    callback_url: Optional[str] = None
+    audio_track: int = Field(0, ge=0)
+    language: Optional[str] = None  # BCP-47 hint, e.g. "en" or "pt-BR"; auto-detected when omitted
+    word_timestamps: bool = True  # Per-word timings for karaoke-style captions
+    diarize: bool = False  # Label segments by speaker
+
+    @field_validator("language")
+    @classmethod
+    def validate_language(cls, value: Optional[str]) -> Optional[str]:
+        return normalize_language(value)
+
+class ThumbnailRequest(BaseModel):
+    at_time: float = 1.0
+    width: int = 640
+    callback_url: Optional[str] = None
+
+class HLSRequest(BaseModel):
+    segment_duration: int = Field(6, ge=2, le=30)
+    callback_url: Optional[str] = None
+
+class GIFRequest(BaseModel):
+    start: float = Field(0.0, ge=0)
+    duration: float = Field(3.0, gt=0, le=GIF_MAX_DURATION)
+    fps: int = Field(12, ge=GIF_FPS_RANGE[0], le=GIF_FPS_RANGE[1])
+    width: int = Field(480, gt=0, le=GIF_MAX_WIDTH)
+    callback_url: Optional[str] = None
+
+class SpeedRequest(BaseModel):
+    factor: float = Field(..., gt=0, le=SPEED_FACTOR_MAX)  # 2.0 plays twice as fast, 0.5 at half speed
+    callback_url: Optional[str] = None
+
+class RotateRequest(BaseModel):
+    degrees: Literal[90, 180, 270]  # Clockwise
+    callback_url: Optional[str] = None
+
+class ReframeRequest(BaseModel):
+    smart_crop: bool = True  # Follow the action scene by scene instead of cropping the center
+    callback_url: Optional[str] = None
+
+class TrimSilenceRequest(BaseModel):
+    noise_db: float = Field(DEFAULT_SILENCE_NOISE_DB, ge=SILENCE_NOISE_DB_RANGE[0], le=SILENCE_NOISE_DB_RANGE[1])
+    min_duration: float = Field(
+        DEFAULT_SILENCE_MIN_DURATION, ge=SILENCE_MIN_DURATION_RANGE[0], le=SILENCE_MIN_DURATION_RANGE[1]
+    )
+    callback_url: Optional[str] = None
+
+class LoudnessRequest(BaseModel):
+    target_lufs: float = Field(DEFAULT_LOUDNESS_TARGET, ge=LOUDNESS_TARGET_RANGE[0], le=LOUDNESS_TARGET_RANGE[1])
+    callback_url: Optional[str] = None
+
+class WorkerPoolRequest(BaseModel):
+    concurrency: int = Field(..., ge=1, le=64)
+    worker: Optional[str] = None  # Node name, e.g. celery@host; all workers when omitted
+
+class TranscodeRequest(BaseModel):
+    resolutions: List[int] = Field(default_factory=lambda: [1080, 720, 480])
+    video_codec: str = "libx264"
+    crf: int = Field(23, ge=0, le=51)
+    preset: str = "medium"
+    tone_map: Literal["auto", "off"] = "auto"  # "auto" converts HDR sources to SDR
+    callback_url: Optional[str] = None
+
+# Seconds clients are asked to wait before retrying when the task queue is unavailable
+QUEUE_RETRY_AFTER_SECONDS = 30
+
+def enqueue_job(task, job_id: str, *args):
+    """
+    Queue a Celery task for a processing job, using the job id as the task id so
+    the job can be cancelled later. If the broker rejects it, the job is marked
+    queue_failed and the caller gets 503 with Retry-After instead of a job id
+    that will never run.
+    """
+    try:
+        return task.apply_async(args=args, task_id=job_id)
+    except Exception as e:
+        logger.error(f"Failed to queue {task.name} for job {job_id}: {str(e)}", exc_info=True)
+        supabase.table("processing_jobs").update({
+            "status": JobStatus.QUEUE_FAILED,
+            "error_message": f"Failed to queue job: {str(e)}"
+        }).eq("id", job_id).in_("status", job_status_sources(JobStatus.QUEUE_FAILED)).execute()
+        raise HTTPException(
+            status_code=503,
+            detail="Job queue unavailable, please retry later",
+            headers={"Retry-After": str(QUEUE_RETRY_AFTER_SECONDS)}
+        )
+
+def find_active_job(project_id: str, job_type: str) -> Optional[str]:
+    """
+    Return the id of a queued or running job of this type for the project, if any.
+    This is best-effort: without a unique constraint in the database, two requests
+    racing between this check and the insert can still both create a job.
+    """
+    response = (
+        supabase.table("processing_jobs")
+        .select("id")
+        .eq("project_id", project_id)
+        .eq("job_type", job_type)
+        .in_("status", ACTIVE_JOB_STATUSES)
+        .limit(1)
+        .execute()
+    )
+    return response.data[0]["id"] if response.data else None
+
+def reject_if_job_active(project_id: str, job_type: str):
+    """Raise 409 pointing at the existing job rather than queuing duplicate work."""
+    active_job_id = find_active_job(project_id, job_type)
+    if active_job_id:
+        raise HTTPException(
+            status_code=409,
+            detail={"message": f"A {job_type} job is already in progress for this project", "job_id": active_job_id}
+        )
+
+def require_project_access(project_id: str, user: CurrentUser) -> dict:
+    """Load a project's ownership, raising 404 if it doesn't exist and 403 if the caller doesn't own it."""
+    response = supabase.table("projects").select("id, user_id").eq("id", project_id).execute()
+    
+    if not response.data or len(response.data) == 0:
+        raise HTTPException(status_code=404, detail="Project not found")
+    
+    ensure_project_owner(response.data[0], user)
+    return response.data[0]
+
+def validate_callback_url(callback_url: Optional[str]):
+    """Reject webhook callback URLs that aren't http(s) or resolve to internal addresses."""
+    if not callback_url:
+        return
+    try:
+        check_callback_url(callback_url)
+    except UnsafeCallbackURL as e:
+        raise HTTPException(status_code=400, detail=str(e))
+
+def require_uploaded_video(project_id: str, columns: str = "id, video_path") -> dict:
+    """Load a project's columns, raising 404 if it doesn't exist and 409 if its video hasn't finished uploading."""
+    project_response = supabase.table("projects").select(columns).eq("id", project_id).execute()
+    
+    if not project_response.data or len(project_response.data) == 0:
+        raise HTTPException(status_code=404, detail="Project not found")
+    
+    if not project_response.data[0].get("video_path"):
+        raise HTTPException(status_code=409, detail="Project video has not finished uploading")
+    
+    return project_response.data[0]
+
+def queue_media_job(project_id: str, job_type: str, task, params: tuple = (), callback_url: Optional[str] = None,
+                    output_details: Optional[dict] = None, project: Optional[dict] = None) -> str:
+    """
+    Create a processing job on a project's uploaded video and queue
+    task(project_id, job_id, *params) for it, returning the job id. Pass project
+    when the caller already loaded it with require_uploaded_video.
+    """
+    if project is None:
+        require_uploaded_video(project_id)
+    
+    reject_if_job_active(project_id, job_type)
+    
+    job_response = supabase.table("processing_jobs").insert({
+        "project_id": project_id,
+        "job_type": job_type,
+        "status": JobStatus.PENDING,
+        "callback_url": callback_url,
+        **({"output_details": output_details} if output_details else {})
+    }).execute()
+    
+    if not job_response.data:
+        raise HTTPException(status_code=500, detail="Failed to create processing job.")
+    
+    job_id = job_response.data[0]["id"]
+    enqueue_job(task, job_id, project_id, job_id, *params)
+    logger.info(f"Queued {job_type} task for project_id: {project_id}, job_id: {job_id}")
+    return job_id
+
+def job_output_url(project_id: str, job_id: str, job_type: str, key: str, extra: Optional[dict] = None) -> dict:
+    """
+    A signed URL for the file a completed job of job_type stored under
+    output_details[key], plus each extra response field mapped from its
+    output_details key. 404 if there's no such job, 409 until it has completed.
+    """
+    job_response = (
+        supabase.table("processing_jobs").select("status, output_details")
+        .eq("id", job_id).eq("project_id", project_id).eq("job_type", job_type)
+        .execute()
+    )
+    
+    if not job_response.data or len(job_response.data) == 0:
+        raise HTTPException(status_code=404, detail=f"{job_type} job not found")
+    
+    job = job_response.data[0]
+    output_details = job.get("output_details") or {}
+    output_path = output_details.get(key)
+    if job["status"] != JobStatus.COMPLETED or not output_path:
+        raise HTTPException(status_code=409, detail=f"Output is not ready, job is {job['status']}")
+    
+    client = get_r2_client()
+    if client is None:
+        raise HTTPException(status_code=503, detail="Failed to initialize R2 storage client")
+    
+    expires_at = datetime.now(timezone.utc) + timedelta(seconds=storage_settings.signed_url_ttl)
+    return {
+        "url": client.get_file_url(output_path),
+        "expiresAt": expires_at.isoformat(),
+        **{field: output_details.get(detail_key) for field, detail_key in (extra or {}).items()}
+    }
 
 class UploadInitRequest(BaseModel):
     fileName: str
@@ -50,42 +281,81 @@ class UploadCompleteRequest(BaseModel):
     uploadId: str
     projectId: str
     chunks: List[str]
+    expectedChecksum: Optional[str] = None
+    checksumAlgorithm: str = "sha256"
+
+def queue_transcription(project_id: str, caption_style: dict = None, audio_track: int = 0,
+                        callback_url: Optional[str] = None, language: Optional[str] = None,
+                        word_timestamps: bool = True) -> str:
+    """
+    Create a pending transcription job for a project and queue its task,
+    returning the job id. Raises 409 if a transcription is already active.
+    """
+    reject_if_job_active(project_id, "transcription")
+    
+    job_response = supabase.table("processing_jobs").insert({
+        "project_id": project_id,
+        "job_type": "transcription",
+        "status": JobStatus.PENDING,
+        "callback_url": callback_url
+    }).execute()
+    
+    if not job_response.data or len(job_response.data) == 0 or not job_response.data[0].get("id"):
+        raise HTTPException(status_code=500, detail="Failed to create processing job.")
+    
+    job_id = job_response.data[0]["id"]
+    
+    enqueue_job(transcribe_video_task, job_id, project_id, caption_style, audio_track, language, word_timestamps)
+    logger.info(f"Queued transcription task for project_id: {project_id}, job_id: {job_id}")
+    
+    return job_id
+
+def start_transcription_after_upload(project_id: str):
+    """Kick off transcription of a fresh upload; a queueing problem must not fail the upload itself."""
+    try:
+        queue_transcription(project_id)
+    except HTTPException as e:
+        logger.error(f"Failed to start transcription for project {project_id}: {e.detail}")
+    except Exception as e:
+        logger.error(f"Failed to start transcription task for project {project_id}: {e}", exc_info=True)
 
-@router.post("/transcribe")
-async def start_transcription(request: TranscriptionRequest):
+@router.post("/transcribe", status_code=202)
+async def start_transcription(request: TranscriptionRequest, user: CurrentUser = Depends(get_current_user)):
     """
     Starts a video transcription task for a given project_id.
-    This endpoint creates a job record and queues the background task.
+    This endpoint creates a job record, queues the background task and returns
+    202 with the job id straight away; poll /jobs/{job_id} for progress.
     """
     project_id = request.project_id
     logger.info(f"Received transcription request for project_id: {project_id}")
 
     try:
-        # 1. Check if the project exists
-        project_response = supabase.table("projects").select("id").eq("id", project_id).single().execute()
-        if not project_response.data:
-            raise HTTPException(status_code=404, detail=f"Project with id {project_id} not found.")
-
-        # 2. Create a new processing job in the database
-        job_response = supabase.table("processing_jobs").insert({
-            "project_id": project_id,
-            "job_type": "transcription",
-            "status": "pending"
-        }).execute()
-        
-        if not job_response.data or len(job_response.data) == 0:
-            raise HTTPException(status_code=500, detail="Failed to create processing job.")
-        
-        job_id = job_response.data[0].get("id")
-        if not job_id:
-            raise HTTPException(status_code=500, detail="Failed to create processing job.")
-
-        # 3. Queue the background task
-        transcribe_video_task.delay(project_id)
-        logger.info(f"Queued transcription task for project_id: {project_id}, job_id: {job_id}")
+        validate_callback_url(request.callback_url)
+        
+        # Whisper has no speaker diarization; segments keep any speaker labels an engine provides
+        if request.diarize:
+            raise HTTPException(status_code=400, detail="Speaker diarization is not supported by the configured transcription engine")
+        
+        # 1. Check if the project exists and belongs to the caller
+        require_project_access(project_id, user)
+        
+        # A project still uploading, or whose upload failed its checksum, has nothing to transcribe
+        project_response = supabase.table("projects").select("status").eq("id", project_id).execute()
+        project_status = project_response.data[0].get("status") if project_response.data else None
+        if project_status and not can_transition(PROJECT_TRANSITIONS, project_status, ProjectStatus.PROCESSING):
+            raise HTTPException(status_code=409, detail=f"Project cannot be transcribed while {project_status}")
+        
+        # 2. Create the processing job and queue the background task
+        caption_style = request.caption_style.model_dump() if request.caption_style else None
+        job_id = queue_transcription(
+            project_id, caption_style, request.audio_track, request.callback_url,
+            request.language, request.word_timestamps
+        )
 
         return {"message": "Transcription task started", "job_id": job_id}
 
+    except HTTPException:
+        raise
     except Exception as e:
         logger.error(f"Failed to start transcription for project {project_id}: {e}", exc_info=True)
         raise HTTPException(status_code=500, detail=f"Failed to start transcription task: {str(e)}")
@@ -96,6 +366,110 @@ CHUNK_SIZE = 5 * 1024 * 1024  # 5MB
 # In-memory storage for upload sessions
 upload_sessions: Dict[str, Dict] = {}
 
+# Digests accepted for verifying assembled uploads
+SUPPORTED_CHECKSUM_ALGORITHMS = ("sha256", "md5")
+
+# Per-upload manifest persisted alongside the chunk files
+MANIFEST_FILENAME = "manifest.json"
+
+def chunk_filename(chunk_index: int) -> str:
+    return f"chunk_{chunk_index:06d}"
+
+def scan_received_chunks(temp_dir: str) -> List[int]:
+    """Return the sorted chunk indices present in an upload temp directory."""
+    received = []
+    if not os.path.isdir(temp_dir):
+        return received
+    
+    for name in os.listdir(temp_dir):
+        if not name.startswith("chunk_"):
+            continue
+        try:
+            received.append(int(name[len("chunk_"):]))
+        except ValueError:
+            continue
+    return sorted(received)
+
+def chunk_matches(chunk_path: str, content: bytes) -> bool:
+    """Whether the chunk already on disk holds exactly content."""
+    if os.path.getsize(chunk_path) != len(content):
+        return False
+    with open(chunk_path, "rb") as f:
+        return f.read() == content
+
+class ChunkStreamReader:
+    """
+    File-like reader over upload chunks in order, so they can be streamed to
+    storage without first being combined into one file. Everything read is
+    fed to hasher and counted in bytes_read.
+    """
+    
+    def __init__(self, chunk_paths: List[str], hasher=None):
+        self.chunk_paths = list(chunk_paths)
+        self.hasher = hasher
+        self.bytes_read = 0
+        self._current = None
+    
+    def read(self, size: int = -1) -> bytes:
+        buffer = bytearray()
+        while size < 0 or len(buffer) < size:
+            if self._current is None:
+                if not self.chunk_paths:
+                    break
+                self._current = open(self.chunk_paths.pop(0), "rb")
+            
+            data = self._current.read(-1 if size < 0 else size - len(buffer))
+            if not data:
+                self._current.close()
+                self._current = None
+                continue
+            buffer.extend(data)
+        
+        data = bytes(buffer)
+        if self.hasher:
+            self.hasher.update(data)
+        self.bytes_read += len(data)
+        return data
+    
+    def close(self):
+        if self._current:
+            self._current.close()
+            self._current = None
+
+# Failures of /upload/complete after which the session is kept so the client can complete again
+RETRYABLE_COMPLETE_STATUSES = {408, 422}
+
+def discard_upload_session(session: "UploadSession"):
+    """Delete an upload session's chunks and manifest once the upload can no longer be completed again."""
+    try:
+        shutil.rmtree(session.temp_dir, ignore_errors=True)
+        upload_sessions.pop(session.upload_id, None)
+        logger.info(f"Cleaned up upload session {session.upload_id}")
+    except Exception as cleanup_error:
+        logger.error(f"Error cleaning up upload session: {str(cleanup_error)}")
+
+def get_upload_session(upload_id: str):
+    """
+    Look up an upload session, restoring it from its on-disk manifest
+    if the in-memory session was lost (e.g. after a server restart).
+    """
+    if upload_id in upload_sessions:
+        return upload_sessions[upload_id]
+    
+    temp_dir = UPLOAD_TEMP_DIR / f"upload_{upload_id}"
+    if not (temp_dir / MANIFEST_FILENAME).exists():
+        return None
+    
+    try:
+        session = UploadSession.from_manifest(str(temp_dir))
+    except Exception as e:
+        logger.error(f"Failed to restore upload session {upload_id} from manifest: {str(e)}")
+        return None
+    
+    upload_sessions[upload_id] = session
+    logger.info(f"Restored upload session {upload_id} from manifest ({len(session.uploaded_chunks)}/{session.total_chunks} chunks)")
+    return session
+
 class UploadSession:
     def __init__(self, upload_id: str, project_id: str, file_name: str, file_size: int, 
                  file_type: str, total_chunks: int, temp_dir: str):
@@ -111,10 +485,63 @@ class UploadSession:
         
     def add_chunk(self, chunk_index: int, file_path: str):
         self.uploaded_chunks[chunk_index] = file_path
+        self.write_manifest()
+        
+    @property
+    def manifest_path(self) -> str:
+        return os.path.join(self.temp_dir, MANIFEST_FILENAME)
+        
+    def write_manifest(self):
+        """Persist session state so an interrupted upload can be resumed."""
+        manifest = {
+            "uploadId": self.upload_id,
+            "projectId": self.project_id,
+            "fileName": self.file_name,
+            "fileSize": self.file_size,
+            "fileType": self.file_type,
+            "totalChunks": self.total_chunks,
+            "receivedChunks": sorted(self.uploaded_chunks.keys())
+        }
+        
+        # Write to a temp file and rename so readers never see a partial manifest
+        tmp_path = f"{self.manifest_path}.tmp"
+        with open(tmp_path, "w") as f:
+            json.dump(manifest, f)
+        os.replace(tmp_path, self.manifest_path)
+        
+    @classmethod
+    def from_manifest(cls, temp_dir: str) -> "UploadSession":
+        """Rebuild a session from the manifest and the chunk files on disk."""
+        with open(os.path.join(temp_dir, MANIFEST_FILENAME), "r") as f:
+            manifest = json.load(f)
+        
+        session = cls(
+            upload_id=manifest["uploadId"],
+            project_id=manifest["projectId"],
+            file_name=manifest["fileName"],
+            file_size=manifest["fileSize"],
+            file_type=manifest["fileType"],
+            total_chunks=manifest["totalChunks"],
+            temp_dir=temp_dir
+        )
+        for chunk_index in scan_received_chunks(temp_dir):
+            session.uploaded_chunks[chunk_index] = os.path.join(temp_dir, chunk_filename(chunk_index))
+        return session
         
     def is_complete(self) -> bool:
         return len(self.uploaded_chunks) == self.total_chunks
         
+    def remaining_bytes(self) -> int:
+        """Roughly how many bytes of chunks are still to arrive."""
+        if self.completed or self.total_chunks <= 0:
+            return 0
+        return int(self.file_size * (1 - len(self.uploaded_chunks) / self.total_chunks))
+        
+    def missing_chunks(self) -> List[int]:
+        """Chunk indices not yet present in the temp directory."""
+        received = set(scan_received_chunks(self.temp_dir))
+        return [i for i in range(self.total_chunks) if i not in received]
+        
     def get_chunk_paths(self) -> List[str]:
         """Get chunk file paths in order"""
         paths = []
@@ -125,6 +552,147 @@ class UploadSession:
                 raise ValueError(f"Missing chunk {i}")
         return paths
 
+def require_free_space(path, needed_bytes: int):
+    """
+    Raise 507 if writing needed_bytes under path would run the disk too low,
+    counting the chunks still expected for uploads already in progress.
+    """
+    # Forget sessions whose directory the janitor swept; their chunks will never arrive
+    for upload_id, session in list(upload_sessions.items()):
+        if not os.path.isdir(session.temp_dir):
+            upload_sessions.pop(upload_id, None)
+    
+    reserved = sum(session.remaining_bytes() for session in upload_sessions.values())
+    try:
+        ensure_free_space(str(path), needed_bytes, reserved)
+    except InsufficientStorageError as e:
+        logger.warning(str(e))
+        raise HTTPException(status_code=507, detail=e.user_message)
+
+# Video MIME types by file extension
+VIDEO_MIME_TYPES = {
+    '.mp4': 'video/mp4',
+    '.mov': 'video/quicktime',
+    '.avi': 'video/x-msvideo',
+    '.webm': 'video/webm',
+    '.mkv': 'video/x-matroska'
+}
+
+# Other types browsers report for the same extensions
+VIDEO_MIME_ALIASES = {
+    '.avi': {'video/avi', 'video/msvideo'},
+    '.mkv': {'video/mkv'},
+}
+
+def load_allowed_video_extensions() -> set:
+    """Upload formats to accept, from ALLOWED_VIDEO_FORMATS (e.g. "mp4,webm"); all known ones by default."""
+    configured = os.environ.get("ALLOWED_VIDEO_FORMATS")
+    if not configured:
+        return set(VIDEO_MIME_TYPES)
+    
+    extensions = {f".{name.strip().lower().lstrip('.')}" for name in configured.split(",") if name.strip()}
+    unknown = extensions - set(VIDEO_MIME_TYPES)
+    if unknown:
+        logger.warning(f"Ignoring unsupported ALLOWED_VIDEO_FORMATS entries: {', '.join(sorted(unknown))}")
+    return extensions & set(VIDEO_MIME_TYPES)
+
+ALLOWED_VIDEO_EXTENSIONS = load_allowed_video_extensions()
+
+def validate_upload_format(file_name: str, claimed_type: Optional[str]) -> str:
+    """
+    Check an upload's file name and claimed content type before accepting it,
+    returning the lowercased extension. Formats outside the allowlist get 415;
+    a claimed video type that contradicts the extension gets 400. Generic or
+    missing types are accepted, since the stored type comes from probing anyway.
+    """
+    file_extension = os.path.splitext(file_name or "")[1].lower()
+    if file_extension not in ALLOWED_VIDEO_EXTENSIONS:
+        raise HTTPException(
+            status_code=415,
+            detail=f"Unsupported file type. Allowed: {', '.join(sorted(ALLOWED_VIDEO_EXTENSIONS))}"
+        )
+    
+    claimed_type = (claimed_type or "").split(";")[0].strip().lower()
+    if claimed_type and claimed_type != "application/octet-stream":
+        expected_types = {VIDEO_MIME_TYPES[file_extension]} | VIDEO_MIME_ALIASES.get(file_extension, set())
+        if claimed_type not in expected_types:
+            raise HTTPException(
+                status_code=400,
+                detail=f"Content type {claimed_type} does not match a {file_extension} file"
+            )
+    
+    return file_extension
+
+# MIME types for each ffprobe format_name; the first is used unless the extension picks another
+FORMAT_MIME_TYPES = {
+    'mov,mp4,m4a,3gp,3g2,mj2': ('video/mp4', 'video/quicktime'),
+    'matroska,webm': ('video/webm', 'video/x-matroska'),
+    'avi': ('video/x-msvideo',),
+}
+
+# Extensions of the files each container may be uploaded as, keyed like FORMAT_MIME_TYPES
+CONTAINER_EXTENSIONS = {
+    'mov,mp4,m4a,3gp,3g2,mj2': {'.mp4', '.mov'},
+    'matroska,webm': {'.webm', '.mkv'},
+    'avi': {'.avi'},
+}
+
+def detect_video_container(file_path: str, file_extension: str) -> str:
+    """The container of the upload at file_path, see sniff_upload_container."""
+    with open(file_path, 'rb') as f:
+        return sniff_upload_container(f.read(SNIFF_BYTES), file_extension)
+
+def sniff_upload_container(header: bytes, file_extension: str) -> str:
+    """
+    The container an upload really is, sniffed from its first bytes rather than
+    trusting its name or claimed type. Raises 415 unless it is a video container
+    on the allowlist. A container that disagrees with the extension is accepted,
+    since the stored type follows the real format.
+    """
+    container = sniff_container(header)
+    
+    if container is None or not CONTAINER_EXTENSIONS[container] & ALLOWED_VIDEO_EXTENSIONS:
+        raise HTTPException(
+            status_code=415,
+            detail=f"File is not a supported video. Allowed: {', '.join(sorted(ALLOWED_VIDEO_EXTENSIONS))}"
+        )
+    if file_extension not in CONTAINER_EXTENSIONS[container]:
+        logger.warning(f"Upload named {file_extension} is really {container}")
+    return container
+
+def require_video_stream(video_info: dict):
+    """Raise 415 if probing succeeded but found no video stream. An empty result means probing itself failed."""
+    if video_info and not video_info.get("width"):
+        raise HTTPException(status_code=415, detail="File has no video stream")
+
+def mark_upload_invalid(project_id: str):
+    """Record that a project's upload turned out not to be a usable video."""
+    supabase.table("projects").update({
+        "status": ProjectStatus.UPLOAD_INVALID
+    }).eq("id", project_id).in_("status", project_status_sources(ProjectStatus.UPLOAD_INVALID)).execute()
+
+def video_content_type(file_name: str, video_format: Optional[str] = None) -> str:
+    """
+    Content type to store a video under. The probed container format wins over
+    the file extension so a mislabelled file still plays in the browser.
+    """
+    extension_type = VIDEO_MIME_TYPES.get(os.path.splitext(file_name or "")[1].lower())
+    format_types = FORMAT_MIME_TYPES.get(video_format or "")
+    
+    if format_types:
+        return extension_type if extension_type in format_types else format_types[0]
+    return extension_type or 'application/octet-stream'
+
+def probe_uploaded_video(file_path: str) -> dict:
+    """Probe a local upload for width/height/duration/format, returning {} if ffprobe fails."""
+    try:
+        video_info = get_video_info(file_path)
+        logger.info(f"Probed uploaded video {file_path}: {video_info}")
+        return video_info
+    except Exception as e:
+        logger.warning(f"Could not probe uploaded video {file_path}: {str(e)}")
+        return {}
+
 async def upload_to_r2_with_timeout(file_path: str, storage_filename: str, content_type: str, timeout: int = 300):
     """Upload file to Cloudflare R2 with timeout handling."""
     def sync_upload():
@@ -146,137 +714,155 @@ async def upload_to_r2_with_timeout(file_path: str, storage_filename: str, conte
             detail=f"Upload timed out after {timeout} seconds"
         )
 
+async def stream_to_r2_with_timeout(file_obj, storage_filename: str, content_type: str, timeout: int = 300):
+    """Stream a file-like object to Cloudflare R2 with timeout handling."""
+    def sync_upload():
+        client = get_r2_client()
+        if client is None:
+            raise Exception("Failed to initialize R2 client. Check R2 credentials.")
+        return client.upload_fileobj(file_obj, storage_filename, content_type)
+    
+    try:
+        loop = asyncio.get_event_loop()
+        return await asyncio.wait_for(
+            loop.run_in_executor(None, sync_upload),
+            timeout=timeout
+        )
+    except asyncio.TimeoutError:
+        raise HTTPException(
+            status_code=408,
+            detail=f"Upload timed out after {timeout} seconds"
+        )
+
+def probe_stored_video(storage_filename: str) -> dict:
+    """Probe a video already in R2 through a short-lived signed URL, returning {} on failure."""
+    try:
+        signed_url = get_r2_client().get_file_url(storage_filename, expires_in=300)
+        return get_video_info(signed_url)
+    except Exception as e:
+        logger.warning(f"Could not probe stored video {storage_filename}: {str(e)}")
+        return {}
+
 @router.post("/upload")
 async def upload_video(
     file: UploadFile = File(...),
-    project_name: str = Form(...)
+    project_name: str = Form(...),
+    file_size: Optional[int] = Form(None),
+    user: CurrentUser = Depends(get_current_user)
 ):
     """
     Upload a video file and create a new project.
-    Uses chunked uploads for better reliability with large files.
+    The stored size is what was actually received; when the client also sends
+    file_size, the upload is rejected unless the two match. The 2GB size limit
+    is enforced by BodyLimitMiddleware while the body is received, before the
+    multipart parser has spooled it to disk. The spooled file is sniffed and
+    streamed to R2 as it is, then probed in storage, so it's never copied again.
     """
     try:
-        # Validate file type
-        allowed_extensions = {'.mp4', '.mov', '.avi', '.webm', '.mkv'}
-        file_extension = os.path.splitext(file.filename)[1].lower()
-        
-        if file_extension not in allowed_extensions:
-            raise HTTPException(
-                status_code=400, 
-                detail=f"Unsupported file type. Allowed: {', '.join(allowed_extensions)}"
-            )
+        file_extension = validate_upload_format(file.filename, file.content_type)
         
         # Generate unique filename
         file_id = str(uuid.uuid4())
         storage_filename = f"{file_id}{file_extension}"
         
-        # Map file extensions to MIME types
-        mime_map = {
-            '.mp4': 'video/mp4',
-            '.mov': 'video/quicktime',
-            '.avi': 'video/x-msvideo',
-            '.webm': 'video/webm',
-            '.mkv': 'video/x-matroska'
-        }
+        # Count what actually arrived
+        file.file.seek(0, os.SEEK_END)
+        total_size = file.file.tell()
         
-        # Get MIME type from file extension
-        content_type = mime_map.get(file_extension.lower(), 'application/octet-stream')
+        if total_size == 0:
+            raise HTTPException(status_code=400, detail="Uploaded file is empty")
+        if file_size is not None and total_size != file_size:
+            raise HTTPException(
+                status_code=400,
+                detail=f"File size mismatch: expected {file_size}, got {total_size}"
+            )
+        UPLOAD_BYTES.labels("direct").inc(total_size)
         
-        # Create a temporary file for chunked upload
-        with tempfile.NamedTemporaryFile(delete=False) as temp_file:
-            try:
-                # Read and write the file in chunks
-                total_size = 0
-                chunk_number = 0
-                
-                while True:
-                    chunk = await file.read(CHUNK_SIZE)
-                    if not chunk:
-                        break
-                    temp_file.write(chunk)
-                    chunk_number += 1
-                    total_size += len(chunk)
-                    logger.debug(f"Read chunk {chunk_number}: {len(chunk)} bytes (total: {total_size} bytes)")
-                
-                temp_file_path = temp_file.name
-                logger.info(f"Successfully saved {total_size} bytes to temporary file: {temp_file_path}")
-                
-                # Upload to Supabase Storage with retry logic
-                max_retries = 3
-                last_error = None
-                
-                for attempt in range(max_retries):
-                    try:
-                        logger.info(f"Starting upload attempt {attempt + 1} of {max_retries}")
-                        
-                        # Upload to R2 with timeout
-                        logger.info(f"Starting R2 upload for file: {storage_filename} ({total_size} bytes)")
-                        storage_response = await upload_to_r2_with_timeout(
-                            temp_file_path, 
-                            storage_filename, 
-                            content_type,
-                            timeout=600  # 10 minutes for R2
-                        )
-                        logger.info(f"R2 upload response: {storage_response}")
-                            
-                        # If we get here, upload was successful
-                        logger.info(f"Successfully uploaded file to storage: {storage_filename}")
-                        break
-                            
-                    except Exception as upload_error:
-                        last_error = upload_error
-                        logger.error(f"Upload attempt {attempt + 1} failed: {str(upload_error)}")
-                        if attempt < max_retries - 1:  # Don't sleep on the last attempt
-                            await asyncio.sleep(2 ** attempt)  # Exponential backoff
-                else:
-                    # This runs if the loop completes without breaking (all retries failed)
-                    raise HTTPException(
-                        status_code=500,
-                        detail=f"Failed to upload file after {max_retries} attempts: {str(last_error)}"
-                    )
-                
-                # Create project record in database
-                project_data = {
-                    "id": file_id,
-                    "name": project_name,
-                    "original_filename": file.filename,
-                    "video_path": storage_filename,
-                    "file_size": total_size,
-                    "status": "uploaded"
-                }
-                
-                db_response = supabase.table("projects").insert(project_data).execute()
-                
-                if not db_response.data:
-                    raise HTTPException(
-                        status_code=500,
-                        detail="Failed to create project record in database"
-                    )
-                
-                # Automatically start transcription task
+        # Check what the file really is before it reaches storage or ffmpeg jobs
+        file.file.seek(0)
+        container = sniff_upload_container(file.file.read(SNIFF_BYTES), file_extension)
+        content_type = video_content_type(file.filename, container)
+        
+        try:
+            # Upload to R2 with retry logic, rewinding the spooled file for each attempt
+            max_retries = 3
+            last_error = None
+            
+            for attempt in range(max_retries):
                 try:
-                    task = transcribe_video_task.delay(file_id)
-                    logger.info(f"Started transcription task {task.id} for project {file_id}")
-                except Exception as e:
-                    logger.error(f"Failed to start transcription task for project {file_id}: {e}", exc_info=True)
-                
-                return {"id": file_id, "status": "uploaded", "filename": storage_filename}
-                
-            except Exception as e:
-                logger.error(f"Error during file upload: {str(e)}", exc_info=True)
+                    logger.info(f"Starting R2 upload attempt {attempt + 1} of {max_retries}: {storage_filename} ({total_size} bytes)")
+                    file.file.seek(0)
+                    storage_response = await stream_to_r2_with_timeout(
+                        file.file,
+                        storage_filename,
+                        content_type,
+                        timeout=600  # 10 minutes for R2
+                    )
+                    logger.info(f"R2 upload response: {storage_response}")
+                    break
+                        
+                except Exception as upload_error:
+                    last_error = upload_error
+                    logger.error(f"Upload attempt {attempt + 1} failed: {str(upload_error)}")
+                    if attempt < max_retries - 1:  # Don't sleep on the last attempt
+                        await asyncio.sleep(2 ** attempt)  # Exponential backoff
+            else:
+                # This runs if the loop completes without breaking (all retries failed)
                 raise HTTPException(
                     status_code=500,
-                    detail=f"Failed to process file upload: {str(e)}"
+                    detail=f"Failed to upload file after {max_retries} attempts: {str(last_error)}"
                 )
-            finally:
-                # Clean up the temporary file
-                try:
-                    if os.path.exists(temp_file_path):
-                        os.unlink(temp_file_path)
-                        logger.info(f"Cleaned up temporary file: {temp_file_path}")
-                except Exception as cleanup_error:
-                    logger.error(f"Error cleaning up temporary file: {str(cleanup_error)}")
-                    
+            
+            # ffprobe needs a path or URL and the spooled file may have neither, so probe the stored copy
+            loop = asyncio.get_event_loop()
+            video_info = await loop.run_in_executor(None, probe_stored_video, storage_filename)
+            
+            try:
+                require_video_stream(video_info)
+            except HTTPException:
+                get_r2_client().delete_file(storage_filename)
+                raise
+            video_info["format"] = video_info.get("format") or container
+            
+            # The sniffed container only gave us a guess; correct the stored content type from the probed one
+            probed_content_type = video_content_type(file.filename, video_info.get("format"))
+            if probed_content_type != content_type:
+                await loop.run_in_executor(None, get_r2_client().set_content_type, storage_filename, probed_content_type)
+            
+            # Create project record in database
+            project_data = {
+                "id": file_id,
+                "user_id": user.id or DEV_USER_ID,
+                "name": project_name,
+                "original_filename": file.filename,
+                "video_path": storage_filename,
+                "file_size": total_size,
+                "status": ProjectStatus.UPLOADED,
+                **video_info
+            }
+            
+            db_response = supabase.table("projects").insert(project_data).execute()
+            
+            if not db_response.data:
+                raise HTTPException(
+                    status_code=500,
+                    detail="Failed to create project record in database"
+                )
+            
+            # Automatically start transcription task
+            start_transcription_after_upload(file_id)
+            
+            return {"id": file_id, "status": "uploaded", "filename": storage_filename}
+            
+        except HTTPException:
+            raise
+        except Exception as e:
+            logger.error(f"Error during file upload: {str(e)}", exc_info=True)
+            raise HTTPException(
+                status_code=500,
+                detail=f"Failed to process file upload: {str(e)}"
+            )
+                
     except HTTPException:
         raise
     except Exception as e:
@@ -287,21 +873,14 @@ async def upload_video(
         )
 
 @router.post("/upload/init")
-async def init_chunked_upload(request: UploadInitRequest):
+async def init_chunked_upload(request: UploadInitRequest, user: CurrentUser = Depends(get_current_user)):
     """
     Initialize a chunked upload session.
     Creates a project record and sets up temporary storage for chunks.
     """
     try:
-        # Validate file type
-        allowed_extensions = {'.mp4', '.mov', '.avi', '.webm', '.mkv'}
-        file_extension = os.path.splitext(request.fileName)[1].lower()
-        
-        if file_extension not in allowed_extensions:
-            raise HTTPException(
-                status_code=400, 
-                detail=f"Unsupported file type. Allowed: {', '.join(allowed_extensions)}"
-            )
+        file_extension = validate_upload_format(request.fileName, request.fileType)
+        require_free_space(UPLOAD_TEMP_DIR, request.fileSize)
         
         # Generate unique project ID
         project_id = str(uuid.uuid4())
@@ -324,16 +903,17 @@ async def init_chunked_upload(request: UploadInitRequest):
         
         # Store session
         upload_sessions[request.uploadId] = session
+        session.write_manifest()
         
         # Create project record in database
         project_data = {
             "id": project_id,
-            "user_id": "00000000-0000-0000-0000-000000000001",  # Default user ID
+            "user_id": user.id or DEV_USER_ID,
             "name": request.projectName,
             "original_filename": request.fileName,
             "video_path": "",  # Will be set when upload completes
             "file_size": request.fileSize,
-            "status": "uploading"
+            "status": ProjectStatus.UPLOADING
         }
         
         db_response = supabase.table("projects").insert(project_data).execute()
@@ -368,7 +948,8 @@ async def init_chunked_upload(request: UploadInitRequest):
 @router.post("/upload/chunk")
 async def upload_chunk(
     chunk: UploadFile = File(...),
-    metadata: str = Form(...)
+    metadata: str = Form(...),
+    user: CurrentUser = Depends(get_current_user)
 ):
     """
     Upload a single chunk of a file.
@@ -378,28 +959,41 @@ async def upload_chunk(
         chunk_metadata = ChunkMetadata.model_validate_json(metadata)
         
         # Get upload session
-        if chunk_metadata.uploadId not in upload_sessions:
+        session = get_upload_session(chunk_metadata.uploadId)
+        if session is None:
             raise HTTPException(
                 status_code=404,
                 detail="Upload session not found"
             )
         
-        session = upload_sessions[chunk_metadata.uploadId]
+        require_project_access(session.project_id, user)
+        
+        # The chunk count is fixed by the first request; reject inconsistent metadata
+        if chunk_metadata.totalChunks != session.total_chunks:
+            raise HTTPException(
+                status_code=400,
+                detail=f"totalChunks mismatch: session expects {session.total_chunks}, got {chunk_metadata.totalChunks}"
+            )
         
         # Validate chunk index
-        if chunk_metadata.chunkIndex >= session.total_chunks:
+        if chunk_metadata.chunkIndex < 0 or chunk_metadata.chunkIndex >= session.total_chunks:
             raise HTTPException(
                 status_code=400,
                 detail=f"Invalid chunk index {chunk_metadata.chunkIndex}"
             )
         
         # Save chunk to temporary file
-        chunk_filename = f"chunk_{chunk_metadata.chunkIndex:06d}"
-        chunk_path = os.path.join(session.temp_dir, chunk_filename)
+        chunk_path = os.path.join(session.temp_dir, chunk_filename(chunk_metadata.chunkIndex))
+        chunk_content = await chunk.read()
         
-        with open(chunk_path, "wb") as f:
-            chunk_content = await chunk.read()
-            f.write(chunk_content)
+        # Skip re-writing a resent chunk that already arrived intact; a chunk resent
+        # after a checksum mismatch differs in content, if not in size, and replaces it
+        if os.path.exists(chunk_path) and chunk_matches(chunk_path, chunk_content):
+            logger.info(f"Chunk {chunk_metadata.chunkIndex} already received for upload {chunk_metadata.uploadId}, skipping write")
+        else:
+            with open(chunk_path, "wb") as f:
+                f.write(chunk_content)
+            UPLOAD_BYTES.labels("chunked").inc(len(chunk_content))
         
         # Add chunk to session
         session.add_chunk(chunk_metadata.chunkIndex, chunk_path)
@@ -424,115 +1018,157 @@ async def upload_chunk(
         )
 
 @router.post("/upload/complete")
-async def complete_chunked_upload(request: UploadCompleteRequest):
+async def complete_chunked_upload(request: UploadCompleteRequest, user: CurrentUser = Depends(get_current_user)):
     """
     Complete a chunked upload by assembling chunks and uploading to Supabase.
     """
     try:
         # Get upload session
-        if request.uploadId not in upload_sessions:
+        session = get_upload_session(request.uploadId)
+        if session is None:
             raise HTTPException(
                 status_code=404,
                 detail="Upload session not found"
             )
         
-        session = upload_sessions[request.uploadId]
+        require_project_access(session.project_id, user)
+        
+        # Check if all chunks are on disk so the client can resend only the gaps
+        missing_chunks = session.missing_chunks()
+        if missing_chunks:
+            raise HTTPException(
+                status_code=409,
+                detail={
+                    "message": f"Missing chunks. Have {session.total_chunks - len(missing_chunks)}/{session.total_chunks}",
+                    "missingChunks": missing_chunks
+                }
+            )
         
-        # Check if all chunks are uploaded
-        if not session.is_complete():
+        checksum_algorithm = request.checksumAlgorithm.lower()
+        if checksum_algorithm not in SUPPORTED_CHECKSUM_ALGORITHMS:
             raise HTTPException(
                 status_code=400,
-                detail=f"Missing chunks. Have {len(session.uploaded_chunks)}/{session.total_chunks}"
+                detail=f"Unsupported checksum algorithm. Allowed: {', '.join(SUPPORTED_CHECKSUM_ALGORITHMS)}"
             )
         
-        # Assemble chunks into final file
-        final_file_path = os.path.join(session.temp_dir, "assembled_file")
+        # Verify sizes from stat before reading anything
+        chunk_paths = session.get_chunk_paths()
+        total_size = sum(os.path.getsize(path) for path in chunk_paths)
+        if total_size != session.file_size:
+            raise HTTPException(
+                status_code=400,
+                detail=f"File size mismatch: expected {session.file_size}, got {total_size}"
+            )
         
         try:
-            with open(final_file_path, "wb") as final_file:
-                chunk_paths = session.get_chunk_paths()
-                total_written = 0
-                
-                for i, chunk_path in enumerate(chunk_paths):
-                    with open(chunk_path, "rb") as chunk_file:
-                        chunk_data = chunk_file.read()
-                        final_file.write(chunk_data)
-                        total_written += len(chunk_data)
-                        logger.debug(f"Assembled chunk {i}: {len(chunk_data)} bytes")
-            
-            logger.info(f"Assembled {len(chunk_paths)} chunks into {total_written} bytes for upload {request.uploadId}")
-            
-            # Verify file size
-            if total_written != session.file_size:
-                raise Exception(f"File size mismatch: expected {session.file_size}, got {total_written}")
-            
             # Generate storage filename
             file_extension = os.path.splitext(session.file_name)[1].lower()
             storage_filename = f"{session.project_id}{file_extension}"
             
-            # Map file extensions to MIME types
-            mime_map = {
-                '.mp4': 'video/mp4',
-                '.mov': 'video/quicktime',
-                '.avi': 'video/x-msvideo',
-                '.webm': 'video/webm',
-                '.mkv': 'video/x-matroska'
-            }
-            content_type = mime_map.get(file_extension.lower(), 'application/octet-stream')
+            # Check what the file really is before uploading it; the first chunk holds its header
+            try:
+                container = detect_video_container(chunk_paths[0], file_extension)
+            except HTTPException:
+                mark_upload_invalid(session.project_id)
+                raise
             
-            # Upload to Cloudflare R2 with extended timeout for large files
-            logger.info(f"Starting R2 upload for assembled file: {storage_filename} ({total_written} bytes)")
+            content_type = video_content_type(session.file_name, container)
+            
+            # Stream the chunks straight to R2 in order, hashing as they're read,
+            # instead of combining them into one file and reading that back
+            logger.info(f"Starting R2 upload of {len(chunk_paths)} chunks: {storage_filename} ({total_size} bytes)")
             
             # R2 is much more reliable, use generous timeout for large files
-            timeout_minutes = max(10, total_written // (1024 * 1024 * 2))  # 2MB per minute (very conservative)
+            timeout_minutes = max(10, total_size // (1024 * 1024 * 2))  # 2MB per minute (very conservative)
             timeout_seconds = min(timeout_minutes * 60, 1800)  # Cap at 30 minutes
             
-            logger.info(f"Using {timeout_seconds // 60} minute timeout for {total_written // (1024 * 1024)}MB file")
+            logger.info(f"Using {timeout_seconds // 60} minute timeout for {total_size // (1024 * 1024)}MB file")
+            
+            hasher = hashlib.new(checksum_algorithm)
+            reader = ChunkStreamReader(chunk_paths, hasher)
             
             try:
-                storage_response = await upload_to_r2_with_timeout(
-                    final_file_path,
+                storage_response = await stream_to_r2_with_timeout(
+                    reader,
                     storage_filename,
                     content_type,
                     timeout=timeout_seconds
                 )
                 logger.info(f"R2 upload completed successfully: {storage_response}")
                 
-            except asyncio.TimeoutError:
-                logger.error(f"Upload timed out after {timeout_seconds} seconds")
-                raise HTTPException(
-                    status_code=408,
-                    detail=f"File upload timed out. This is unusual for R2 - please check your connection."
-                )
+            except HTTPException:
+                raise
             except Exception as upload_error:
                 logger.error(f"R2 upload failed: {str(upload_error)}")
                 raise HTTPException(
                     status_code=500,
                     detail=f"Failed to upload file to R2 storage: {str(upload_error)}"
                 )
+            finally:
+                reader.close()
+            
+            if reader.bytes_read != total_size:
+                get_r2_client().delete_file(storage_filename)
+                raise Exception(f"Chunks changed during upload: expected {total_size} bytes, read {reader.bytes_read}")
+            
+            # Verify integrity against the client-supplied checksum
+            checksum = hasher.hexdigest()
+            if request.expectedChecksum and request.expectedChecksum.strip().lower() != checksum:
+                logger.error(f"Checksum mismatch for upload {request.uploadId}: expected {request.expectedChecksum}, got {checksum}")
+                get_r2_client().delete_file(storage_filename)
+                supabase.table("projects").update({
+                    "status": ProjectStatus.UPLOAD_CORRUPT
+                }).eq("id", session.project_id).in_("status", project_status_sources(ProjectStatus.UPLOAD_CORRUPT)).execute()
+                raise HTTPException(
+                    status_code=422,
+                    detail=f"Checksum mismatch: expected {request.expectedChecksum}, got {checksum} ({checksum_algorithm})"
+                )
+            
+            loop = asyncio.get_event_loop()
+            video_info = await loop.run_in_executor(None, probe_stored_video, storage_filename)
+            
+            try:
+                require_video_stream(video_info)
+            except HTTPException:
+                get_r2_client().delete_file(storage_filename)
+                mark_upload_invalid(session.project_id)
+                raise
+            video_info["format"] = video_info.get("format") or container
+            
+            # The extension only gave us a guess; correct the stored content type from the probed container
+            probed_content_type = video_content_type(session.file_name, video_info.get("format"))
+            if probed_content_type != content_type:
+                await loop.run_in_executor(None, get_r2_client().set_content_type, storage_filename, probed_content_type)
             
             # Update project record with video path
             update_data = {
                 "video_path": storage_filename,
-                "status": "uploaded"
+                "status": ProjectStatus.UPLOADED,
+                "checksum": checksum,
+                # A corrupt upload may have been completed again with new chunks
+                "metadata": None,
+                "scenes": None,
+                **video_info
             }
             
-            db_response = supabase.table("projects").update(update_data).eq("id", session.project_id).execute()
+            db_response = (
+                supabase.table("projects").update(update_data)
+                .eq("id", session.project_id)
+                .in_("status", project_status_sources(ProjectStatus.UPLOADED))
+                .execute()
+            )
             
             if not db_response.data:
                 raise Exception("Failed to update project record")
             
             # Mark session as completed
             session.completed = True
+            discard_upload_session(session)
             
             logger.info(f"Completed chunked upload for project {session.project_id}: {storage_filename}")
             
             # Automatically start transcription task
-            try:
-                task = transcribe_video_task.delay(session.project_id)
-                logger.info(f"Started transcription task {task.id} for project {session.project_id}")
-            except Exception as e:
-                logger.error(f"Failed to start transcription task for project {session.project_id}: {e}", exc_info=True)
+            start_transcription_after_upload(session.project_id)
             
             return {
                 "projectId": session.project_id,
@@ -541,15 +1177,12 @@ async def complete_chunked_upload(request: UploadCompleteRequest):
                 "message": "Upload completed successfully - transcription started"
             }
             
-        finally:
-            # Clean up temporary files
-            try:
-                import shutil
-                shutil.rmtree(session.temp_dir, ignore_errors=True)
-                del upload_sessions[request.uploadId]
-                logger.info(f"Cleaned up upload session {request.uploadId}")
-            except Exception as cleanup_error:
-                logger.error(f"Error cleaning up upload session: {str(cleanup_error)}")
+        except HTTPException as e:
+            # Keep the chunks when the client can still finish this upload: after a checksum
+            # mismatch it resends the bad chunks, after a timeout or storage error it retries
+            if e.status_code not in RETRYABLE_COMPLETE_STATUSES and e.status_code < 500:
+                discard_upload_session(session)
+            raise
         
     except HTTPException:
         raise
@@ -561,17 +1194,18 @@ async def complete_chunked_upload(request: UploadCompleteRequest):
         )
 
 @router.get("/upload/{upload_id}/status")
-async def get_upload_status(upload_id: str):
+async def get_upload_status(upload_id: str, user: CurrentUser = Depends(get_current_user)):
     """
     Get the status of a chunked upload session.
     """
-    if upload_id not in upload_sessions:
+    session = get_upload_session(upload_id)
+    if session is None:
         raise HTTPException(
             status_code=404,
             detail="Upload session not found"
         )
     
-    session = upload_sessions[upload_id]
+    require_project_access(session.project_id, user)
     
     return {
         "uploadId": upload_id,
@@ -580,24 +1214,26 @@ async def get_upload_status(upload_id: str):
         "fileSize": session.file_size,
         "totalChunks": session.total_chunks,
         "uploadedChunks": len(session.uploaded_chunks),
+        "receivedChunks": scan_received_chunks(session.temp_dir),
         "completed": session.completed,
         "isComplete": session.is_complete(),
         "progress": (len(session.uploaded_chunks) / session.total_chunks) * 100
     }
 
 @router.delete("/upload/{upload_id}")
-async def cancel_chunked_upload(upload_id: str):
+async def cancel_chunked_upload(upload_id: str, user: CurrentUser = Depends(get_current_user)):
     """
     Cancel a chunked upload and clean up resources.
     """
     try:
-        if upload_id not in upload_sessions:
+        session = get_upload_session(upload_id)
+        if session is None:
             raise HTTPException(
                 status_code=404,
                 detail="Upload session not found"
             )
         
-        session = upload_sessions[upload_id]
+        require_project_access(session.project_id, user)
         
         # Clean up temporary files
         try:
@@ -629,20 +1265,89 @@ async def cancel_chunked_upload(upload_id: str):
             detail=f"Failed to cancel upload: {str(e)}"
         )
 
+# Columns list_projects may sort by
+PROJECT_SORT_FIELDS = {"created_at", "name"}
+
 @router.get("/projects")
-async def list_projects():
-    """List all projects."""
+async def list_projects(
+    request: Request,
+    limit: int = Query(20, ge=1, le=100),
+    offset: int = Query(0, ge=0),
+    sort: str = "created_at",
+    order: str = "desc",
+    user: CurrentUser = Depends(get_current_user)
+):
+    """List projects a page at a time."""
     try:
-        response = supabase.table("projects").select("*").order("created_at", desc=True).execute()
-        return {"projects": response.data}
+        if sort not in PROJECT_SORT_FIELDS:
+            raise HTTPException(status_code=400, detail=f"Invalid sort field. Allowed: {', '.join(sorted(PROJECT_SORT_FIELDS))}")
+        if order not in ("asc", "desc"):
+            raise HTTPException(status_code=400, detail="Invalid order. Allowed: asc, desc")
+        
+        query = supabase.table("projects").select("*", count="exact")
+        if not user.is_service:
+            query = query.eq("user_id", user.id)
+        
+        response = query.order(sort, desc=(order == "desc")).range(offset, offset + limit - 1).execute()
+        return conditional_json(request, {
+            "projects": response.data or [],
+            "total": response.count or 0,
+            "limit": limit,
+            "offset": offset
+        })
+    except HTTPException:
+        raise
     except Exception as e:
         logger.error(f"Failed to list projects: {str(e)}")
         raise HTTPException(status_code=500, detail=f"Failed to list projects: {str(e)}")
 
-@router.get("/projects/{project_id}")
-async def get_project(project_id: str):
-    """Get a specific project with its transcription and processing jobs."""
+# Longest search query accepted by /search
+MAX_SEARCH_QUERY_LENGTH = 100
+
+@router.get("/search")
+async def search(
+    q: str,
+    type: str = "project",
+    limit: int = Query(20, ge=1, le=100),
+    user: CurrentUser = Depends(get_current_user)
+):
+    """Case-insensitive search of projects by name."""
+    try:
+        query_text = " ".join(q.split())
+        if not query_text:
+            raise HTTPException(status_code=400, detail="Search query must not be empty")
+        if len(query_text) > MAX_SEARCH_QUERY_LENGTH:
+            raise HTTPException(status_code=400, detail=f"Search query must be at most {MAX_SEARCH_QUERY_LENGTH} characters")
+        if type != "project":
+            raise HTTPException(status_code=400, detail="Invalid type. Allowed: project")
+        
+        # Escape LIKE wildcards so they match literally; PostgREST treats * as % and it can't be escaped
+        pattern = query_text.replace("\\", "\\\\").replace("%", "\\%").replace("_", "\\_").replace("*", "")
+        
+        query = supabase.table("projects").select("id, name").ilike("name", f"%{pattern}%")
+        if not user.is_service:
+            query = query.eq("user_id", user.id)
+        
+        response = query.order("created_at", desc=True).limit(limit).execute()
+        
+        results = [
+            {"type": "project", "id": project["id"], "title": project["name"], "project_id": project["id"]}
+            for project in response.data or []
+        ]
+        return {"results": results}
+        
+    except HTTPException:
+        raise
+    except Exception as e:
+        logger.error(f"Failed to search for '{q}': {str(e)}")
+        raise HTTPException(status_code=500, detail=f"Failed to search: {str(e)}")
+
+@router.get("/projects/{project_id}")
+async def get_project(project_id: str, request: Request, user: CurrentUser = Depends(get_current_user)):
+    """Get a specific project with its transcription and processing jobs."""
     try:
+        require_project_access(project_id, user)
+        
         # Get project details
         project_response = supabase.table("projects").select("*").eq("id", project_id).execute()
         
@@ -658,11 +1363,11 @@ async def get_project(project_id: str):
         # Get processing jobs
         jobs_response = supabase.table("processing_jobs").select("*").eq("project_id", project_id).order("created_at", desc=True).execute()
         
-        return {
+        return conditional_json(request, {
             "project": project,
             "transcription": transcription,
             "processing_jobs": jobs_response.data
-        }
+        })
         
     except HTTPException:
         raise
@@ -670,28 +1375,305 @@ async def get_project(project_id: str):
         logger.error(f"Failed to get project {project_id}: {str(e)}")
         raise HTTPException(status_code=500, detail=f"Failed to get project: {str(e)}")
 
+@router.get("/projects/{project_id}/jobs")
+async def list_project_jobs(
+    project_id: str,
+    request: Request,
+    status: Optional[str] = None,
+    job_type: Optional[str] = None,
+    limit: int = Query(20, ge=1, le=100),
+    offset: int = Query(0, ge=0),
+    user: CurrentUser = Depends(get_current_user)
+):
+    """List a project's processing jobs, newest first, optionally filtered by status and job type."""
+    try:
+        require_project_access(project_id, user)
+        
+        query = supabase.table("processing_jobs").select("*", count="exact").eq("project_id", project_id)
+        
+        if status:
+            query = query.eq("status", status)
+        if job_type:
+            query = query.eq("job_type", job_type)
+        
+        response = query.order("created_at", desc=True).range(offset, offset + limit - 1).execute()
+        
+        return conditional_json(request, {
+            "jobs": response.data or [],
+            "total": response.count or 0,
+            "limit": limit,
+            "offset": offset
+        })
+        
+    except HTTPException:
+        raise
+    except Exception as e:
+        logger.error(f"Failed to list jobs for project {project_id}: {str(e)}")
+        raise HTTPException(status_code=500, detail=f"Failed to list jobs: {str(e)}")
+
+@router.get("/jobs/{job_id}")
+async def get_job(job_id: str, request: Request, user: CurrentUser = Depends(get_current_user)):
+    """Get a processing job's status and progress."""
+    try:
+        job_response = supabase.table("processing_jobs").select("*").eq("id", job_id).execute()
+        
+        if not job_response.data or len(job_response.data) == 0:
+            raise HTTPException(status_code=404, detail="Job not found")
+        
+        job = job_response.data[0]
+        require_project_access(job["project_id"], user)
+        
+        return conditional_json(request, job)
+        
+    except HTTPException:
+        raise
+    except Exception as e:
+        logger.error(f"Failed to get job {job_id}: {str(e)}")
+        raise HTTPException(status_code=500, detail=f"Failed to get job: {str(e)}")
+
+# How often the event stream checks a job for changes, and sends a keep-alive comment when idle
+JOB_EVENTS_POLL_INTERVAL = 1.0
+JOB_EVENTS_KEEPALIVE_INTERVAL = 15.0
+
+@router.get("/jobs/{job_id}/events")
+async def stream_job_events(job_id: str, request: Request, user: CurrentUser = Depends(get_current_user)):
+    """
+    Server-Sent Events stream of a job's status and progress. A "job" event carrying
+    the job is sent immediately and again whenever its status, progress or error
+    changes; the stream ends once the job is no longer active or the client disconnects.
+    """
+    columns = "id, project_id, job_type, status, progress, error_message"
+    
+    def fetch_job():
+        response = supabase.table("processing_jobs").select(columns).eq("id", job_id).execute()
+        return response.data[0] if response.data else None
+    
+    try:
+        job = fetch_job()
+        if job is None:
+            raise HTTPException(status_code=404, detail="Job not found")
+        require_project_access(job["project_id"], user)
+    except HTTPException:
+        raise
+    except Exception as e:
+        logger.error(f"Failed to open event stream for job {job_id}: {str(e)}")
+        raise HTTPException(status_code=500, detail=f"Failed to stream job events: {str(e)}")
+    
+    async def events():
+        nonlocal job
+        loop = asyncio.get_event_loop()
+        last_sent_at = loop.time()
+        yield f"event: job\ndata: {json.dumps(job)}\n\n"
+        
+        while job["status"] in ACTIVE_JOB_STATUSES:
+            await asyncio.sleep(JOB_EVENTS_POLL_INTERVAL)
+            if await request.is_disconnected():
+                logger.info(f"Client disconnected from event stream for job {job_id}")
+                return
+            
+            try:
+                latest = await loop.run_in_executor(None, fetch_job)
+            except Exception as e:
+                logger.warning(f"Failed to poll job {job_id} for events: {str(e)}")
+                continue
+            
+            if latest is None:
+                # Deleted along with its project
+                yield f"event: deleted\ndata: {json.dumps({'id': job_id})}\n\n"
+                return
+            
+            if latest != job:
+                job = latest
+                last_sent_at = loop.time()
+                yield f"event: job\ndata: {json.dumps(job)}\n\n"
+            elif loop.time() - last_sent_at >= JOB_EVENTS_KEEPALIVE_INTERVAL:
+                last_sent_at = loop.time()
+                yield ": keep-alive\n\n"
+    
+    return StreamingResponse(
+        events(),
+        media_type="text/event-stream",
+        headers={
+            "Cache-Control": "no-cache",
+            "X-Accel-Buffering": "no",  # Stop nginx from buffering the stream
+            "Content-Encoding": "identity"  # Keep GZipMiddleware from buffering it too
+        }
+    )
+
+@router.get("/admin/queue")
+async def get_queue_stats(user: CurrentUser = Depends(get_current_user)):
+    """
+    Processing load for operators: queued jobs by type and the oldest one's age
+    (to spot starvation), in-flight jobs by type, and busy vs idle worker slots.
+    Only internal services may call it.
+    """
+    require_service(user)
+    try:
+        loop = asyncio.get_event_loop()
+        return await loop.run_in_executor(None, queue_stats)
+    except Exception as e:
+        logger.error(f"Failed to get queue stats: {str(e)}")
+        raise HTTPException(status_code=500, detail=f"Failed to get queue stats: {str(e)}")
+
+@router.post("/admin/workers/pool")
+async def resize_worker_pool(request: WorkerPoolRequest, user: CurrentUser = Depends(get_current_user)):
+    """
+    Set the number of pool processes on every worker (or one named worker) without
+    a restart. Processes retired by shrinking finish their current job first.
+    Only internal services may call it.
+    """
+    require_service(user)
+    try:
+        loop = asyncio.get_event_loop()
+        changes = await loop.run_in_executor(None, resize_worker_pools, request.concurrency, request.worker)
+        if not changes:
+            raise HTTPException(status_code=404, detail=f"No worker answered: {request.worker or 'none running'}")
+        return {"workers": changes}
+    except HTTPException:
+        raise
+    except Exception as e:
+        logger.error(f"Failed to resize worker pools: {str(e)}")
+        raise HTTPException(status_code=500, detail=f"Failed to resize worker pools: {str(e)}")
+
+@router.post("/jobs/{job_id}/cancel")
+async def cancel_job(job_id: str, user: CurrentUser = Depends(get_current_user)):
+    """
+    Cancel a queued or running processing job. The job is marked cancelled
+    and its task revoked; a running task stops its ffmpeg/whisper work.
+    """
+    try:
+        job_response = supabase.table("processing_jobs").select("id, project_id, job_type, status").eq("id", job_id).execute()
+        
+        if not job_response.data or len(job_response.data) == 0:
+            raise HTTPException(status_code=404, detail="Job not found")
+        
+        job = job_response.data[0]
+        require_project_access(job["project_id"], user)
+        
+        if job["status"] not in ACTIVE_JOB_STATUSES:
+            raise HTTPException(status_code=409, detail=f"Job is already {job['status']}")
+        
+        # Only flip jobs that are still active, in case the worker finished in the meantime
+        update_response = (
+            supabase.table("processing_jobs")
+            .update({"status": JobStatus.CANCELLED, "error_message": "Cancelled by user"})
+            .eq("id", job_id)
+            .in_("status", job_status_sources(JobStatus.CANCELLED))
+            .execute()
+        )
+        if not update_response.data:
+            raise HTTPException(status_code=409, detail="Job finished before it could be cancelled")
+        
+        cancel_running_task(job_id)
+        
+        # A cancelled transcription leaves the project ready to be transcribed again
+        if job["job_type"] == "transcription":
+            supabase.table("projects").update({"status": ProjectStatus.UPLOADED}).eq(
+                "id", job["project_id"]
+            ).in_("status", project_status_sources(ProjectStatus.UPLOADED)).execute()
+        
+        queue_job_webhooks(job["project_id"], job_id=job_id)
+        logger.info(f"Cancelled {job['job_type']} job {job_id} for project {job['project_id']}")
+        
+        return {"job_id": job_id, "status": JobStatus.CANCELLED}
+        
+    except HTTPException:
+        raise
+    except Exception as e:
+        logger.error(f"Failed to cancel job {job_id}: {str(e)}")
+        raise HTTPException(status_code=500, detail=f"Failed to cancel job: {str(e)}")
+
 @router.delete("/projects/{project_id}")
-async def delete_project(project_id: str):
-    """Delete a project and its associated data."""
+async def delete_project(
+    project_id: str,
+    dry_run: bool = Query(False, alias="dryRun"),
+    user: CurrentUser = Depends(get_current_user)
+):
+    """
+    Delete a project, its stored files and its related records.
+    Storage objects are removed first; failures are collected and reported
+    with 207 instead of aborting, so the database is always cleaned up.
+    With dryRun=true nothing is deleted and the response lists what would be.
+    """
     try:
-        # Get project to find video file
-        project_response = supabase.table("projects").select("video_path").eq("id", project_id).execute()
+        require_project_access(project_id, user)
+        
+        project_response = supabase.table("projects").select("video_path, processed_video_path, thumbnail_path, hls_playlist_path").eq("id", project_id).execute()
         
         if not project_response.data or len(project_response.data) == 0:
             raise HTTPException(status_code=404, detail="Project not found")
         
-        video_path = project_response.data[0]["video_path"]
+        project = project_response.data[0]
+        storage_keys = [
+            project.get(column)
+            for column in ("video_path", "processed_video_path", "thumbnail_path")
+            if project.get(column)
+        ]
+        
+        # Derived files (e.g. transcoded variants) are listed in their jobs' output_keys
+        jobs = supabase.table("processing_jobs").select("id, status, output_details").eq("project_id", project_id).execute().data or []
+        for job in jobs:
+            storage_keys.extend((job.get("output_details") or {}).get("output_keys") or [])
+        # Jobs completed from the render cache share their files with the job that rendered them
+        storage_keys = list(dict.fromkeys(storage_keys))
+        
+        storage_prefixes = [hls_prefix(project_id)] if project.get("hls_playlist_path") else []
+        
+        if dry_run:
+            transcriptions_count = supabase.table("transcriptions").select("id", count="exact").eq("project_id", project_id).execute().count or 0
+            return {
+                "message": "Dry run, nothing was deleted",
+                "projectId": project_id,
+                "dryRun": True,
+                "files": storage_keys + storage_prefixes,
+                "transcriptions": transcriptions_count,
+                "jobs": len(jobs)
+            }
+        
+        # Stop work that would otherwise keep writing to a deleted project
+        for job in jobs:
+            if job["status"] in ACTIVE_JOB_STATUSES:
+                cancel_running_task(job["id"])
         
-        # Delete from storage (ignore errors if file doesn't exist)
-        try:
-            supabase.storage.from_("videos").remove([video_path])
-        except:
-            pass  # File might not exist, continue with database cleanup
+        deleted_files = []
+        failed_files = []
+        client = get_r2_client()
+        
+        for key in storage_keys:
+            if client and client.delete_file(key):
+                deleted_files.append(key)
+            else:
+                failed_files.append(key)
+        
+        for prefix in storage_prefixes:
+            try:
+                client.delete_prefix(prefix)
+                deleted_files.append(prefix)
+            except PartialDeleteError as e:
+                logger.error(f"{str(e)} for project {project_id}")
+                failed_files.extend(e.failed_keys)
+            except Exception as e:
+                logger.error(f"Failed to delete {prefix} for project {project_id}: {str(e)}")
+                failed_files.append(prefix)
+        
+        if failed_files:
+            logger.warning(f"Failed to delete storage objects for project {project_id}: {failed_files}")
         
-        # Delete project (cascading deletes will handle related records)
+        transcriptions_response = supabase.table("transcriptions").delete().eq("project_id", project_id).execute()
+        jobs_response = supabase.table("processing_jobs").delete().eq("project_id", project_id).execute()
         supabase.table("projects").delete().eq("id", project_id).execute()
         
-        return {"message": "Project deleted successfully"}
+        return JSONResponse(
+            status_code=207 if failed_files else 200,
+            content={
+                "message": "Project deleted successfully" if not failed_files else "Project deleted, but some files could not be removed from storage",
+                "projectId": project_id,
+                "deletedFiles": deleted_files,
+                "failedFiles": failed_files,
+                "deletedTranscriptions": len(transcriptions_response.data or []),
+                "deletedJobs": len(jobs_response.data or [])
+            }
+        )
         
     except HTTPException:
         raise
@@ -699,10 +1681,794 @@ async def delete_project(project_id: str):
         logger.error(f"Failed to delete project {project_id}: {str(e)}")
         raise HTTPException(status_code=500, detail=f"Failed to delete project: {str(e)}")
 
+@router.post("/projects/{project_id}/thumbnail")
+async def create_thumbnail(
+    project_id: str,
+    request: ThumbnailRequest = Body(default=ThumbnailRequest()),
+    user: CurrentUser = Depends(get_current_user)
+):
+    """Queue generation of a poster frame for a project's video."""
+    try:
+        require_project_access(project_id, user)
+        
+        if request.width <= 0 or request.width > 3840:
+            raise HTTPException(status_code=400, detail="width must be between 1 and 3840")
+        validate_callback_url(request.callback_url)
+        
+        job_id = queue_media_job(
+            project_id, "thumbnail", generate_thumbnail_task, (request.at_time, request.width), request.callback_url
+        )
+        return {"message": "Thumbnail generation started", "job_id": job_id}
+        
+    except HTTPException:
+        raise
+    except Exception as e:
+        logger.error(f"Failed to start thumbnail generation for project {project_id}: {str(e)}")
+        raise HTTPException(status_code=500, detail=f"Failed to start thumbnail generation: {str(e)}")
+
+@router.post("/projects/{project_id}/transcode")
+async def create_transcode(
+    project_id: str,
+    request: TranscodeRequest = Body(default=TranscodeRequest()),
+    user: CurrentUser = Depends(get_current_user)
+):
+    """Queue encoding of a project's video at several resolutions (e.g. 1080p/720p/480p)."""
+    try:
+        require_project_access(project_id, user)
+        
+        if request.video_codec not in SUPPORTED_VIDEO_CODECS:
+            raise HTTPException(
+                status_code=400,
+                detail=f"Unsupported video_codec. Supported codecs: {', '.join(SUPPORTED_VIDEO_CODECS)}"
+            )
+        if request.preset not in TRANSCODE_PRESETS:
+            raise HTTPException(status_code=400, detail=f"Invalid preset. Must be one of: {', '.join(TRANSCODE_PRESETS)}")
+        
+        heights = sorted(set(request.resolutions), reverse=True)
+        if not heights or any(height < 144 or height > 2160 or height % 2 for height in heights):
+            raise HTTPException(status_code=400, detail="resolutions must be even heights between 144 and 2160")
+        validate_callback_url(request.callback_url)
+        
+        project = require_uploaded_video(project_id, "id, video_path, height")
+        
+        # Don't upscale: drop variants taller than the source when we know its height
+        source_height = project.get("height")
+        if source_height:
+            heights = [height for height in heights if height <= source_height]
+            if not heights:
+                raise HTTPException(status_code=400, detail=f"All requested resolutions exceed the source height of {source_height}p")
+        
+        job_id = queue_media_job(
+            project_id, "transcode", transcode_video_task,
+            (heights, request.video_codec, request.crf, request.preset, request.tone_map),
+            request.callback_url, project=project
+        )
+        return {"message": "Transcode started", "job_id": job_id, "resolutions": [f"{height}p" for height in heights]}
+        
+    except HTTPException:
+        raise
+    except Exception as e:
+        logger.error(f"Failed to start transcode for project {project_id}: {str(e)}")
+        raise HTTPException(status_code=500, detail=f"Failed to start transcode: {str(e)}")
+
+@router.post("/projects/{project_id}/hls")
+async def create_hls(
+    project_id: str,
+    request: HLSRequest = Body(default=HLSRequest()),
+    user: CurrentUser = Depends(get_current_user)
+):
+    """Queue packaging of a project's video for HLS streaming."""
+    try:
+        require_project_access(project_id, user)
+        validate_callback_url(request.callback_url)
+        
+        job_id = queue_media_job(project_id, "hls", package_hls_task, (request.segment_duration,), request.callback_url)
+        return {"message": "HLS packaging started", "job_id": job_id}
+        
+    except HTTPException:
+        raise
+    except Exception as e:
+        logger.error(f"Failed to start HLS packaging for project {project_id}: {str(e)}")
+        raise HTTPException(status_code=500, detail=f"Failed to start HLS packaging: {str(e)}")
+
+def sign_hls_playlist(playlist: str, prefix: str, expires_in: int) -> str:
+    """Replace the relative segment URIs in a playlist with signed storage URLs."""
+    client = get_r2_client()
+    lines = []
+    
+    for line in playlist.splitlines():
+        uri = line.strip()
+        if uri and not uri.startswith("#") and "://" not in uri:
+            line = client.get_file_url(f"{prefix}{uri}", expires_in=expires_in)
+        lines.append(line)
+    
+    return "\n".join(lines) + "\n"
+
+@router.get("/projects/{project_id}/hls")
+async def get_hls_playlist(
+    project_id: str,
+    expires_in: int = Query(storage_settings.signed_url_ttl, alias="expiresIn", ge=60, le=86400),
+    user: CurrentUser = Depends(get_current_user)
+):
+    """
+    Return the project's HLS playlist with every segment replaced by a signed URL,
+    so players can stream it directly from storage. Signed segment URLs can't be
+    resolved relative to a signed playlist URL, hence rewriting here.
+    """
+    try:
+        require_project_access(project_id, user)
+        
+        project_response = supabase.table("projects").select("hls_playlist_path").eq("id", project_id).execute()
+        
+        if not project_response.data or len(project_response.data) == 0:
+            raise HTTPException(status_code=404, detail="Project not found")
+        
+        playlist_path = project_response.data[0].get("hls_playlist_path")
+        if not playlist_path:
+            raise HTTPException(status_code=404, detail="Project has not been packaged for HLS")
+        
+        client = get_r2_client()
+        if client is None:
+            raise HTTPException(status_code=500, detail="Failed to initialize R2 client")
+        
+        loop = asyncio.get_event_loop()
+        playlist = await loop.run_in_executor(None, client.read_file, playlist_path)
+        signed = sign_hls_playlist(playlist.decode("utf-8"), hls_prefix(project_id), expires_in)
+        
+        return Response(
+            content=signed,
+            media_type="application/vnd.apple.mpegurl",
+            headers={"Cache-Control": "private, no-store"}
+        )
+        
+    except HTTPException:
+        raise
+    except Exception as e:
+        logger.error(f"Failed to get HLS playlist for project {project_id}: {str(e)}")
+        raise HTTPException(status_code=500, detail=f"Failed to get HLS playlist: {str(e)}")
+
+MAX_WATERMARK_IMAGE_SIZE = 5 * 1024 * 1024  # 5MB
+
+@router.post("/projects/{project_id}/watermark")
+async def create_watermark(
+    project_id: str,
+    image: UploadFile = File(...),
+    position: str = Form("br"),
+    opacity: float = Form(0.8),
+    scale: float = Form(0.15),
+    callback_url: Optional[str] = Form(None),
+    user: CurrentUser = Depends(get_current_user)
+):
+    """
+    Queue burning a logo into a corner (tl/tr/bl/br) of a project's video.
+    scale is the logo width as a fraction of the video width.
+    """
+    try:
+        require_project_access(project_id, user)
+        
+        file_extension = os.path.splitext(image.filename or "")[1].lower()
+        if file_extension not in WATERMARK_IMAGE_EXTENSIONS:
+            raise HTTPException(
+                status_code=400,
+                detail=f"Unsupported watermark image format. Allowed formats: {', '.join(WATERMARK_IMAGE_EXTENSIONS)}"
+            )
+        if position not in WATERMARK_POSITIONS:
+            raise HTTPException(status_code=400, detail=f"position must be one of: {', '.join(WATERMARK_POSITIONS)}")
+        if not 0 <= opacity <= 1:
+            raise HTTPException(status_code=400, detail="opacity must be between 0 and 1")
+        if not 0 < scale <= 1:
+            raise HTTPException(status_code=400, detail="scale must be greater than 0 and at most 1")
+        validate_callback_url(callback_url)
+        
+        project = require_uploaded_video(project_id)
+        reject_if_job_active(project_id, "watermark")
+        
+        contents = await image.read(MAX_WATERMARK_IMAGE_SIZE + 1)
+        if len(contents) > MAX_WATERMARK_IMAGE_SIZE:
+            raise HTTPException(status_code=413, detail="Watermark image must be at most 5MB")
+        if not contents:
+            raise HTTPException(status_code=400, detail="Watermark image is empty")
+        
+        watermark_key = f"watermark_{project_id}{file_extension}"
+        with tempfile.NamedTemporaryFile(suffix=file_extension, delete=False) as temp_file:
+            temp_file.write(contents)
+            temp_path = temp_file.name
+        
+        try:
+            await upload_to_r2_with_timeout(temp_path, watermark_key, image.content_type or "application/octet-stream", timeout=60)
+        finally:
+            os.unlink(temp_path)
+        
+        try:
+            # Recorded on the job from the start, so deleting the project removes the image even if the job never completes
+            job_id = queue_media_job(
+                project_id, "watermark", overlay_watermark_task, (watermark_key, position, opacity, scale), callback_url,
+                output_details={"watermark_image": watermark_key, "output_keys": [watermark_key]},
+                project=project
+            )
+        except HTTPException:
+            get_r2_client().delete_file(watermark_key)
+            raise
+        
+        return {"message": "Watermark overlay started", "job_id": job_id}
+        
+    except HTTPException:
+        raise
+    except Exception as e:
+        logger.error(f"Failed to start watermark overlay for project {project_id}: {str(e)}")
+        raise HTTPException(status_code=500, detail=f"Failed to start watermark overlay: {str(e)}")
+
+@router.post("/projects/{project_id}/gif", status_code=202)
+async def create_gif(
+    project_id: str,
+    request: GIFRequest = Body(default=GIFRequest()),
+    user: CurrentUser = Depends(get_current_user)
+):
+    """
+    Queue rendering a short looping GIF (at most 10s, 800px wide) from a project's video.
+    Fetch it from GET /projects/{project_id}/gif/{job_id} once the job completes.
+    """
+    try:
+        require_project_access(project_id, user)
+        validate_callback_url(request.callback_url)
+        
+        project = require_uploaded_video(project_id, "id, video_path, duration")
+        if project.get("duration") and request.start >= project["duration"]:
+            raise HTTPException(status_code=400, detail=f"start must be before the end of the video ({project['duration']}s)")
+        
+        job_id = queue_media_job(
+            project_id, "gif", generate_gif_task, (request.start, request.duration, request.fps, request.width),
+            request.callback_url, project=project
+        )
+        return {"message": "GIF generation started", "job_id": job_id}
+        
+    except HTTPException:
+        raise
+    except Exception as e:
+        logger.error(f"Failed to start GIF generation for project {project_id}: {str(e)}")
+        raise HTTPException(status_code=500, detail=f"Failed to start GIF generation: {str(e)}")
+
+@router.get("/projects/{project_id}/gif/{job_id}")
+async def get_gif_url(project_id: str, job_id: str, user: CurrentUser = Depends(get_current_user)):
+    """Return a signed URL for the GIF a completed gif job rendered."""
+    try:
+        require_project_access(project_id, user)
+        return job_output_url(project_id, job_id, "gif", "gif")
+        
+    except HTTPException:
+        raise
+    except Exception as e:
+        logger.error(f"Failed to get GIF for project {project_id}: {str(e)}")
+        raise HTTPException(status_code=500, detail=f"Failed to get GIF: {str(e)}")
+
+@router.post("/projects/{project_id}/speed", status_code=202)
+async def change_video_speed(project_id: str, request: SpeedRequest, user: CurrentUser = Depends(get_current_user)):
+    """
+    Queue rendering a sped-up (factor > 1) or slow-motion (factor < 1) copy of a
+    project's video, with audio kept in sync. Fetch it from
+    GET /projects/{project_id}/speed/{job_id} once the job completes.
+    """
+    try:
+        require_project_access(project_id, user)
+        validate_callback_url(request.callback_url)
+        
+        job_id = queue_media_job(project_id, "speed", change_speed_task, (request.factor,), request.callback_url)
+        
+        response = {"message": "Speed change started", "job_id": job_id}
+        if not SPEED_SMOOTH_RANGE[0] <= request.factor <= SPEED_SMOOTH_RANGE[1]:
+            response["warning"] = (
+                f"Factors outside {SPEED_SMOOTH_RANGE[0]}-{SPEED_SMOOTH_RANGE[1]} drop or duplicate many frames, "
+                "so motion may look choppy"
+            )
+        return response
+        
+    except HTTPException:
+        raise
+    except Exception as e:
+        logger.error(f"Failed to start speed change for project {project_id}: {str(e)}")
+        raise HTTPException(status_code=500, detail=f"Failed to start speed change: {str(e)}")
+
+@router.get("/projects/{project_id}/speed/{job_id}")
+async def get_speed_video_url(project_id: str, job_id: str, user: CurrentUser = Depends(get_current_user)):
+    """Return a signed URL for the video a completed speed job rendered."""
+    try:
+        require_project_access(project_id, user)
+        return job_output_url(project_id, job_id, "speed", "video")
+        
+    except HTTPException:
+        raise
+    except Exception as e:
+        logger.error(f"Failed to get speed-changed video for project {project_id}: {str(e)}")
+        raise HTTPException(status_code=500, detail=f"Failed to get speed-changed video: {str(e)}")
+
+@router.post("/projects/{project_id}/rotate", status_code=202)
+async def rotate_project_video(project_id: str, request: RotateRequest, user: CurrentUser = Depends(get_current_user)):
+    """
+    Queue rendering a copy of a project's video rotated clockwise by 90, 180 or
+    270 degrees, relative to how it currently displays. Fetch it from
+    GET /projects/{project_id}/rotate/{job_id} once the job completes.
+    """
+    try:
+        require_project_access(project_id, user)
+        validate_callback_url(request.callback_url)
+        
+        job_id = queue_media_job(project_id, "rotate", rotate_video_task, (request.degrees,), request.callback_url)
+        return {"message": "Rotation started", "job_id": job_id}
+        
+    except HTTPException:
+        raise
+    except Exception as e:
+        logger.error(f"Failed to start rotation for project {project_id}: {str(e)}")
+        raise HTTPException(status_code=500, detail=f"Failed to start rotation: {str(e)}")
+
+@router.get("/projects/{project_id}/rotate/{job_id}")
+async def get_rotated_video_url(project_id: str, job_id: str, user: CurrentUser = Depends(get_current_user)):
+    """Return a signed URL for the video a completed rotate job rendered."""
+    try:
+        require_project_access(project_id, user)
+        return job_output_url(project_id, job_id, "rotate", "video")
+        
+    except HTTPException:
+        raise
+    except Exception as e:
+        logger.error(f"Failed to get rotated video for project {project_id}: {str(e)}")
+        raise HTTPException(status_code=500, detail=f"Failed to get rotated video: {str(e)}")
+
+@router.post("/projects/{project_id}/reframe", status_code=202)
+async def reframe_project_video(project_id: str, request: ReframeRequest, user: CurrentUser = Depends(get_current_user)):
+    """
+    Queue rendering a vertical (9:16) copy of a landscape video. With smart_crop
+    the crop moves with the action at each scene change instead of staying centered.
+    Fetch it from GET /projects/{project_id}/reframe/{job_id} once the job completes.
+    """
+    try:
+        require_project_access(project_id, user)
+        validate_callback_url(request.callback_url)
+        
+        project = require_uploaded_video(project_id, "id, video_path, width, height")
+        
+        # Dimensions are as displayed, so a rotated phone video counts as vertical
+        if project.get("width") and project.get("height") and project["width"] * 16 <= project["height"] * 9:
+            raise HTTPException(status_code=409, detail="Project video is already vertical")
+        
+        job_id = queue_media_job(
+            project_id, "reframe", reframe_video_task, (request.smart_crop,), request.callback_url, project=project
+        )
+        return {"message": "Reframe started", "job_id": job_id}
+        
+    except HTTPException:
+        raise
+    except Exception as e:
+        logger.error(f"Failed to start reframe for project {project_id}: {str(e)}")
+        raise HTTPException(status_code=500, detail=f"Failed to start reframe: {str(e)}")
+
+@router.get("/projects/{project_id}/reframe/{job_id}")
+async def get_reframed_video_url(project_id: str, job_id: str, user: CurrentUser = Depends(get_current_user)):
+    """Return a signed URL for the vertical video a completed reframe job rendered."""
+    try:
+        require_project_access(project_id, user)
+        return job_output_url(project_id, job_id, "reframe", "video")
+        
+    except HTTPException:
+        raise
+    except Exception as e:
+        logger.error(f"Failed to get reframed video for project {project_id}: {str(e)}")
+        raise HTTPException(status_code=500, detail=f"Failed to get reframed video: {str(e)}")
+
+# Seconds silence detection may run for a request, just under the route's request timeout
+SILENCE_DETECTION_TIMEOUT = 9 * 60
+
+@router.get("/projects/{project_id}/silences")
+async def get_video_silences(
+    project_id: str,
+    noise_db: float = Query(DEFAULT_SILENCE_NOISE_DB, ge=SILENCE_NOISE_DB_RANGE[0], le=SILENCE_NOISE_DB_RANGE[1]),
+    min_duration: float = Query(
+        DEFAULT_SILENCE_MIN_DURATION, ge=SILENCE_MIN_DURATION_RANGE[0], le=SILENCE_MIN_DURATION_RANGE[1]
+    ),
+    user: CurrentUser = Depends(get_current_user)
+):
+    """
+    Preview the silences POST /projects/{project_id}/trim-silence would cut with
+    the same settings: stretches quieter than noise_db dBFS lasting at least min_duration seconds.
+    """
+    try:
+        require_project_access(project_id, user)
+        
+        project_response = supabase.table("projects").select("video_path").eq("id", project_id).execute()
+        
+        if not project_response.data or len(project_response.data) == 0:
+            raise HTTPException(status_code=404, detail="Project not found")
+        
+        video_path = project_response.data[0].get("video_path")
+        if not video_path:
+            raise HTTPException(status_code=409, detail="Project video has not finished uploading")
+        
+        client = get_r2_client()
+        if client is None:
+            raise HTTPException(status_code=503, detail="Failed to initialize R2 storage client")
+        
+        signed_url = client.get_file_url(video_path, expires_in=3600)
+        silences = await asyncio.get_event_loop().run_in_executor(
+            None, detect_silence, signed_url, noise_db, min_duration, SILENCE_DETECTION_TIMEOUT
+        )
+        
+        return {
+            "silences": [{"start": silence.start, "end": silence.end} for silence in silences],
+            "total_seconds": round(sum(silence.duration for silence in silences), 3),
+            # Trimming cuts at most this many, the longest first
+            "max_cuts": MAX_SILENCE_CUTS
+        }
+        
+    except HTTPException:
+        raise
+    except NoAudioStreamError as e:
+        raise HTTPException(status_code=422, detail=e.user_message)
+    except Exception as e:
+        logger.error(f"Failed to detect silence for project {project_id}: {str(e)}")
+        raise HTTPException(status_code=500, detail=f"Failed to detect silence: {str(e)}")
+
+@router.post("/projects/{project_id}/trim-silence", status_code=202)
+async def trim_project_silence(project_id: str, request: TrimSilenceRequest, user: CurrentUser = Depends(get_current_user)):
+    """
+    Queue rendering a copy of a project's video with its silences cut out, for
+    punchier edits. Fetch it from GET /projects/{project_id}/trim-silence/{job_id}
+    once the job completes.
+    """
+    try:
+        require_project_access(project_id, user)
+        validate_callback_url(request.callback_url)
+        
+        job_id = queue_media_job(
+            project_id, "trim_silence", trim_silence_task, (request.noise_db, request.min_duration), request.callback_url
+        )
+        return {"message": "Silence trim started", "job_id": job_id}
+        
+    except HTTPException:
+        raise
+    except Exception as e:
+        logger.error(f"Failed to start silence trim for project {project_id}: {str(e)}")
+        raise HTTPException(status_code=500, detail=f"Failed to start silence trim: {str(e)}")
+
+@router.get("/projects/{project_id}/trim-silence/{job_id}")
+async def get_trimmed_video_url(project_id: str, job_id: str, user: CurrentUser = Depends(get_current_user)):
+    """Return a signed URL for the video a completed silence trim job rendered."""
+    try:
+        require_project_access(project_id, user)
+        return job_output_url(project_id, job_id, "trim_silence", "video", extra={"silenceSeconds": "silence_seconds"})
+        
+    except HTTPException:
+        raise
+    except Exception as e:
+        logger.error(f"Failed to get trimmed video for project {project_id}: {str(e)}")
+        raise HTTPException(status_code=500, detail=f"Failed to get trimmed video: {str(e)}")
+
+@router.post("/projects/{project_id}/loudness", status_code=202)
+async def normalize_audio_loudness(
+    project_id: str,
+    request: LoudnessRequest = Body(default=LoudnessRequest()),
+    user: CurrentUser = Depends(get_current_user)
+):
+    """
+    Queue normalizing a project's audio to a target loudness (EBU R128, default
+    -14 LUFS). Fetch the result from GET /projects/{project_id}/loudness/{job_id}
+    once the job completes.
+    """
+    try:
+        require_project_access(project_id, user)
+        validate_callback_url(request.callback_url)
+        
+        job_id = queue_media_job(project_id, "loudness", normalize_loudness_task, (request.target_lufs,), request.callback_url)
+        return {"message": "Loudness normalization started", "job_id": job_id}
+        
+    except HTTPException:
+        raise
+    except Exception as e:
+        logger.error(f"Failed to start loudness normalization for project {project_id}: {str(e)}")
+        raise HTTPException(status_code=500, detail=f"Failed to start loudness normalization: {str(e)}")
+
+@router.get("/projects/{project_id}/loudness/{job_id}")
+async def get_normalized_video_url(project_id: str, job_id: str, user: CurrentUser = Depends(get_current_user)):
+    """Return a signed URL for the video a completed loudness job rendered, with the measured input loudness."""
+    try:
+        require_project_access(project_id, user)
+        return job_output_url(project_id, job_id, "loudness", "video", extra={"targetLufs": "target_lufs", "measuredLufs": "measured_lufs"})
+        
+    except HTTPException:
+        raise
+    except Exception as e:
+        logger.error(f"Failed to get normalized video for project {project_id}: {str(e)}")
+        raise HTTPException(status_code=500, detail=f"Failed to get normalized video: {str(e)}")
+
+def get_transcription_segments(project_id: str) -> list:
+    """
+    Load a project's transcription as whisper-style segments. A transcription
+    stored as plain text becomes a single cue spanning the whole video.
+    """
+    transcription_response = supabase.table("transcriptions").select("transcription_data").eq("project_id", project_id).execute()
+    
+    if not transcription_response.data or len(transcription_response.data) == 0:
+        raise HTTPException(status_code=404, detail="Transcription not found")
+    
+    transcription_data = transcription_response.data[0].get("transcription_data") or {}
+    if isinstance(transcription_data, str):
+        transcription_data = {"text": transcription_data}
+    
+    segments = [s for s in transcription_data.get("segments") or [] if s.get("text", "").strip()]
+    if segments:
+        return segments
+    
+    text = (transcription_data.get("text") or "").strip()
+    if not text:
+        return []
+    
+    project_response = supabase.table("projects").select("duration").eq("id", project_id).execute()
+    duration = (project_response.data[0].get("duration") if project_response.data else None) or 0
+    return [{"start": 0.0, "end": float(duration), "text": text}]
+
+def get_transcription_language(project_id: str) -> Optional[str]:
+    """The language a project was transcribed in, if known."""
+    response = supabase.table("projects").select("language").eq("id", project_id).execute()
+    return response.data[0].get("language") if response.data else None
+
+def get_export_filename(project_id: str, extension: str) -> str:
+    """Build a download filename from the project name."""
+    project_response = supabase.table("projects").select("name").eq("id", project_id).execute()
+    project_name = project_response.data[0]["name"] if project_response.data else "video"
+    
+    # Clean filename
+    safe_filename = "".join(c for c in project_name if c.isalnum() or c in (' ', '-', '_')).rstrip()
+    return f"{safe_filename or 'video'}.{extension}"
+
+@router.get("/projects/{project_id}/audio-tracks")
+async def get_audio_tracks(project_id: str, user: CurrentUser = Depends(get_current_user)):
+    """List the audio tracks of a project's video, e.g. to pick a language to transcribe."""
+    try:
+        require_project_access(project_id, user)
+        
+        project_response = supabase.table("projects").select("video_path").eq("id", project_id).execute()
+        
+        if not project_response.data or len(project_response.data) == 0:
+            raise HTTPException(status_code=404, detail="Project not found")
+        
+        video_path = project_response.data[0].get("video_path")
+        if not video_path:
+            raise HTTPException(status_code=409, detail="Project video has not finished uploading")
+        
+        client = get_r2_client()
+        if client is None:
+            raise HTTPException(status_code=503, detail="Failed to initialize R2 storage client")
+        
+        # ffprobe only reads the container headers it needs from the signed URL, not the whole file
+        signed_url = client.get_file_url(video_path, expires_in=300)
+        tracks = await asyncio.get_event_loop().run_in_executor(None, list_audio_tracks, signed_url)
+        
+        return {"audio_tracks": tracks}
+        
+    except HTTPException:
+        raise
+    except Exception as e:
+        logger.error(f"Failed to list audio tracks for project {project_id}: {str(e)}")
+        raise HTTPException(status_code=500, detail=f"Failed to list audio tracks: {str(e)}")
+
+@router.get("/projects/{project_id}/transcription")
+async def get_transcription(
+    project_id: str,
+    request: Request,
+    format: Literal["json", "text"] = "json",
+    user: CurrentUser = Depends(get_current_user)
+):
+    """
+    The project's transcript as one block of text: JSON with the language and
+    segment count, or plain text with format=text. Segments are fetched a page
+    at a time from /transcription/segments.
+    """
+    try:
+        require_project_access(project_id, user)
+        
+        segments = get_transcription_segments(project_id)
+        text = " ".join(segment["text"].strip() for segment in segments)
+        
+        if format == "text":
+            return PlainTextResponse(text)
+        
+        return conditional_json(request, {
+            "text": text,
+            "language": get_transcription_language(project_id),
+            "total_segments": len(segments)
+        })
+        
+    except HTTPException:
+        raise
+    except Exception as e:
+        logger.error(f"Failed to get transcription for project {project_id}: {str(e)}")
+        raise HTTPException(status_code=500, detail=f"Failed to get transcription: {str(e)}")
+
+@router.get("/projects/{project_id}/transcription/segments")
+async def list_transcription_segments(
+    project_id: str,
+    request: Request,
+    limit: int = Query(100, ge=1, le=500),
+    offset: int = Query(0, ge=0),
+    user: CurrentUser = Depends(get_current_user)
+):
+    """List a project's transcript segments a page at a time, in order."""
+    try:
+        require_project_access(project_id, user)
+        
+        segments = get_transcription_segments(project_id)
+        page = [
+            {"index": offset + i, "start": segment.get("start"), "end": segment.get("end"), "text": segment["text"].strip()}
+            for i, segment in enumerate(segments[offset:offset + limit])
+        ]
+        
+        return conditional_json(request, {
+            "segments": page,
+            "total": len(segments),
+            "limit": limit,
+            "offset": offset
+        })
+        
+    except HTTPException:
+        raise
+    except Exception as e:
+        logger.error(f"Failed to list transcription segments for project {project_id}: {str(e)}")
+        raise HTTPException(status_code=500, detail=f"Failed to list transcription segments: {str(e)}")
+
+@router.get("/projects/{project_id}/metadata", response_model=VideoMetadataResponse)
+async def get_video_metadata(project_id: str, request: Request, user: CurrentUser = Depends(get_current_user)):
+    """
+    Duration, bitrate, codecs, dimensions and audio tracks of a project's video.
+    Probed on first request (ffprobe only reads the headers it needs, whatever
+    the file size) and cached on the project.
+    """
+    try:
+        require_project_access(project_id, user)
+        
+        project_response = supabase.table("projects").select("video_path, metadata").eq("id", project_id).execute()
+        
+        if not project_response.data or len(project_response.data) == 0:
+            raise HTTPException(status_code=404, detail="Project not found")
+        
+        project = project_response.data[0]
+        metadata = project.get("metadata")
+        
+        if not metadata:
+            video_path = project.get("video_path")
+            if not video_path:
+                raise HTTPException(status_code=409, detail="Project video has not finished uploading")
+            
+            client = get_r2_client()
+            if client is None:
+                raise HTTPException(status_code=503, detail="Failed to initialize R2 storage client")
+            
+            signed_url = client.get_file_url(video_path, expires_in=300)
+            probed = await asyncio.get_event_loop().run_in_executor(None, probe_metadata, signed_url)
+            metadata = probed.summary()
+            supabase.table("projects").update({"metadata": metadata}).eq("id", project_id).execute()
+        
+        return conditional_json(request, VideoMetadataResponse(project_id=project_id, **metadata).model_dump())
+        
+    except HTTPException:
+        raise
+    except Exception as e:
+        logger.error(f"Failed to get metadata for project {project_id}: {str(e)}")
+        raise HTTPException(status_code=500, detail=f"Failed to get video metadata: {str(e)}")
+
+# Seconds scene detection may run for a request, just under the route's request timeout
+SCENE_DETECTION_TIMEOUT = 14 * 60
+
+@router.get("/projects/{project_id}/scenes")
+async def get_video_scenes(
+    project_id: str,
+    threshold: float = Query(DEFAULT_SCENE_THRESHOLD, gt=0, lt=1),
+    user: CurrentUser = Depends(get_current_user)
+):
+    """
+    Timestamps (seconds) where the project's video cuts to a new scene, as
+    candidate clip boundaries. Lower thresholds find subtler cuts. Detection
+    decodes the whole video, so results are cached on the project per threshold.
+    """
+    try:
+        require_project_access(project_id, user)
+        
+        project_response = supabase.table("projects").select("video_path, duration, scenes").eq("id", project_id).execute()
+        
+        if not project_response.data or len(project_response.data) == 0:
+            raise HTTPException(status_code=404, detail="Project not found")
+        
+        project = project_response.data[0]
+        video_path = project.get("video_path")
+        if not video_path:
+            raise HTTPException(status_code=409, detail="Project video has not finished uploading")
+        
+        scenes = project.get("scenes") or {}
+        key = f"{threshold:g}"
+        cuts = scenes.get(key)
+        
+        if cuts is None:
+            client = get_r2_client()
+            if client is None:
+                raise HTTPException(status_code=503, detail="Failed to initialize R2 storage client")
+            
+            signed_url = client.get_file_url(video_path, expires_in=3600)
+            cuts = await asyncio.get_event_loop().run_in_executor(
+                None, detect_scenes, signed_url, threshold, SCENE_DETECTION_TIMEOUT
+            )
+            
+            supabase.table("projects").update({"scenes": {**scenes, key: cuts}}).eq("id", project_id).execute()
+            logger.info(f"Detected {len(cuts)} scene cuts in project {project_id} at threshold {key}")
+        
+        # Consecutive cuts bound the scenes; the last runs to the end of the video
+        boundaries = [0.0] + cuts
+        ends = cuts + [project.get("duration")]
+        return {
+            "threshold": threshold,
+            "cuts": cuts,
+            "scenes": [{"start": start, "end": end} for start, end in zip(boundaries, ends)]
+        }
+        
+    except HTTPException:
+        raise
+    except Exception as e:
+        logger.error(f"Failed to detect scenes for project {project_id}: {str(e)}")
+        raise HTTPException(status_code=500, detail=f"Failed to detect scenes: {str(e)}")
+
+@router.get("/projects/{project_id}/transcription.srt")
+async def export_transcription_srt(project_id: str, user: CurrentUser = Depends(get_current_user)):
+    """Export the project's transcription as an SRT subtitle file."""
+    try:
+        require_project_access(project_id, user)
+        
+        segments = get_transcription_segments(project_id)
+        language = get_transcription_language(project_id)
+        
+        headers = {"Content-Disposition": f'attachment; filename="{get_export_filename(project_id, "srt")}"'}
+        if language:
+            headers["Content-Language"] = language
+        
+        return Response(
+            content=segments_to_srt(segments),
+            media_type="application/x-subrip",
+            headers=headers
+        )
+        
+    except HTTPException:
+        raise
+    except Exception as e:
+        logger.error(f"Failed to export SRT for project {project_id}: {str(e)}")
+        raise HTTPException(status_code=500, detail=f"Failed to export SRT: {str(e)}")
+
+@router.get("/projects/{project_id}/transcription.vtt")
+async def export_transcription_vtt(project_id: str, user: CurrentUser = Depends(get_current_user)):
+    """Export the project's transcription as a WebVTT subtitle file."""
+    try:
+        require_project_access(project_id, user)
+        
+        segments = get_transcription_segments(project_id)
+        language = get_transcription_language(project_id)
+        
+        headers = {"Content-Disposition": f'attachment; filename="{get_export_filename(project_id, "vtt")}"'}
+        if language:
+            headers["Content-Language"] = language
+        
+        return Response(
+            content=segments_to_vtt(segments, language),
+            media_type="text/vtt",
+            headers=headers
+        )
+        
+    except HTTPException:
+        raise
+    except Exception as e:
+        logger.error(f"Failed to export VTT for project {project_id}: {str(e)}")
+        raise HTTPException(status_code=500, detail=f"Failed to export VTT: {str(e)}")
+
 @router.get("/projects/{project_id}/download/srt")
-async def download_srt(project_id: str):
+async def download_srt(project_id: str, user: CurrentUser = Depends(get_current_user)):
     """Download the SRT file for a project."""
     try:
+        require_project_access(project_id, user)
+        
         # Get transcription data
         transcription_response = supabase.table("transcriptions").select("srt_content").eq("project_id", project_id).execute()
         
@@ -734,10 +2500,131 @@ async def download_srt(project_id: str):
         logger.error(f"Failed to download SRT for project {project_id}: {str(e)}")
         raise HTTPException(status_code=500, detail=f"Failed to download SRT: {str(e)}")
 
+# Cached signed URLs are regenerated once they are this close to expiring
+DOWNLOAD_URL_REFRESH_MARGIN = timedelta(minutes=5)
+
+@router.get("/projects/{project_id}/download-url")
+async def get_download_url(
+    project_id: str,
+    processed: bool = False,
+    refresh: bool = False,
+    expires_in: int = Query(storage_settings.signed_url_ttl, alias="expiresIn", ge=60, le=86400),
+    user: CurrentUser = Depends(get_current_user)
+):
+    """
+    Return a signed download URL for the original or processed video.
+    URLs are cached on the project and reused until they are within
+    five minutes of expiry, unless refresh=true is passed.
+    """
+    try:
+        require_project_access(project_id, user)
+        
+        project_response = supabase.table("projects").select("video_path, processed_video_path, download_urls").eq("id", project_id).execute()
+        
+        if not project_response.data or len(project_response.data) == 0:
+            raise HTTPException(status_code=404, detail="Project not found")
+        
+        project = project_response.data[0]
+        variant = "processed" if processed else "original"
+        video_path = project.get("processed_video_path") if processed else project.get("video_path")
+        
+        if not video_path:
+            raise HTTPException(status_code=404, detail=f"{variant.capitalize()} video not available")
+        
+        download_urls = project.get("download_urls") or {}
+        cached = download_urls.get(variant)
+        now = datetime.now(timezone.utc)
+        
+        if not refresh and cached and cached.get("path") == video_path:
+            cached_expires_at = datetime.fromisoformat(cached["expires_at"])
+            if cached_expires_at - now > DOWNLOAD_URL_REFRESH_MARGIN:
+                return {"url": cached["url"], "expiresAt": cached["expires_at"], "cached": True}
+        
+        client = get_r2_client()
+        if client is None:
+            raise HTTPException(status_code=503, detail="Failed to initialize R2 storage client")
+        
+        url = client.get_file_url(video_path, expires_in=expires_in)
+        expires_at = (now + timedelta(seconds=expires_in)).isoformat()
+        
+        download_urls[variant] = {"url": url, "path": video_path, "expires_at": expires_at}
+        supabase.table("projects").update({
+            "download_urls": download_urls
+        }).eq("id", project_id).execute()
+        
+        return {"url": url, "expiresAt": expires_at, "cached": False}
+        
+    except HTTPException:
+        raise
+    except Exception as e:
+        logger.error(f"Failed to get download URL for project {project_id}: {str(e)}")
+        raise HTTPException(status_code=500, detail=f"Failed to get download URL: {str(e)}")
+
+# Project statuses while transcription or the caption overlay is still running
+PROJECT_PROCESSING_STATUSES = (ProjectStatus.PROCESSING, ProjectStatus.ADDING_CAPTIONS)
+
+@router.get("/projects/{project_id}/processed-video")
+async def get_processed_video(project_id: str, user: CurrentUser = Depends(get_current_user)):
+    """
+    Status of the captioned video. Returns a signed URL once it is ready,
+    409 with the transcription job's progress while it is being produced,
+    and 404 if captioning never ran or failed.
+    """
+    try:
+        require_project_access(project_id, user)
+        
+        project_response = supabase.table("projects").select("status, processed_video_path, error_message").eq("id", project_id).execute()
+        
+        if not project_response.data or len(project_response.data) == 0:
+            raise HTTPException(status_code=404, detail="Project not found")
+        
+        project = project_response.data[0]
+        
+        job_response = supabase.table("processing_jobs").select("id, progress").eq("project_id", project_id).eq("job_type", "transcription").in_("status", ACTIVE_JOB_STATUSES).limit(1).execute()
+        job = job_response.data[0] if job_response.data else None
+        
+        # A previous processed video may still be recorded while a new run is in progress
+        if project["status"] in PROJECT_PROCESSING_STATUSES or job:
+            job = job or {}
+            raise HTTPException(
+                status_code=409,
+                detail={
+                    "message": "Processed video is not ready yet",
+                    "status": project["status"],
+                    "job_id": job.get("id"),
+                    "progress": job.get("progress")
+                }
+            )
+        
+        if not project.get("processed_video_path"):
+            detail = {"message": "Processed video not available", "status": project["status"]}
+            if project.get("error_message"):
+                detail["error"] = project["error_message"]
+            raise HTTPException(status_code=404, detail=detail)
+        
+        client = get_r2_client()
+        if client is None:
+            raise HTTPException(status_code=503, detail="Failed to initialize R2 storage client")
+        
+        expires_at = datetime.now(timezone.utc) + timedelta(seconds=storage_settings.signed_url_ttl)
+        return {
+            "status": project["status"],
+            "url": client.get_file_url(project["processed_video_path"]),
+            "expiresAt": expires_at.isoformat()
+        }
+        
+    except HTTPException:
+        raise
+    except Exception as e:
+        logger.error(f"Failed to get processed video for project {project_id}: {str(e)}")
+        raise HTTPException(status_code=500, detail=f"Failed to get processed video: {str(e)}")
+
 @router.get("/projects/{project_id}/download/video")
-async def download_video(project_id: str, processed: bool = False):
+async def download_video(project_id: str, processed: bool = False, user: CurrentUser = Depends(get_current_user)):
     """Download the original or processed video file."""
     try:
+        require_project_access(project_id, user)
+        
         # Get project details
         project_response = supabase.table("projects").select("name, video_path, processed_video_path").eq("id", project_id).execute()
         
@@ -763,7 +2650,7 @@ async def download_video(project_id: str, processed: bool = False):
                 raise HTTPException(status_code=503, detail="Failed to initialize R2 storage client")
                 
             # Generate a presigned URL for download
-            download_url = client.get_file_url(video_path, expires_in=3600)
+            download_url = client.get_file_url(video_path)
                 
             # Return redirect to presigned URL for direct download
             from fastapi.responses import RedirectResponse
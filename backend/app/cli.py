@@ -0,0 +1,157 @@
+"""
+Run the media pipeline's ffmpeg steps directly, without the queue or storage,
+for debugging and scripting. Results are printed as JSON.
+
+    python -m app.cli                                  # same as "run"
+    python -m app.cli run                              # start a Celery worker
+    python -m app.cli probe video.mp4
+    python -m app.cli scenes video.mp4 --threshold 0.3
+    python -m app.cli silences video.mp4 --noise-db -35
+    python -m app.cli thumbnail video.mp4 thumb.jpg --at 2.5
+    python -m app.cli transcode video.mp4 out.mp4 --height 720
+    python -m app.cli gif video.mp4 out.gif --start 4 --duration 3
+    python -m app.cli captions video.mp4 captions.srt out.mp4
+"""
+import os
+import sys
+import json
+import tempfile
+import argparse
+from dataclasses import asdict
+from app.services.ffmpeg_service import (
+    FFmpegError, probe_metadata, generate_thumbnail, transcode, TranscodeOptions, TONE_MAP_MODES,
+    generate_gif, burn_captions, detect_scenes, DEFAULT_SCENE_THRESHOLD, detect_silence, DEFAULT_SILENCE_NOISE_DB,
+    DEFAULT_SILENCE_MIN_DURATION
+)
+from app.services.caption_service import parse_srt, segments_to_ass
+
+def print_progress(fraction: float):
+    print(f"{fraction:.0%}", file=sys.stderr)
+
+def run_worker(args) -> dict:
+    from app.core.celery_app import celery_app
+    celery_app.worker_main(["worker", f"--loglevel={args.loglevel}"])
+    return {}
+
+def probe(args) -> dict:
+    metadata = asdict(probe_metadata(args.input))
+    metadata.pop("raw")
+    return metadata
+
+def scenes(args) -> dict:
+    return {"threshold": args.threshold, "cuts": detect_scenes(args.input, args.threshold)}
+
+def silences(args) -> dict:
+    found = detect_silence(args.input, args.noise_db, args.min_duration)
+    return {"silences": [asdict(silence) for silence in found]}
+
+def thumbnail(args) -> dict:
+    generate_thumbnail(args.input, args.output, args.at, args.width)
+    return {"output": args.output, "size_bytes": os.path.getsize(args.output)}
+
+def transcode_video(args) -> dict:
+    options = TranscodeOptions(
+        height=args.height, video_codec=args.codec, crf=args.crf, preset=args.preset, tone_map=args.tone_map
+    )
+    copied = transcode(args.input, args.output, options, print_progress)
+    return {"output": args.output, "size_bytes": os.path.getsize(args.output), "stream_copy": copied}
+
+def gif(args) -> dict:
+    generate_gif(args.input, args.output, args.start, args.duration, args.fps, args.width)
+    return {"output": args.output, "size_bytes": os.path.getsize(args.output)}
+
+def captions(args) -> dict:
+    """Burn an SRT (styled like generated captions) or ASS file into a video."""
+    with open(args.subtitles, "r", encoding="utf-8") as f:
+        content = f.read()
+    result = {"output": args.output}
+    if not args.subtitles.lower().endswith(".ass"):
+        segments = parse_srt(content)
+        content = segments_to_ass(segments)
+        result["captions"] = len(segments)
+
+    # burn_captions only reads subtitle files from the temp directory
+    with tempfile.NamedTemporaryFile(mode="w", suffix=".ass", delete=False) as ass_file:
+        ass_file.write(content)
+        ass_path = ass_file.name
+    try:
+        result["size_bytes"] = burn_captions(args.input, ass_path, args.output, print_progress)
+    finally:
+        os.unlink(ass_path)
+    return result
+
+def build_parser() -> argparse.ArgumentParser:
+    parser = argparse.ArgumentParser(prog="python -m app.cli", description="YoVideo media processing tools")
+    commands = parser.add_subparsers(dest="command")
+
+    run_parser = commands.add_parser("run", help="Start a Celery worker (the default)")
+    run_parser.add_argument("--loglevel", default="info")
+    run_parser.set_defaults(handler=run_worker)
+
+    probe_parser = commands.add_parser("probe", help="Print a video's metadata")
+    probe_parser.add_argument("input")
+    probe_parser.set_defaults(handler=probe)
+
+    scenes_parser = commands.add_parser("scenes", help="Print the timestamps of scene cuts")
+    scenes_parser.add_argument("input")
+    scenes_parser.add_argument("--threshold", type=float, default=DEFAULT_SCENE_THRESHOLD, help="Scene score from 0 to 1")
+    scenes_parser.set_defaults(handler=scenes)
+
+    silences_parser = commands.add_parser("silences", help="Print the silent stretches of the audio")
+    silences_parser.add_argument("input")
+    silences_parser.add_argument("--noise-db", type=float, default=DEFAULT_SILENCE_NOISE_DB)
+    silences_parser.add_argument("--min-duration", type=float, default=DEFAULT_SILENCE_MIN_DURATION, help="Seconds")
+    silences_parser.set_defaults(handler=silences)
+
+    thumbnail_parser = commands.add_parser("thumbnail", help="Capture a JPEG frame")
+    thumbnail_parser.add_argument("input")
+    thumbnail_parser.add_argument("output")
+    thumbnail_parser.add_argument("--at", type=float, default=1.0, help="Seconds into the video")
+    thumbnail_parser.add_argument("--width", type=int, default=640)
+    thumbnail_parser.set_defaults(handler=thumbnail)
+
+    transcode_parser = commands.add_parser("transcode", help="Encode a web-friendly MP4")
+    transcode_parser.add_argument("input")
+    transcode_parser.add_argument("output")
+    transcode_parser.add_argument("--height", type=int, default=720)
+    transcode_parser.add_argument("--codec", default="libx264")
+    transcode_parser.add_argument("--crf", type=int, default=23)
+    transcode_parser.add_argument("--preset", default="medium")
+    transcode_parser.add_argument("--tone-map", choices=TONE_MAP_MODES, default="auto")
+    transcode_parser.set_defaults(handler=transcode_video)
+
+    gif_parser = commands.add_parser("gif", help="Render a looping GIF")
+    gif_parser.add_argument("input")
+    gif_parser.add_argument("output")
+    gif_parser.add_argument("--start", type=float, default=0.0)
+    gif_parser.add_argument("--duration", type=float, default=3.0)
+    gif_parser.add_argument("--fps", type=int, default=12)
+    gif_parser.add_argument("--width", type=int, default=480)
+    gif_parser.set_defaults(handler=gif)
+
+    captions_parser = commands.add_parser("captions", help="Burn SRT or ASS captions into a video")
+    captions_parser.add_argument("input")
+    captions_parser.add_argument("subtitles")
+    captions_parser.add_argument("output")
+    captions_parser.set_defaults(handler=captions)
+
+    return parser
+
+def main(argv: list = None) -> int:
+    parser = build_parser()
+    args = parser.parse_args(argv)
+    if args.command is None:
+        args = parser.parse_args(["run", *(argv or [])])
+
+    try:
+        result = args.handler(args)
+    except (FFmpegError, ValueError, OSError) as e:
+        print(json.dumps({"error": str(e)}), file=sys.stderr)
+        return 1
+
+    if result:
+        print(json.dumps(result, indent=2))
+    return 0
+
+if __name__ == "__main__":
+    sys.exit(main())
@@ -0,0 +1,83 @@
+import os
+import hmac
+import logging
+from dataclasses import dataclass
+from typing import Optional
+import jwt
+from fastapi import Header, HTTPException, Request
+
+logger = logging.getLogger(__name__)
+
+# Owner of projects created while authentication is disabled for local development
+DEV_USER_ID = "00000000-0000-0000-0000-000000000001"
+
+@dataclass
+class CurrentUser:
+    id: Optional[str]
+    is_service: bool = False
+
+def auth_disabled() -> bool:
+    return os.environ.get("AUTH_DISABLED", "").lower() in ("1", "true", "yes")
+
+def get_current_user(authorization: Optional[str] = Header(None)) -> CurrentUser:
+    """
+    Resolve the caller from a Supabase JWT in the Authorization header.
+    The SERVICE_API_TOKEN bearer token identifies internal services, which may act on any project.
+    """
+    if auth_disabled():
+        return CurrentUser(id=DEV_USER_ID)
+    
+    if not authorization or not authorization.lower().startswith("bearer "):
+        raise HTTPException(status_code=401, detail="Missing bearer token", headers={"WWW-Authenticate": "Bearer"})
+    
+    token = authorization[len("bearer "):].strip()
+    
+    service_token = os.environ.get("SERVICE_API_TOKEN")
+    if service_token and hmac.compare_digest(token, service_token):
+        return CurrentUser(id=None, is_service=True)
+    
+    jwt_secret = os.environ.get("SUPABASE_JWT_SECRET")
+    if not jwt_secret:
+        logger.error("SUPABASE_JWT_SECRET is not set, rejecting authenticated request")
+        raise HTTPException(status_code=401, detail="Authentication is not configured", headers={"WWW-Authenticate": "Bearer"})
+    
+    try:
+        claims = jwt.decode(token, jwt_secret, algorithms=["HS256"], audience="authenticated")
+    except jwt.PyJWTError as e:
+        raise HTTPException(status_code=401, detail=f"Invalid token: {str(e)}", headers={"WWW-Authenticate": "Bearer"})
+    
+    user_id = claims.get("sub")
+    if not user_id:
+        raise HTTPException(status_code=401, detail="Token has no subject", headers={"WWW-Authenticate": "Bearer"})
+    
+    return CurrentUser(id=user_id)
+
+def request_identity(request: Request) -> str:
+    """
+    Who sent a request, for middleware that keeps per-caller state: the user id, "service",
+    or the client IP for requests without valid credentials or while authentication is disabled.
+    """
+    authorization = request.headers.get("authorization")
+    if authorization and not auth_disabled():
+        try:
+            user = get_current_user(authorization)
+            if user.id:
+                return f"user:{user.id}"
+            if user.is_service:
+                return "service"
+        except HTTPException:
+            pass
+    return f"ip:{request.client.host if request.client else 'unknown'}"
+
+def ensure_project_owner(project: dict, user: CurrentUser):
+    """Raise 403 unless the caller owns the project (services may access any project)."""
+    if user.is_service:
+        return
+    if project.get("user_id") != user.id:
+        raise HTTPException(status_code=403, detail="You do not have access to this project")
+
+def require_service(user: CurrentUser):
+    """Raise 403 unless the caller is an internal service (or authentication is disabled for development)."""
+    if user.is_service or auth_disabled():
+        return
+    raise HTTPException(status_code=403, detail="This endpoint is only available to internal services")
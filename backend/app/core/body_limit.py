@@ -0,0 +1,93 @@
+import re
+import json
+import logging
+from app.core.errors import error_body
+
+logger = logging.getLogger(__name__)
+
+MB = 1024 * 1024
+
+# Request bodies larger than this are rejected unless a route below allows more
+DEFAULT_BODY_LIMIT = 1 * MB
+
+# (method, path pattern, max body bytes) for routes that accept files
+BODY_LIMIT_ROUTES = [
+    ("POST", re.compile(r"^/api/v1/upload$"), 2 * 1024 * MB),
+    ("POST", re.compile(r"^/api/v1/upload/chunk$"), 64 * MB),  # Clients send 5MB chunks
+    ("POST", re.compile(r"^/api/v1/projects/[^/]+/watermark$"), 6 * MB),  # 5MB image plus form fields
+]
+
+class BodyLimitMiddleware:
+    """
+    Reject request bodies over the limit for their route with 413. Requests that
+    declare a Content-Length are refused before any of the body is read; for
+    streamed bodies the byte count is tracked as the app reads, and once it
+    goes over, whatever response the app produces is replaced with the 413.
+    """
+
+    def __init__(self, app, default_limit: int = DEFAULT_BODY_LIMIT, routes: list = None):
+        self.app = app
+        self.default_limit = default_limit
+        self.routes = BODY_LIMIT_ROUTES if routes is None else routes
+
+    def _limit_for(self, method: str, path: str) -> int:
+        for route_method, pattern, limit in self.routes:
+            if method == route_method and pattern.match(path):
+                return limit
+        return self.default_limit
+
+    async def _send_too_large(self, send, limit: int):
+        body = json.dumps(error_body(f"Request body too large, the limit for this endpoint is {limit} bytes")).encode()
+        await send({
+            "type": "http.response.start",
+            "status": 413,
+            "headers": [(b"content-type", b"application/json"), (b"content-length", str(len(body)).encode())],
+        })
+        await send({"type": "http.response.body", "body": body})
+
+    async def __call__(self, scope, receive, send):
+        if scope["type"] != "http":
+            return await self.app(scope, receive, send)
+
+        limit = self._limit_for(scope["method"], scope["path"])
+        headers = dict(scope.get("headers") or [])
+        content_length = headers.get(b"content-length")
+
+        if content_length is not None:
+            try:
+                declared = int(content_length)
+            except ValueError:
+                declared = 0
+            if declared > limit:
+                logger.info(f"Rejected {scope['method']} {scope['path']}: Content-Length {declared} over {limit}")
+                return await self._send_too_large(send, limit)
+
+        received = 0
+        exceeded = False
+
+        async def limited_receive():
+            nonlocal received, exceeded
+            message = await receive()
+            if message["type"] == "http.request" and not exceeded:
+                received += len(message.get("body", b""))
+                if received > limit:
+                    exceeded = True
+                    logger.info(f"Rejected {scope['method']} {scope['path']}: body over {limit} bytes")
+                    # Looks like the client went away, so the app stops reading
+                    return {"type": "http.disconnect"}
+            return message
+
+        response_started = False
+
+        async def limited_send(message):
+            nonlocal response_started
+            if exceeded:
+                if not response_started:
+                    response_started = True
+                    await self._send_too_large(send, limit)
+                return
+            if message["type"] == "http.response.start":
+                response_started = True
+            await send(message)
+
+        await self.app(scope, limited_receive, limited_send)
@@ -1,22 +1,124 @@
 import os
+import logging
 from celery import Celery
+from celery.exceptions import SoftTimeLimitExceeded
+from celery.signals import worker_init, task_prerun, task_postrun
 from dotenv import load_dotenv
+from app.core.statuses import JobStatus
 
 load_dotenv()
 
+logger = logging.getLogger(__name__)
+
 redis_url = os.getenv("REDIS_URL", "redis://localhost:6379/0")
 
+# Task priorities (the Redis transport treats lower numbers as more urgent)
+PRIORITY_HIGH = 0  # User-facing work such as transcription of a fresh upload
+PRIORITY_NORMAL = 5
+PRIORITY_LOW = 9  # Derived media that can wait behind user-facing jobs
+
+def get_job_timeout(job_type: str, default: int) -> int:
+    """
+    Soft time limit in seconds for a job type, overridable via
+    <JOB_TYPE>_TIMEOUT_SECONDS (e.g. THUMBNAIL_TIMEOUT_SECONDS=120).
+    """
+    return int(os.getenv(f"{job_type.upper()}_TIMEOUT_SECONDS", default))
+
+# Job statuses that mean work is still queued or running
+ACTIVE_JOB_STATUSES = [JobStatus.PENDING, JobStatus.PROCESSING, JobStatus.RETRYING]
+
+# Message recorded on processing_jobs when a task exceeds its time limit
+JOB_TIMEOUT_MESSAGE = "execution timed out"
+
+# A job whose heartbeat is older than this is presumed abandoned by a crashed
+# worker and may be claimed again. Running jobs refresh it several times per lease.
+JOB_LEASE_SECONDS = int(os.getenv("JOB_LEASE_SECONDS", 300))
+
+# Retry policy for transient job failures
+MAX_JOB_RETRIES = int(os.getenv("JOB_MAX_RETRIES", 3))
+JOB_RETRY_BACKOFF_SECONDS = int(os.getenv("JOB_RETRY_BACKOFF_SECONDS", 10))
+
+class PermanentError(Exception):
+    """A job failure that retrying cannot fix, such as a missing project or input file."""
+
+def should_retry(task, exc: Exception) -> bool:
+    """Whether a failed task attempt should be retried rather than marked failed."""
+    if isinstance(exc, (PermanentError, SoftTimeLimitExceeded)) or not getattr(exc, "retryable", True):
+        return False
+    return task.request.retries < task.max_retries
+
+def user_error_message(exc: Exception) -> str:
+    """A failure description suitable for showing to users, without raw tool output."""
+    if isinstance(exc, SoftTimeLimitExceeded):
+        return "Processing took too long and was stopped"
+    return getattr(exc, "user_message", None) or str(exc)
+
+def retry_countdown(task) -> int:
+    """Exponential backoff delay before the next attempt of a task."""
+    return JOB_RETRY_BACKOFF_SECONDS * (2 ** task.request.retries)
+
 celery_app = Celery(
     "tasks",
     broker=redis_url,
     backend=redis_url,
-    include=["app.tasks.transcription"],
+    include=["app.tasks.transcription", "app.tasks.media", "app.tasks.notifications"],
 )
 
+def cancel_running_task(job_id: str):
+    """
+    Revoke the task for a job (tasks are queued with the job id as their task id).
+    A queued task is discarded; a running one gets SIGUSR1, which Celery raises
+    inside it as SoftTimeLimitExceeded so the task unwinds and kills any ffmpeg child.
+    """
+    celery_app.control.revoke(job_id, terminate=True, signal="SIGUSR1")
+
+@worker_init.connect
+def check_ffmpeg(**kwargs):
+    """Fail worker startup when ffmpeg/ffprobe are missing instead of failing every job."""
+    from app.services.ffmpeg_service import check_available
+    logger.info(f"Using ffmpeg {check_available()}")
+
+@worker_init.connect
+def setup_temp_dirs(**kwargs):
+    """Write job files under TEMP_DIR."""
+    from app.core.temp_storage import configure_temp_dirs
+    configure_temp_dirs()
+
+@worker_init.connect
+def start_metrics_exporter(**kwargs):
+    """Serve Prometheus metrics for this worker on WORKER_METRICS_PORT, if set."""
+    port = os.getenv("WORKER_METRICS_PORT")
+    if not port:
+        return
+    from prometheus_client import start_http_server
+    from app.core.metrics import metrics_registry
+    start_http_server(int(port), registry=metrics_registry())
+    logger.info(f"Serving worker metrics on port {port}")
+
+@task_prerun.connect
+def record_task_start(task_id=None, **kwargs):
+    from app.core.metrics import record_task_start
+    record_task_start(task_id)
+
+@task_postrun.connect
+def record_task_end(task_id=None, **kwargs):
+    from app.core.metrics import record_task_end
+    record_task_end(task_id)
+
 celery_app.conf.update(
     task_track_started=True,
     task_time_limit=1800,  # 30 minutes hard timeout
     task_soft_time_limit=1500,  # 25 minutes soft timeout
     worker_prefetch_multiplier=1,  # Process one task at a time
     broker_connection_retry_on_startup=True,
+    task_default_priority=PRIORITY_NORMAL,
+    # Acknowledge tasks only once they finish, so a task whose worker dies is redelivered
+    task_acks_late=True,
+    task_reject_on_worker_lost=True,
+    broker_transport_options={
+        "priority_steps": list(range(10)),
+        "queue_order_strategy": "priority",
+        # Unacknowledged tasks are redelivered after this; longer than any job's time limit
+        "visibility_timeout": 7200,
+    },
 )
@@ -0,0 +1,138 @@
+import os
+import re
+import logging
+import tempfile
+from dataclasses import dataclass
+from typing import List, Optional
+from pathlib import Path
+from dotenv import load_dotenv
+
+logger = logging.getLogger(__name__)
+
+load_dotenv(override=True)
+
+def is_production() -> bool:
+    return os.environ.get("APP_ENV", "development").lower() == "production"
+
+@dataclass(frozen=True)
+class SupabaseSettings:
+    url: str
+    key: str
+
+def load_supabase_settings() -> SupabaseSettings:
+    """
+    Load the Supabase project to talk to. Both variables are required: without
+    them we refuse to start rather than fall back to some default project.
+    """
+    missing = [name for name in ("SUPABASE_URL", "SUPABASE_ANON_KEY") if not os.environ.get(name)]
+    if missing:
+        raise EnvironmentError(f"Missing required environment variables: {', '.join(missing)}")
+    
+    return SupabaseSettings(url=os.environ["SUPABASE_URL"], key=os.environ["SUPABASE_ANON_KEY"])
+
+@dataclass(frozen=True)
+class StorageSettings:
+    """Where videos live and how long the links we hand out stay valid."""
+    bucket_name: str
+    signed_url_ttl: int
+
+def load_storage_settings() -> StorageSettings:
+    """
+    Load storage settings from the environment. In production (APP_ENV=production)
+    the bucket must be configured explicitly rather than falling back to the default.
+    """
+    bucket_name = os.environ.get("R2_BUCKET_NAME")
+    if not bucket_name:
+        if is_production():
+            raise EnvironmentError("R2_BUCKET_NAME must be set when APP_ENV=production")
+        bucket_name = "videos"
+
+    try:
+        signed_url_ttl = int(os.environ.get("SIGNED_URL_TTL_SECONDS", 3600))
+    except ValueError:
+        raise EnvironmentError("SIGNED_URL_TTL_SECONDS must be an integer number of seconds")
+
+    return StorageSettings(
+        bucket_name=bucket_name,
+        signed_url_ttl=signed_url_ttl,
+    )
+
+@dataclass(frozen=True)
+class TempStorageSettings:
+    """Local scratch space for upload chunks and job files, and how much of the disk to keep free."""
+    upload_dir: Path
+    job_dir: str
+    min_free_bytes: int
+    ttl_seconds: int
+
+def load_temp_storage_settings() -> TempStorageSettings:
+    """
+    Load temp storage settings from the environment. TEMP_DIR is where jobs and
+    direct uploads write their temporary files (the system temp dir by default);
+    chunked uploads are staged under UPLOAD_TEMP_DIR.
+    """
+    try:
+        min_free_bytes = int(os.environ.get("MIN_FREE_DISK_MB", 1024)) * 1024 * 1024
+        ttl_seconds = int(float(os.environ.get("TEMP_FILE_TTL_HOURS", 24)) * 3600)
+    except ValueError:
+        raise EnvironmentError("MIN_FREE_DISK_MB and TEMP_FILE_TTL_HOURS must be numbers")
+
+    return TempStorageSettings(
+        upload_dir=Path(os.environ.get("UPLOAD_TEMP_DIR") or Path(__file__).parent.parent / "temp_uploads"),
+        job_dir=os.environ.get("TEMP_DIR") or tempfile.gettempdir(),
+        min_free_bytes=min_free_bytes,
+        ttl_seconds=ttl_seconds,
+    )
+
+@dataclass(frozen=True)
+class CorsSettings:
+    """Browser origins allowed to call the API. Patterns with * are matched through origin_regex."""
+    origins: List[str]
+    origin_regex: Optional[str]
+    methods: List[str]
+    headers: List[str]
+    allow_credentials: bool
+
+def _split_env_list(name: str, default: str) -> List[str]:
+    return [item.strip() for item in os.environ.get(name, default).split(",") if item.strip()]
+
+def load_cors_settings() -> CorsSettings:
+    """
+    Load CORS settings from comma-separated ALLOWED_ORIGINS, ALLOWED_METHODS and
+    ALLOWED_HEADERS. Browsers reject "Access-Control-Allow-Origin: *" on
+    credentialed requests, so with credentials on (the default) a bare "*"
+    origin is refused; list origins, or patterns like https://*.example.com,
+    whose matches are echoed back individually.
+    """
+    origins = _split_env_list("ALLOWED_ORIGINS", "http://localhost:3002")
+    allow_credentials = os.environ.get("CORS_ALLOW_CREDENTIALS", "true").lower() in ("1", "true", "yes")
+
+    if "*" in origins and allow_credentials:
+        raise EnvironmentError("ALLOWED_ORIGINS cannot be * while CORS_ALLOW_CREDENTIALS is on; list the origins instead")
+
+    exact, patterns = [], []
+    for origin in origins:
+        if origin != "*" and "*" in origin:
+            patterns.append(origin)
+            continue
+        if origin != "*" and not re.match(r"^https?://[^/]+$", origin):
+            raise EnvironmentError(f"Invalid origin in ALLOWED_ORIGINS: {origin} (expected scheme://host[:port])")
+        exact.append(origin)
+
+    # Each * in a pattern stands for one DNS label (or port), never a dot or slash
+    origin_regex = "|".join(
+        "^" + re.escape(pattern).replace(r"\*", r"[^./]+") + "$" for pattern in patterns
+    ) or None
+
+    return CorsSettings(
+        origins=exact,
+        origin_regex=origin_regex,
+        methods=_split_env_list("ALLOWED_METHODS", "*"),
+        headers=_split_env_list("ALLOWED_HEADERS", "*"),
+        allow_credentials=allow_credentials,
+    )
+
+supabase_settings = load_supabase_settings()
+storage_settings = load_storage_settings()
+temp_storage_settings = load_temp_storage_settings()
+cors_settings = load_cors_settings()
@@ -0,0 +1,106 @@
+import logging
+from fastapi import Request
+from fastapi.exceptions import RequestValidationError
+from fastapi.responses import JSONResponse
+from starlette.exceptions import HTTPException as StarletteHTTPException
+
+logger = logging.getLogger(__name__)
+
+# Every error response is a JSON object with a human-readable "detail" string.
+# Extra machine-readable fields (job_id, missingChunks, errors, ...) sit beside it.
+
+def error_body(detail, **extra) -> dict:
+    """
+    Build an error response body. A dict detail (as some handlers raise, e.g.
+    {"message": ..., "job_id": ...}) is flattened so "detail" is always its message.
+    """
+    if isinstance(detail, dict):
+        extra = {**{key: value for key, value in detail.items() if key != "message"}, **extra}
+        detail = detail.get("message", "Request failed")
+    return {"detail": detail, **extra}
+
+async def http_exception_handler(request: Request, exc: StarletteHTTPException) -> JSONResponse:
+    """Render HTTPExceptions in the standard error shape, keeping their headers (e.g. Retry-After)."""
+    return JSONResponse(
+        status_code=exc.status_code,
+        content=error_body(exc.detail),
+        headers=getattr(exc, "headers", None)
+    )
+
+async def unhandled_exception_handler(request: Request, exc: Exception) -> JSONResponse:
+    """Return 500 in the standard error shape instead of a plain-text page."""
+    logger.error(f"Unhandled error on {request.method} {request.url.path}: {str(exc)}", exc_info=exc)
+    return JSONResponse(status_code=500, content=error_body("Internal server error"))
+
+# pydantic error types mapped to a short tag and the ctx key holding its parameter, if any
+VALIDATION_ERROR_TAGS = {
+    "missing": ("required", None),
+    "greater_than_equal": ("gte", "ge"),
+    "greater_than": ("gt", "gt"),
+    "less_than_equal": ("lte", "le"),
+    "less_than": ("lt", "lt"),
+    "string_too_short": ("min", "min_length"),
+    "string_too_long": ("max", "max_length"),
+    "too_short": ("min", "min_length"),
+    "too_long": ("max", "max_length"),
+    "uuid_parsing": ("uuid", None),
+    "uuid_type": ("uuid", None),
+    "int_parsing": ("int", None),
+    "int_type": ("int", None),
+    "float_parsing": ("number", None),
+    "float_type": ("number", None),
+    "bool_parsing": ("bool", None),
+    "literal_error": ("oneof", "expected"),
+    "enum": ("oneof", "expected"),
+    "json_invalid": ("json", None),
+}
+
+def validation_error_message(tag: str, param, fallback: str) -> str:
+    """A human-readable message for a validation tag."""
+    messages = {
+        "required": "This field is required",
+        "gte": f"Must be at least {param}",
+        "gt": f"Must be greater than {param}",
+        "lte": f"Must be at most {param}",
+        "lt": f"Must be less than {param}",
+        "min": f"Must have at least {param} characters or items",
+        "max": f"Must have at most {param} characters or items",
+        "uuid": "Must be a valid UUID",
+        "int": "Must be a whole number",
+        "number": "Must be a number",
+        "bool": "Must be true or false",
+        "oneof": f"Must be one of {param}",
+        "json": "Request body is not valid JSON",
+    }
+    return messages.get(tag, fallback)
+
+def format_validation_errors(errors: list) -> list:
+    """
+    Flatten pydantic errors to {field, tag, message, param} objects. field is the
+    dotted path within the body, query or path (e.g. "resolutions.0").
+    """
+    formatted = []
+    for error in errors:
+        location = [str(part) for part in error.get("loc", ())]
+        # Drop the leading "body"/"query"/"path" segment, which clients don't name fields by
+        field = ".".join(location[1:] if len(location) > 1 else location)
+        tag, param_key = VALIDATION_ERROR_TAGS.get(error.get("type"), (error.get("type", "invalid"), None))
+        param = (error.get("ctx") or {}).get(param_key) if param_key else None
+        if param is not None and not isinstance(param, (str, int, float, bool)):
+            param = str(param)
+
+        # Custom validators raise ValueError, whose message is already meant for users
+        fallback = error.get("msg", "Invalid value").removeprefix("Value error, ")
+        formatted.append({
+            "field": field,
+            "tag": tag,
+            "message": validation_error_message(tag, param, fallback),
+            "param": param,
+        })
+    return formatted
+
+async def validation_exception_handler(request: Request, exc: RequestValidationError) -> JSONResponse:
+    """Return request validation failures as 422 with field-level detail under "errors"."""
+    errors = format_validation_errors(exc.errors())
+    logger.info(f"Validation failed for {request.method} {request.url.path}: {errors}")
+    return JSONResponse(status_code=422, content=error_body("Request validation failed", errors=errors))
@@ -0,0 +1,30 @@
+import json
+import hashlib
+from fastapi import Request
+from fastapi.encoders import jsonable_encoder
+from fastapi.responses import JSONResponse, Response
+
+def compute_etag(content) -> str:
+    """A strong ETag for a JSON body, derived from its content so it changes whenever the body does."""
+    body = json.dumps(jsonable_encoder(content), sort_keys=True, separators=(",", ":"))
+    return f'"{hashlib.sha256(body.encode()).hexdigest()[:32]}"'
+
+def etag_matches(request: Request, etag: str) -> bool:
+    """Whether the request's If-None-Match lists etag (or is "*"). Weak validators compare equal, as for GET."""
+    header = request.headers.get("if-none-match")
+    if not header:
+        return False
+    candidates = [candidate.strip() for candidate in header.split(",")]
+    return "*" in candidates or etag in (candidate.removeprefix("W/") for candidate in candidates)
+
+def conditional_json(request: Request, content) -> Response:
+    """
+    Return content as JSON with an ETag, or an empty 304 when the client's
+    If-None-Match shows it already has this version. Clients revalidate on every
+    request (no-cache), so polling stays cheap without ever serving stale data.
+    """
+    etag = compute_etag(content)
+    headers = {"ETag": etag, "Cache-Control": "private, no-cache"}
+    if etag_matches(request, etag):
+        return Response(status_code=304, headers=headers)
+    return JSONResponse(content=jsonable_encoder(content), headers=headers)
@@ -0,0 +1,48 @@
+import asyncio
+import logging
+from app.core.celery_app import celery_app
+from app.services.supabase_client import supabase
+from app.services.r2_client import get_r2_client
+
+logger = logging.getLogger(__name__)
+
+# Seconds each dependency check may take before it counts as down
+READINESS_CHECK_TIMEOUT = 5
+
+def check_supabase():
+    supabase.table("projects").select("id").limit(1).execute()
+
+def check_storage():
+    client = get_r2_client()
+    if client is None:
+        raise Exception("R2 client is not initialized")
+    health = client.health_check()
+    if health["status"] != "healthy":
+        raise Exception(health.get("error", "R2 is unhealthy"))
+
+def check_task_queue():
+    with celery_app.connection_for_write() as connection:
+        connection.ensure_connection(max_retries=1)
+
+READINESS_CHECKS = {
+    "supabase": check_supabase,
+    "storage": check_storage,
+    "task_queue": check_task_queue,
+}
+
+async def run_check(name: str, check) -> dict:
+    loop = asyncio.get_event_loop()
+    try:
+        await asyncio.wait_for(loop.run_in_executor(None, check), timeout=READINESS_CHECK_TIMEOUT)
+        return {"status": "ok"}
+    except asyncio.TimeoutError:
+        logger.warning(f"Readiness check {name} timed out")
+        return {"status": "down", "error": f"timed out after {READINESS_CHECK_TIMEOUT}s"}
+    except Exception as e:
+        logger.warning(f"Readiness check {name} failed: {str(e)}")
+        return {"status": "down", "error": str(e)}
+
+async def check_readiness() -> dict:
+    """Run every dependency check concurrently and return a status map keyed by dependency."""
+    results = await asyncio.gather(*(run_check(name, check) for name, check in READINESS_CHECKS.items()))
+    return dict(zip(READINESS_CHECKS.keys(), results))
@@ -0,0 +1,92 @@
+import time
+import asyncio
+import logging
+from collections import OrderedDict
+from starlette.middleware.base import BaseHTTPMiddleware
+from starlette.requests import Request
+from starlette.responses import JSONResponse, Response
+from app.core.auth import request_identity
+from app.core.errors import error_body
+
+logger = logging.getLogger(__name__)
+
+IDEMPOTENCY_HEADER = "Idempotency-Key"
+
+class IdempotencyMiddleware(BaseHTTPMiddleware):
+    """
+    Replays the original response when a POST to one of the given paths is
+    retried by the same caller with the same Idempotency-Key header, so network
+    retries don't create duplicate projects. A retry that arrives while the
+    first request is still running gets 409. Only successful (2xx) responses are remembered;
+    keys live in memory for ttl_seconds, evicting the oldest beyond max_keys.
+    """
+
+    def __init__(self, app, paths: list, ttl_seconds: int = 24 * 3600, max_keys: int = 10000):
+        super().__init__(app)
+        self.paths = set(paths)
+        self.ttl_seconds = ttl_seconds
+        self.max_keys = max_keys
+        self._entries: "OrderedDict[str, dict]" = OrderedDict()
+        self._lock = asyncio.Lock()
+
+    def _purge_expired(self):
+        now = time.monotonic()
+        while self._entries:
+            oldest_key, oldest = next(iter(self._entries.items()))
+            if oldest["expires_at"] > now and len(self._entries) <= self.max_keys:
+                break
+            del self._entries[oldest_key]
+
+    async def dispatch(self, request: Request, call_next):
+        key = request.headers.get(IDEMPOTENCY_HEADER)
+        if request.method != "POST" or not key or request.url.path not in self.paths:
+            return await call_next(request)
+
+        # Keys are only unique per caller, so another caller reusing one must not see this response
+        cache_key = f"{request_identity(request)}:{request.url.path}:{key}"
+
+        async with self._lock:
+            self._purge_expired()
+            entry = self._entries.get(cache_key)
+
+            if entry is None:
+                self._entries[cache_key] = {"in_flight": True, "expires_at": time.monotonic() + self.ttl_seconds}
+            elif entry["in_flight"]:
+                return JSONResponse(
+                    status_code=409,
+                    content=error_body("A request with this Idempotency-Key is already in progress")
+                )
+            else:
+                logger.info(f"Replaying response for Idempotency-Key {key} on {request.url.path}")
+                return Response(
+                    content=entry["body"],
+                    status_code=entry["status_code"],
+                    headers={**entry["headers"], "Idempotent-Replayed": "true"}
+                )
+
+        try:
+            response = await call_next(request)
+            body = b"".join([chunk async for chunk in response.body_iterator])
+        except Exception:
+            async with self._lock:
+                self._entries.pop(cache_key, None)
+            raise
+
+        async with self._lock:
+            if 200 <= response.status_code < 300:
+                self._entries[cache_key] = {
+                    "in_flight": False,
+                    "status_code": response.status_code,
+                    "headers": {k: v for k, v in response.headers.items() if k.lower() != "content-length"},
+                    "body": body,
+                    "expires_at": time.monotonic() + self.ttl_seconds
+                }
+            else:
+                # Let the client retry failed requests with the same key
+                self._entries.pop(cache_key, None)
+
+        return Response(
+            content=body,
+            status_code=response.status_code,
+            headers={k: v for k, v in response.headers.items() if k.lower() != "content-length"}
+        )
@@ -0,0 +1,100 @@
+import os
+import time
+import logging
+from prometheus_client import CollectorRegistry, Counter, Histogram, REGISTRY, generate_latest, multiprocess
+from prometheus_client.core import GaugeMetricFamily
+from app.core.statuses import JobStatus
+
+logger = logging.getLogger(__name__)
+
+# Prometheus metrics for the API and the Celery workers. Celery's prefork pool
+# runs tasks in child processes, so workers need PROMETHEUS_MULTIPROC_DIR set
+# for job metrics recorded in those children to reach the exporter.
+
+HTTP_REQUEST_DURATION = Histogram(
+    "yovideo_http_request_duration_seconds",
+    "HTTP request duration by route template and status code",
+    ["method", "route", "status"],
+)
+
+UPLOAD_BYTES = Counter(
+    "yovideo_upload_bytes_total",
+    "Bytes of video received from clients",
+    ["kind"],  # "direct" or "chunked"
+)
+
+JOBS_PROCESSED = Counter(
+    "yovideo_jobs_processed_total",
+    "Processing job attempts that ran to an end, by job type and resulting status",
+    ["job_type", "status"],
+)
+
+JOB_DURATION = Histogram(
+    "yovideo_job_duration_seconds",
+    "Wall-clock duration of processing job attempts",
+    ["job_type"],
+    buckets=(1, 5, 15, 30, 60, 120, 300, 600, 1200, 1800, 3600, float("inf")),
+)
+
+class QueueDepthCollector:
+    """Reports queued (pending) jobs per type, read from processing_jobs on each scrape."""
+
+    def collect(self):
+        from app.services.supabase_client import supabase
+
+        gauge = GaugeMetricFamily("yovideo_jobs_queued", "Jobs waiting for a worker, by job type", labels=["job_type"])
+        try:
+            response = supabase.table("processing_jobs").select("job_type").eq("status", JobStatus.PENDING).execute()
+            counts = {}
+            for row in response.data or []:
+                counts[row["job_type"]] = counts.get(row["job_type"], 0) + 1
+            for job_type, count in counts.items():
+                gauge.add_metric([job_type], count)
+        except Exception as e:
+            logger.warning(f"Could not count queued jobs for metrics: {str(e)}")
+        yield gauge
+
+def metrics_registry() -> CollectorRegistry:
+    """The registry to export: aggregated across processes when PROMETHEUS_MULTIPROC_DIR is set."""
+    if os.environ.get("PROMETHEUS_MULTIPROC_DIR"):
+        registry = CollectorRegistry()
+        multiprocess.MultiProcessCollector(registry)
+        return registry
+    return REGISTRY
+
+def render_metrics() -> bytes:
+    """Metrics in the Prometheus text format, including the current queue depth."""
+    registry = metrics_registry()
+    queue_registry = CollectorRegistry()
+    queue_registry.register(QueueDepthCollector())
+    return generate_latest(registry) + generate_latest(queue_registry)
+
+# Start times of running tasks, keyed by task id (which is also the job id)
+_task_started = {}
+
+def record_task_start(task_id: str):
+    _task_started[task_id] = time.monotonic()
+
+def record_task_end(task_id: str):
+    """
+    Record a finished task attempt against its job. Tasks swallow job failures
+    and return normally, so the outcome is read back from the job record.
+    Tasks without a job (e.g. webhooks) are ignored.
+    """
+    started = _task_started.pop(task_id, None)
+    if started is None:
+        return
+
+    from app.services.supabase_client import supabase
+
+    try:
+        response = supabase.table("processing_jobs").select("job_type, status").eq("id", task_id).execute()
+    except Exception as e:
+        logger.warning(f"Could not record metrics for task {task_id}: {str(e)}")
+        return
+    if not response.data:
+        return
+
+    job = response.data[0]
+    JOBS_PROCESSED.labels(job["job_type"], job["status"]).inc()
+    JOB_DURATION.labels(job["job_type"]).observe(time.monotonic() - started)
@@ -0,0 +1,37 @@
+import threading
+from typing import Callable, Dict, Hashable
+
+class WeightedProgress:
+    """
+    Progress of a job made of several steps (e.g. whisper, then burning in
+    captions), each weighted by its share of the work. Steps report their own
+    0-1 fraction; the combined fraction goes to on_progress and never moves
+    backwards. Safe to report from several threads, such as whisper's output
+    reader and ffmpeg's progress pipe.
+    """
+
+    def __init__(self, weights: Dict[Hashable, float], on_progress: Callable[[float], None]):
+        total = sum(weights.values())
+        if not weights or total <= 0 or any(weight < 0 for weight in weights.values()):
+            raise ValueError(f"Invalid step weights: {weights}")
+        self.shares = {step: weight / total for step, weight in weights.items()}
+        self.on_progress = on_progress
+        self._fractions = {step: 0.0 for step in weights}
+        self._reported = 0.0
+        self._lock = threading.Lock()
+
+    def report(self, step: Hashable, fraction: float):
+        with self._lock:
+            self._fractions[step] = max(self._fractions[step], min(max(fraction, 0.0), 1.0))
+            overall = min(sum(self.shares[s] * f for s, f in self._fractions.items()), 1.0)
+            if overall <= self._reported:
+                return
+            self._reported = overall
+            # Reported under the lock so updates reach the database in order
+            self.on_progress(overall)
+
+    def step(self, step: Hashable) -> Callable[[float], None]:
+        """A progress callback for one step, e.g. to pass to an ffmpeg helper."""
+        if step not in self.shares:
+            raise KeyError(f"Unknown step: {step}")
+        return lambda fraction: self.report(step, fraction)
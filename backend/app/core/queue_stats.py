@@ -0,0 +1,97 @@
+import logging
+from datetime import datetime, timezone
+from app.core.celery_app import celery_app, ACTIVE_JOB_STATUSES
+from app.core.statuses import JobStatus
+from app.services.supabase_client import supabase
+
+logger = logging.getLogger(__name__)
+
+# Seconds to wait for workers to answer an inspect broadcast
+INSPECT_TIMEOUT = 2.0
+
+def parse_timestamp(value: str) -> datetime:
+    return datetime.fromisoformat(value.replace("Z", "+00:00"))
+
+def job_counts(now: datetime) -> dict:
+    """Queued and in-flight jobs by type, and how long the oldest queued job has waited."""
+    response = (
+        supabase.table("processing_jobs")
+        .select("job_type, status, created_at")
+        .in_("status", ACTIVE_JOB_STATUSES)
+        .execute()
+    )
+    
+    queued_by_type, in_flight_by_type = {}, {}
+    oldest_queued = None
+    for job in response.data or []:
+        # Retrying jobs are back in the queue, waiting out their backoff
+        if job["status"] == JobStatus.PROCESSING:
+            in_flight_by_type[job["job_type"]] = in_flight_by_type.get(job["job_type"], 0) + 1
+            continue
+        queued_by_type[job["job_type"]] = queued_by_type.get(job["job_type"], 0) + 1
+        created_at = parse_timestamp(job["created_at"])
+        if oldest_queued is None or created_at < oldest_queued:
+            oldest_queued = created_at
+    
+    return {
+        "queue": {
+            "total": sum(queued_by_type.values()),
+            "byType": queued_by_type,
+            "oldestQueuedAt": oldest_queued.isoformat() if oldest_queued else None,
+            "oldestQueuedAgeSeconds": round((now - oldest_queued).total_seconds(), 1) if oldest_queued else None,
+        },
+        "inFlight": {
+            "total": sum(in_flight_by_type.values()),
+            "byType": in_flight_by_type,
+        },
+    }
+
+def worker_utilization() -> dict:
+    """Busy and idle pool slots across the Celery workers that answered in time."""
+    inspector = celery_app.control.inspect(timeout=INSPECT_TIMEOUT)
+    stats = inspector.stats() or {}
+    active = inspector.active() or {}
+    
+    nodes = []
+    for name, node_stats in sorted(stats.items()):
+        concurrency = node_stats.get("pool", {}).get("max-concurrency", 0)
+        busy = len(active.get(name, []))
+        nodes.append({"name": name, "concurrency": concurrency, "busy": busy, "idle": max(concurrency - busy, 0)})
+    
+    return {
+        "total": sum(node["concurrency"] for node in nodes),
+        "busy": sum(node["busy"] for node in nodes),
+        "idle": sum(node["idle"] for node in nodes),
+        "nodes": nodes,
+    }
+
+def queue_stats() -> dict:
+    """Snapshot of processing load for deciding when to scale workers."""
+    now = datetime.now(timezone.utc)
+    try:
+        workers = worker_utilization()
+    except Exception as e:
+        logger.warning(f"Could not inspect Celery workers: {str(e)}")
+        workers = {"error": str(e)}
+    
+    return {"timestamp": now.isoformat(), **job_counts(now), "workers": workers}
+
+def resize_worker_pools(concurrency: int, worker: str = None) -> list:
+    """
+    Grow or shrink each worker's pool (or just the named worker's) to concurrency
+    processes, without restarting it. Shrinking retires processes only after
+    their current task finishes, so in-flight jobs aren't dropped.
+    Returns the change made per worker.
+    """
+    stats = celery_app.control.inspect(timeout=INSPECT_TIMEOUT, destination=[worker] if worker else None).stats() or {}
+    
+    changes = []
+    for name, node_stats in sorted(stats.items()):
+        current = node_stats.get("pool", {}).get("max-concurrency", 0)
+        if concurrency > current:
+            celery_app.control.pool_grow(concurrency - current, destination=[name])
+        elif concurrency < current:
+            celery_app.control.pool_shrink(current - concurrency, destination=[name])
+        changes.append({"name": name, "from": current, "to": concurrency})
+        logger.info(f"Resized worker {name} pool from {current} to {concurrency}")
+    return changes
@@ -0,0 +1,112 @@
+import os
+import re
+import time
+import math
+import asyncio
+import logging
+from starlette.middleware.base import BaseHTTPMiddleware
+from starlette.requests import Request
+from starlette.responses import JSONResponse
+from app.core.auth import request_identity
+from app.core.errors import error_body
+
+logger = logging.getLogger(__name__)
+
+# Endpoints that start uploads or queue processing work get the tighter limit
+EXPENSIVE_ROUTES = [
+    ("POST", re.compile(r"^/api/v1/upload(/init)?$")),
+    ("POST", re.compile(r"^/api/v1/transcribe$")),
+    ("POST", re.compile(r"^/api/v1/projects/[^/]+/(thumbnail|transcode|hls|watermark|gif|speed|loudness|rotate|reframe|trim-silence)$")),
+]
+
+def get_rate_limit(name: str, default: int) -> int:
+    """Read a requests-per-minute limit from the environment, e.g. RATE_LIMIT_PER_MINUTE."""
+    try:
+        return max(1, int(os.environ.get(name, default)))
+    except ValueError:
+        logger.warning(f"Ignoring invalid {name}, using {default}")
+        return default
+
+class TokenBucket:
+    def __init__(self, capacity: int, refill_per_second: float):
+        self.capacity = capacity
+        self.refill_per_second = refill_per_second
+        self.tokens = float(capacity)
+        self.updated_at = time.monotonic()
+
+    def _refill(self, now: float):
+        self.tokens = min(self.capacity, self.tokens + (now - self.updated_at) * self.refill_per_second)
+        self.updated_at = now
+
+    def take(self) -> float:
+        """Take a token, returning 0 on success or the seconds until one is available."""
+        now = time.monotonic()
+        self._refill(now)
+        if self.tokens >= 1:
+            self.tokens -= 1
+            return 0
+        return (1 - self.tokens) / self.refill_per_second
+
+    def is_full(self, now: float) -> bool:
+        return self.tokens + (now - self.updated_at) * self.refill_per_second >= self.capacity
+
+class RateLimitMiddleware(BaseHTTPMiddleware):
+    """
+    Token-bucket rate limiting keyed by the authenticated user id, falling
+    back to the client IP for anonymous or invalid tokens. Expensive routes
+    (uploads and processing jobs) draw from a separate, smaller bucket
+    than everything else. Buckets live in memory; ones that have refilled
+    completely are dropped every cleanup_interval seconds.
+    """
+
+    def __init__(self, app, requests_per_minute: int = None, expensive_per_minute: int = None,
+                 cleanup_interval: int = 60, exempt_paths: list = None):
+        super().__init__(app)
+        self.requests_per_minute = requests_per_minute or get_rate_limit("RATE_LIMIT_PER_MINUTE", 120)
+        self.expensive_per_minute = expensive_per_minute or get_rate_limit("RATE_LIMIT_EXPENSIVE_PER_MINUTE", 10)
+        self.cleanup_interval = cleanup_interval
+        self.exempt_paths = set(exempt_paths or [])
+        self._buckets: dict = {}
+        self._last_cleanup = time.monotonic()
+        self._lock = asyncio.Lock()
+
+    def _is_expensive(self, request: Request) -> bool:
+        return any(
+            request.method == method and pattern.match(request.url.path)
+            for method, pattern in EXPENSIVE_ROUTES
+        )
+
+    def _cleanup(self):
+        now = time.monotonic()
+        if now - self._last_cleanup < self.cleanup_interval:
+            return
+        self._last_cleanup = now
+        stale = [key for key, bucket in self._buckets.items() if bucket.is_full(now)]
+        for key in stale:
+            del self._buckets[key]
+
+    async def dispatch(self, request: Request, call_next):
+        if request.method == "OPTIONS" or request.url.path in self.exempt_paths:
+            return await call_next(request)
+
+        expensive = self._is_expensive(request)
+        limit = self.expensive_per_minute if expensive else self.requests_per_minute
+        bucket_key = f"{'expensive' if expensive else 'default'}:{request_identity(request)}"
+
+        async with self._lock:
+            self._cleanup()
+            bucket = self._buckets.get(bucket_key)
+            if bucket is None:
+                bucket = self._buckets[bucket_key] = TokenBucket(limit, limit / 60.0)
+            wait_seconds = bucket.take()
+
+        if wait_seconds > 0:
+            retry_after = max(1, math.ceil(wait_seconds))
+            logger.info(f"Rate limit exceeded for {bucket_key} on {request.method} {request.url.path}")
+            return JSONResponse(
+                status_code=429,
+                content=error_body("Too many requests, please slow down"),
+                headers={"Retry-After": str(retry_after)}
+            )
+
+        return await call_next(request)
@@ -0,0 +1,81 @@
+"""
+Content-addressed cache of rendered outputs. A render is identified by a hash
+of its source video and parameters, so a job repeating a render that already
+exists can point at the stored output instead of running ffmpeg again.
+
+Entries expire after RENDER_CACHE_TTL_HOURS and are removed lazily. Only the
+entry goes: the output file belongs to the job that rendered it and is deleted
+with its project.
+"""
+import os
+import json
+import hashlib
+import logging
+from datetime import datetime, timedelta, timezone
+from typing import Optional
+from app.services.supabase_client import supabase
+from app.services.r2_client import get_r2_client
+
+logger = logging.getLogger(__name__)
+
+RENDER_CACHE_TTL_SECONDS = int(os.getenv("RENDER_CACHE_TTL_HOURS", 168)) * 3600
+
+def render_cache_key(project_id: str, job_type: str, params: dict) -> Optional[str]:
+    """
+    Hash of the project's current source video (storage path and checksum), the
+    job type and its parameters. None if the project has no video yet.
+    """
+    response = supabase.table("projects").select("video_path, checksum").eq("id", project_id).execute()
+    if not response.data or not response.data[0].get("video_path"):
+        return None
+    
+    project = response.data[0]
+    identity = {
+        "source": project["video_path"],
+        "checksum": project.get("checksum"),
+        "job_type": job_type,
+        "params": params,
+    }
+    return hashlib.sha256(json.dumps(identity, sort_keys=True).encode()).hexdigest()
+
+def find_cached_render(key: Optional[str]) -> Optional[dict]:
+    """
+    The output_details of an unexpired render with this key whose files, listed
+    in its output_keys, are all still in storage.
+    """
+    if key is None:
+        return None
+    
+    now = datetime.now(timezone.utc).isoformat()
+    response = supabase.table("render_cache").select("output_details").eq("key", key).gt("expires_at", now).execute()
+    if not response.data:
+        return None
+    
+    output_details = response.data[0]["output_details"]
+    client = get_r2_client()
+    storage_keys = output_details.get("output_keys") or []
+    # An entry recording no files can't be checked, so it's treated like a missing one
+    if client is None or not storage_keys or not all(client.file_exists(storage_key) for storage_key in storage_keys):
+        logger.info(f"Dropping render cache entry {key}, its output is no longer stored")
+        supabase.table("render_cache").delete().eq("key", key).execute()
+        return None
+    
+    return output_details
+
+def cache_render(key: Optional[str], project_id: str, job_type: str, output_details: dict):
+    """Record a finished render for reuse, and remove expired entries while at it. Best-effort."""
+    if key is None:
+        return
+    
+    now = datetime.now(timezone.utc)
+    try:
+        supabase.table("render_cache").upsert({
+            "key": key,
+            "project_id": project_id,
+            "job_type": job_type,
+            "output_details": output_details,
+            "expires_at": (now + timedelta(seconds=RENDER_CACHE_TTL_SECONDS)).isoformat()
+        }).execute()
+        supabase.table("render_cache").delete().lt("expires_at", now.isoformat()).execute()
+    except Exception as e:
+        logger.warning(f"Could not cache render {key} for project {project_id}: {str(e)}")
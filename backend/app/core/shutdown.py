@@ -0,0 +1,53 @@
+import time
+import asyncio
+import logging
+import itertools
+
+logger = logging.getLogger(__name__)
+
+# Seconds between progress logs while waiting for requests to finish
+DRAIN_LOG_INTERVAL = 5
+
+# Requests currently being handled: id -> (method, path, start time)
+_active = {}
+_ids = itertools.count()
+
+class InFlightRequests:
+    """
+    Track the HTTP requests currently being handled, so shutdown can wait for
+    them (e.g. a large upload still streaming to R2) and report any it had to cut off.
+    """
+
+    def __init__(self, app):
+        self.app = app
+
+    async def __call__(self, scope, receive, send):
+        if scope["type"] != "http":
+            return await self.app(scope, receive, send)
+
+        request_id = next(_ids)
+        _active[request_id] = (scope["method"], scope["path"], time.monotonic())
+        try:
+            await self.app(scope, receive, send)
+        finally:
+            _active.pop(request_id, None)
+
+def describe_in_flight() -> str:
+    now = time.monotonic()
+    return ", ".join(f"{method} {path} ({now - started:.0f}s)" for method, path, started in list(_active.values()))
+
+async def drain_in_flight(timeout: float) -> bool:
+    """Wait up to timeout seconds for in-flight requests to finish, logging progress. Returns True if drained."""
+    deadline = time.monotonic() + timeout
+    next_log = 0.0
+    while _active:
+        now = time.monotonic()
+        if now >= deadline:
+            logger.warning(f"Shutting down with {len(_active)} requests still in flight: {describe_in_flight()}")
+            return False
+        if now >= next_log:
+            logger.info(f"Waiting for {len(_active)} in-flight requests to finish: {describe_in_flight()}")
+            next_log = now + DRAIN_LOG_INTERVAL
+        await asyncio.sleep(0.5)
+    logger.info("No requests in flight")
+    return True
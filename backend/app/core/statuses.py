@@ -0,0 +1,77 @@
+"""
+Statuses of projects and processing jobs, and the transitions allowed between them.
+
+Status updates are filtered to the statuses they may come from
+(`.in_("status", ...sources(new_status))`), so an update that would make an
+invalid transition, such as reviving a cancelled job, matches no row and
+changes nothing, even when two writers race.
+"""
+
+class ProjectStatus:
+    UPLOADING = "uploading"
+    UPLOADED = "uploaded"
+    UPLOAD_CORRUPT = "upload_corrupt"
+    UPLOAD_INVALID = "upload_invalid"  # The uploaded file is not a supported video
+    PROCESSING = "processing"  # Transcribing
+    ADDING_CAPTIONS = "adding_captions"
+    COMPLETED = "completed"
+    FAILED = "failed"
+
+class JobStatus:
+    PENDING = "pending"
+    PROCESSING = "processing"
+    RETRYING = "retrying"
+    COMPLETED = "completed"
+    FAILED = "failed"
+    CANCELLED = "cancelled"  # Stopped via the cancel endpoint, distinct from "failed"
+    QUEUE_FAILED = "queue_failed"  # The task queue rejected the job
+
+# Self-transitions are listed explicitly where a status may be written again,
+# e.g. a retried transcription reaching "processing" a second time
+PROJECT_TRANSITIONS = {
+    ProjectStatus.UPLOADING: {
+        ProjectStatus.UPLOADED, ProjectStatus.UPLOAD_CORRUPT, ProjectStatus.UPLOAD_INVALID, ProjectStatus.FAILED
+    },
+    # A client may complete a corrupt upload again after resending chunks
+    ProjectStatus.UPLOAD_CORRUPT: {ProjectStatus.UPLOAD_CORRUPT, ProjectStatus.UPLOADED, ProjectStatus.UPLOAD_INVALID},
+    ProjectStatus.UPLOAD_INVALID: set(),
+    ProjectStatus.UPLOADED: {ProjectStatus.UPLOADED, ProjectStatus.PROCESSING, ProjectStatus.FAILED},
+    # Videos without speech complete straight from processing; cancelling returns to uploaded
+    ProjectStatus.PROCESSING: {
+        ProjectStatus.PROCESSING, ProjectStatus.ADDING_CAPTIONS, ProjectStatus.COMPLETED,
+        ProjectStatus.FAILED, ProjectStatus.UPLOADED
+    },
+    ProjectStatus.ADDING_CAPTIONS: {
+        ProjectStatus.PROCESSING, ProjectStatus.COMPLETED, ProjectStatus.FAILED, ProjectStatus.UPLOADED
+    },
+    # Finished projects can be transcribed again
+    ProjectStatus.COMPLETED: {ProjectStatus.PROCESSING, ProjectStatus.FAILED, ProjectStatus.UPLOADED},
+    ProjectStatus.FAILED: {ProjectStatus.FAILED, ProjectStatus.PROCESSING, ProjectStatus.UPLOADED},
+}
+
+JOB_TRANSITIONS = {
+    JobStatus.PENDING: {JobStatus.PROCESSING, JobStatus.FAILED, JobStatus.CANCELLED, JobStatus.QUEUE_FAILED},
+    # processing -> processing is another worker reclaiming an abandoned job
+    JobStatus.PROCESSING: {
+        JobStatus.PROCESSING, JobStatus.RETRYING, JobStatus.COMPLETED, JobStatus.FAILED, JobStatus.CANCELLED
+    },
+    JobStatus.RETRYING: {JobStatus.PROCESSING, JobStatus.FAILED, JobStatus.CANCELLED},
+    JobStatus.COMPLETED: set(),
+    JobStatus.FAILED: set(),
+    JobStatus.CANCELLED: set(),
+    JobStatus.QUEUE_FAILED: set(),
+}
+
+def can_transition(transitions: dict, from_status: str, to_status: str) -> bool:
+    """Whether moving from from_status to to_status is allowed."""
+    return to_status in transitions.get(from_status, set())
+
+def transition_sources(transitions: dict, to_status: str) -> list:
+    """The statuses from which to_status may be set, for filtering status updates."""
+    return sorted(status for status in transitions if can_transition(transitions, status, to_status))
+
+def project_status_sources(to_status: str) -> list:
+    return transition_sources(PROJECT_TRANSITIONS, to_status)
+
+def job_status_sources(to_status: str) -> list:
+    return transition_sources(JOB_TRANSITIONS, to_status)
@@ -0,0 +1,97 @@
+import os
+import time
+import shutil
+import asyncio
+import logging
+import tempfile
+from app.core.config import temp_storage_settings
+
+logger = logging.getLogger(__name__)
+
+# How often the API sweeps orphaned upload directories
+JANITOR_INTERVAL_SECONDS = 3600
+
+class InsufficientStorageError(Exception):
+    """Raised when writing a file would leave less free disk than MIN_FREE_DISK_MB."""
+    user_message = "The server is low on disk space, please try again later"
+
+def configure_temp_dirs():
+    """Create the temp directories and point tempfile (used by every job and direct upload) at TEMP_DIR."""
+    os.makedirs(temp_storage_settings.job_dir, exist_ok=True)
+    temp_storage_settings.upload_dir.mkdir(parents=True, exist_ok=True)
+    tempfile.tempdir = temp_storage_settings.job_dir
+
+def ensure_free_space(path: str, needed_bytes: int, reserved_bytes: int = 0):
+    """
+    Raise InsufficientStorageError if writing needed_bytes more to the disk
+    holding path, on top of reserved_bytes already promised to other writers,
+    would leave less than the configured minimum free.
+    """
+    free = shutil.disk_usage(path).free
+    projected = free - reserved_bytes - max(needed_bytes, 0)
+    if projected < temp_storage_settings.min_free_bytes:
+        raise InsufficientStorageError(
+            f"Not enough disk space under {path}: {free} bytes free, {reserved_bytes} reserved, "
+            f"{needed_bytes} needed, {temp_storage_settings.min_free_bytes} must stay free"
+        )
+
+def _tree_stats(path: str) -> tuple:
+    """The newest mtime and total size of a file or of everything under a directory."""
+    stat = os.stat(path, follow_symlinks=False)
+    newest, total = stat.st_mtime, 0
+    if not os.path.isdir(path):
+        return newest, stat.st_size
+    for root, _dirs, files in os.walk(path):
+        newest = max(newest, os.stat(root).st_mtime)
+        for name in files:
+            try:
+                file_stat = os.stat(os.path.join(root, name), follow_symlinks=False)
+            except FileNotFoundError:
+                continue  # Removed while we walked
+            newest = max(newest, file_stat.st_mtime)
+            total += file_stat.st_size
+    return newest, total
+
+def sweep_orphaned_uploads(base_dir: str, older_than: float) -> tuple:
+    """
+    Remove upload directories under base_dir left behind by uploads that were
+    abandoned or interrupted by a crash. A directory counts as active, and is
+    kept, if anything in it was modified within older_than seconds, since a
+    resumed upload only touches the chunk it rewrites. Returns (removed, reclaimed bytes).
+    """
+    if not os.path.isdir(base_dir):
+        return 0, 0
+    
+    cutoff = time.time() - older_than
+    removed, reclaimed = 0, 0
+    for entry in os.scandir(base_dir):
+        try:
+            newest, size = _tree_stats(entry.path)
+            if newest >= cutoff:
+                continue
+            if entry.is_dir(follow_symlinks=False):
+                shutil.rmtree(entry.path)
+            else:
+                os.unlink(entry.path)
+            removed += 1
+            reclaimed += size
+        except OSError as e:
+            logger.warning(f"Could not remove orphaned upload {entry.path}: {str(e)}")
+    return removed, reclaimed
+
+async def run_janitor():
+    """
+    Remove upload directories abandoned for longer than TEMP_FILE_TTL_HOURS,
+    once at startup (to clear what a crash left behind) and then periodically.
+    """
+    loop = asyncio.get_event_loop()
+    while True:
+        try:
+            removed, reclaimed = await loop.run_in_executor(
+                None, sweep_orphaned_uploads, str(temp_storage_settings.upload_dir), temp_storage_settings.ttl_seconds
+            )
+            if removed:
+                logger.info(f"Removed {removed} orphaned upload directories, reclaiming {reclaimed / (1024 * 1024):.1f} MB")
+        except Exception as e:
+            logger.error(f"Orphaned upload sweep failed: {str(e)}")
+        await asyncio.sleep(JANITOR_INTERVAL_SECONDS)
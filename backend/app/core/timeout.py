@@ -0,0 +1,77 @@
+import re
+import json
+import asyncio
+import logging
+from app.core.errors import error_body
+
+logger = logging.getLogger(__name__)
+
+MINUTE = 60
+
+# Requests taking longer than this (seconds) are answered with 504 unless a route below allows more
+DEFAULT_REQUEST_TIMEOUT = 30
+
+# (method, path pattern, timeout in seconds, or None for no deadline) for routes expected to run long
+REQUEST_TIMEOUT_ROUTES = [
+    ("POST", re.compile(r"^/api/v1/upload$"), 60 * MINUTE),  # Matches the client's timeout for 2GB uploads
+    ("POST", re.compile(r"^/api/v1/upload/chunk$"), 5 * MINUTE),
+    ("POST", re.compile(r"^/api/v1/upload/complete$"), 30 * MINUTE),  # Merges chunks and uploads to R2
+    ("POST", re.compile(r"^/api/v1/projects/[^/]+/watermark$"), 2 * MINUTE),
+    ("GET", re.compile(r"^/api/v1/projects/[^/]+/(audio-tracks|metadata)$"), 2 * MINUTE),  # Probe the video in R2
+    ("GET", re.compile(r"^/api/v1/projects/[^/]+/scenes$"), 15 * MINUTE),  # Decodes the whole video when not cached
+    ("GET", re.compile(r"^/api/v1/projects/[^/]+/silences$"), 10 * MINUTE),  # Decodes the whole audio track
+    ("GET", re.compile(r"^/api/v1/jobs/[^/]+/events$"), None),  # Event streams end with their job
+]
+
+class TimeoutMiddleware:
+    """
+    Answer requests that run past the deadline for their route with 504 and
+    cancel the handler. Cancellation takes effect at the handler's next await,
+    so blocking calls already running in the threadpool (Supabase, R2) finish
+    in the background, but the handler makes no further calls after the deadline.
+    If the response had already started, the connection is closed instead.
+    """
+
+    def __init__(self, app, default_timeout: float = DEFAULT_REQUEST_TIMEOUT, routes: list = None):
+        self.app = app
+        self.default_timeout = default_timeout
+        self.routes = REQUEST_TIMEOUT_ROUTES if routes is None else routes
+
+    def _timeout_for(self, method: str, path: str):
+        for route_method, pattern, timeout in self.routes:
+            if method == route_method and pattern.match(path):
+                return timeout
+        return self.default_timeout
+
+    async def _send_timeout(self, send, timeout: float):
+        body = json.dumps(error_body(f"Request timed out after {timeout:g} seconds")).encode()
+        await send({
+            "type": "http.response.start",
+            "status": 504,
+            "headers": [(b"content-type", b"application/json"), (b"content-length", str(len(body)).encode())],
+        })
+        await send({"type": "http.response.body", "body": body})
+
+    async def __call__(self, scope, receive, send):
+        if scope["type"] != "http":
+            return await self.app(scope, receive, send)
+
+        timeout = self._timeout_for(scope["method"], scope["path"])
+        if timeout is None:
+            return await self.app(scope, receive, send)
+
+        response_started = False
+
+        async def tracked_send(message):
+            nonlocal response_started
+            if message["type"] == "http.response.start":
+                response_started = True
+            await send(message)
+
+        try:
+            await asyncio.wait_for(self.app(scope, receive, tracked_send), timeout)
+        except asyncio.TimeoutError:
+            logger.warning(f"{scope['method']} {scope['path']} timed out after {timeout:g}s")
+            if response_started:
+                raise
+            await self._send_timeout(send, timeout)
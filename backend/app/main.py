@@ -3,9 +3,28 @@ from fastapi.middleware.cors import CORSMiddleware
 from fastapi.middleware.httpsredirect import HTTPSRedirectMiddleware
 from fastapi.middleware.trustedhost import TrustedHostMiddleware
 from fastapi.middleware.gzip import GZipMiddleware
-from fastapi.responses import JSONResponse
+from fastapi.responses import JSONResponse, Response
+from fastapi.exceptions import RequestValidationError
+import os
 import time
+import asyncio
+import logging
 from app.api import endpoints
+from app.core.idempotency import IdempotencyMiddleware
+from app.core.rate_limit import RateLimitMiddleware
+from app.core.body_limit import BodyLimitMiddleware
+from app.core.timeout import TimeoutMiddleware
+from app.core.health import check_readiness
+from app.core.config import cors_settings
+from app.core.shutdown import InFlightRequests, drain_in_flight
+from starlette.exceptions import HTTPException as StarletteHTTPException
+from app.core.errors import validation_exception_handler, http_exception_handler, unhandled_exception_handler
+from app.services.ffmpeg_service import check_available
+from app.core.temp_storage import configure_temp_dirs, run_janitor
+from app.core.metrics import HTTP_REQUEST_DURATION, render_metrics
+from prometheus_client import CONTENT_TYPE_LATEST
+
+logger = logging.getLogger(__name__)
 
 app = FastAPI(
     title="VideoThingy AI Service",
@@ -17,8 +36,10 @@ app = FastAPI(
     openapi_url="/api/openapi.json"
 )
 
-# Increase the maximum upload size to 2GB
-app.state.max_upload_size = 2 * 1024 * 1024 * 1024  # 2GB in bytes
+# Every error is a JSON object with a "detail" message; invalid requests also list errors field by field
+app.add_exception_handler(RequestValidationError, validation_exception_handler)
+app.add_exception_handler(StarletteHTTPException, http_exception_handler)
+app.add_exception_handler(Exception, unhandled_exception_handler)
 
 # Add middleware for timing requests
 @app.middleware("http")
@@ -27,8 +48,29 @@ async def add_process_time_header(request: Request, call_next):
     response = await call_next(request)
     process_time = time.time() - start_time
     response.headers["X-Process-Time"] = str(process_time)
+    
+    # Label by route template (/projects/{project_id}) rather than raw path to keep cardinality bounded
+    route = request.scope.get("route")
+    HTTP_REQUEST_DURATION.labels(
+        request.method, route.path if route else "unmatched", str(response.status_code)
+    ).observe(process_time)
     return response
 
+# Replay responses for retried project-creating requests carrying an Idempotency-Key
+app.add_middleware(
+    IdempotencyMiddleware,
+    paths=["/api/v1/upload", "/api/v1/upload/init"],
+)
+
+# Throttle clients per user (or IP), with a tighter limit on upload and processing endpoints
+app.add_middleware(RateLimitMiddleware, exempt_paths=["/", "/health", "/ready", "/metrics"])
+
+# Cap request bodies at 1MB, except on the upload routes (2GB direct uploads, chunks, watermark images)
+app.add_middleware(BodyLimitMiddleware)
+
+# Answer handlers that hang with 504: 30 seconds for JSON endpoints, longer for uploads
+app.add_middleware(TimeoutMiddleware)
+
 # Add GZip compression for responses
 app.add_middleware(GZipMiddleware, minimum_size=1000)
 
@@ -38,24 +80,45 @@ app.add_middleware(
     allowed_hosts=["*"],  # In production, replace with your domain
 )
 
-# Add CORS middleware with more specific settings
+# Allow the frontend origins from ALLOWED_ORIGINS; each matching origin is echoed back individually
 app.add_middleware(
     CORSMiddleware,
-    allow_origins=["http://localhost:3002"],
-    allow_credentials=True,
-    allow_methods=["*"],
-    allow_headers=["*"],
+    allow_origins=cors_settings.origins,
+    allow_origin_regex=cors_settings.origin_regex,
+    allow_credentials=cors_settings.allow_credentials,
+    allow_methods=cors_settings.methods,
+    allow_headers=cors_settings.headers,
+    expose_headers=["ETag"],  # Lets polling clients send If-None-Match themselves
     max_age=600,  # 10 minutes
 )
 
-# Configure CORS
-app.add_middleware(
-    CORSMiddleware,
-    allow_origins=["http://localhost:3002"],  # Frontend URL
-    allow_credentials=True,
-    allow_methods=["*"],
-    allow_headers=["*"],
-)
+# Outermost, so it sees every request until the response is fully sent
+app.add_middleware(InFlightRequests)
+
+# Seconds shutdown waits for in-flight requests (e.g. uploads) to finish before they are cut off
+SHUTDOWN_TIMEOUT_SECONDS = int(os.getenv("SHUTDOWN_TIMEOUT_SECONDS", 60))
+
+@app.on_event("startup")
+async def check_ffmpeg():
+    """Refuse to start without ffmpeg/ffprobe, which uploads and every processing job rely on."""
+    app.state.ffmpeg_version = check_available()
+
+@app.on_event("startup")
+async def start_temp_janitor():
+    """Set up the temp directories and start sweeping uploads abandoned past TEMP_FILE_TTL_HOURS."""
+    configure_temp_dirs()
+    app.state.temp_janitor = asyncio.create_task(run_janitor())
+
+@app.on_event("shutdown")
+async def drain_requests():
+    """
+    Stop background work and give in-flight requests up to SHUTDOWN_TIMEOUT_SECONDS
+    to finish. Uvicorn already waits for open connections before this runs when
+    started with --timeout-graceful-shutdown; this also covers servers that don't.
+    """
+    logger.info("Shutting down")
+    app.state.temp_janitor.cancel()
+    await drain_in_flight(SHUTDOWN_TIMEOUT_SECONDS)
 
 # Include the API router
 app.include_router(endpoints.router, prefix="/api/v1", tags=["Transcription"])
@@ -66,4 +129,22 @@ async def root():
 
 @app.get("/health")
 async def health_check():
-    return {"status": "ok"}
+    """Liveness: the process is up and serving requests."""
+    return {"status": "ok", "ffmpeg_version": app.state.ffmpeg_version}
+
+@app.get("/ready")
+async def readiness_check():
+    """Readiness: Supabase, R2 and the task queue are reachable. 503 with per-dependency status otherwise."""
+    dependencies = await check_readiness()
+    ready = all(result["status"] == "ok" for result in dependencies.values())
+    return JSONResponse(
+        status_code=200 if ready else 503,
+        content={"status": "ready" if ready else "not_ready", "dependencies": dependencies}
+    )
+
+@app.get("/metrics")
+async def metrics():
+    """Prometheus metrics for the API: request latency, upload volume and queued jobs. Workers export job outcomes."""
+    loop = asyncio.get_event_loop()
+    body = await loop.run_in_executor(None, render_metrics)
+    return Response(content=body, media_type=CONTENT_TYPE_LATEST)
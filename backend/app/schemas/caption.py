@@ -1,4 +1,5 @@
-from pydantic import BaseModel
+import re
+from pydantic import BaseModel, Field, field_validator
 from .transcription import TranscriptSegment
 
 class CaptionFormatRequest(BaseModel):
@@ -8,3 +9,31 @@ class CaptionFormatRequest(BaseModel):
 
 class CaptionFormatResponse(BaseModel):
     srt_content: str
+
+# ASS colours are &HBBGGRR or &HAABBGGRR, optionally terminated with &
+ASS_COLOUR_PATTERN = re.compile(r"^&H([0-9A-Fa-f]{6}|[0-9A-Fa-f]{8})&?$")
+
+class CaptionStyle(BaseModel):
+    font_name: str = "Arial Black"
+    font_size: int = Field(72, gt=0, le=300)
+    primary_colour: str = "&Hffffff"
+    outline_colour: str = "&H0"
+    alignment: int = Field(2, ge=1, le=9)  # Numpad layout, 2 = bottom centre
+    margin_v: int = Field(200, ge=0, le=1920)
+
+    @field_validator("font_name")
+    @classmethod
+    def validate_font_name(cls, value: str) -> str:
+        value = value.strip()
+        # Commas separate fields in an ASS Style line
+        if not value or "," in value:
+            raise ValueError("font_name must be non-empty and must not contain commas")
+        return value
+
+    @field_validator("primary_colour", "outline_colour")
+    @classmethod
+    def validate_colour(cls, value: str) -> str:
+        # The default outline colour &H0 is accepted as shorthand for black
+        if value != "&H0" and not ASS_COLOUR_PATTERN.match(value):
+            raise ValueError("colour must be an ASS hex colour such as &H00FFFFFF&")
+        return value
@@ -0,0 +1,30 @@
+from typing import Optional
+from pydantic import BaseModel
+
+class VideoStreamMetadata(BaseModel):
+    codec: Optional[str] = None
+    width: Optional[int] = None
+    height: Optional[int] = None
+    # Dimensions as displayed, after the stream's rotation
+    display_width: Optional[int] = None
+    display_height: Optional[int] = None
+    frame_rate: Optional[float] = None
+    rotation: int = 0
+    hdr: bool = False
+
+class AudioTrackMetadata(BaseModel):
+    index: int  # Position among audio tracks, as accepted by /transcribe's audio_track
+    stream_index: int
+    codec: Optional[str] = None
+    channels: Optional[int] = None
+    language: Optional[str] = None
+    title: Optional[str] = None
+
+class VideoMetadataResponse(BaseModel):
+    project_id: str
+    duration: Optional[float] = None  # Seconds
+    size: Optional[int] = None  # Bytes
+    bit_rate: Optional[int] = None  # Bits per second
+    format: Optional[str] = None
+    video: Optional[VideoStreamMetadata] = None
+    audio_tracks: list[AudioTrackMetadata] = []
@@ -1,5 +1,29 @@
+from typing import Optional
 from pydantic import BaseModel
 
+# Languages whisper can transcribe, as ISO 639-1 codes (valid BCP-47 primary language subtags)
+SUPPORTED_LANGUAGES = {
+    "af", "am", "ar", "as", "az", "ba", "be", "bg", "bn", "bo", "br", "bs", "ca", "cs", "cy", "da",
+    "de", "el", "en", "es", "et", "eu", "fa", "fi", "fo", "fr", "gl", "gu", "ha", "haw", "he", "hi",
+    "hr", "ht", "hu", "hy", "id", "is", "it", "ja", "jw", "ka", "kk", "km", "kn", "ko", "la", "lb",
+    "ln", "lo", "lt", "lv", "mg", "mi", "mk", "ml", "mn", "mr", "ms", "mt", "my", "ne", "nl", "nn",
+    "no", "oc", "pa", "pl", "ps", "pt", "ro", "ru", "sa", "sd", "si", "sk", "sl", "sn", "so", "sq",
+    "sr", "su", "sv", "sw", "ta", "te", "tg", "th", "tk", "tl", "tr", "tt", "uk", "ur", "uz", "vi",
+    "yi", "yo", "zh", "yue",
+}
+
+def normalize_language(code: Optional[str]) -> Optional[str]:
+    """
+    Reduce a BCP-47 tag such as "en-US" or "pt_BR" to the primary language
+    whisper understands, raising ValueError for unsupported languages.
+    """
+    if code is None or not code.strip():
+        return None
+    primary = code.strip().replace("_", "-").split("-")[0].lower()
+    if primary not in SUPPORTED_LANGUAGES:
+        raise ValueError(f"Unsupported language: {code}")
+    return primary
+
 class TranscriptionRequest(BaseModel):
     project_id: str
 
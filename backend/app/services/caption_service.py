@@ -6,14 +6,47 @@ def format_srt_time(seconds: float) -> str:
     hh, mm = divmod(mm, 60)
     return f"{hh:02d}:{mm:02d}:{ss:02d},{millis:03d}"
 
+def parse_srt_time(timestamp: str) -> float:
+    """Converts an SRT HH:MM:SS,mmm timestamp to seconds."""
+    hours, minutes, seconds = timestamp.strip().replace('.', ',').split(':')
+    seconds, millis = seconds.split(',')
+    return int(hours) * 3600 + int(minutes) * 60 + int(seconds) + int(millis) / 1000
+
+def parse_srt(srt_content: str) -> list:
+    """Parses SRT cues into whisper-style segments ({start, end, text})."""
+    segments = []
+    for block in srt_content.replace('\r\n', '\n').strip().split('\n\n'):
+        lines = [line for line in block.strip().split('\n') if line.strip()]
+        timing_index = next((i for i, line in enumerate(lines) if '-->' in line), None)
+        if timing_index is None:
+            continue
+        start, end = lines[timing_index].split('-->')
+        segments.append({
+            'start': parse_srt_time(start),
+            'end': parse_srt_time(end.split()[0]),  # Ignore position hints after the end time
+            'text': ' '.join(lines[timing_index + 1:]),
+        })
+    return segments
+
+def segment_words(segment: dict) -> list:
+    """Word timings of a segment (whisper --word_timestamps), or [] when it has none."""
+    words = []
+    for word in segment.get('words') or []:
+        text = str(word.get('word', '')).strip()
+        if text and word.get('start') is not None and word.get('end') is not None:
+            words.append({'word': text, 'start': float(word['start']), 'end': float(word['end'])})
+    return words
+
 def segments_to_srt(segments: list) -> str:
-    """Converts whisper segments to SRT format."""
+    """Converts whisper segments to SRT format, prefixing speaker labels when present."""
     srt_content = ""
     
     for i, segment in enumerate(segments, 1):
         start_time = format_srt_time(segment['start'])
         end_time = format_srt_time(segment['end'])
         text = segment['text'].strip()
+        if segment.get('speaker'):
+            text = f"{segment['speaker']}: {text}"
         
         # Break text into lines if it's too long
         lines = break_text_into_lines(text, max_chars=50, max_lines=2)
@@ -23,9 +56,68 @@ def segments_to_srt(segments: list) -> str:
     
     return srt_content.strip()
 
-def segments_to_ass(segments: list) -> str:
+def build_ass_style(style: dict = None) -> str:
+    """Builds the Default ASS Style line, overriding font, colours and placement from a CaptionStyle dict."""
+    style = style or {}
+    font_name = style.get("font_name", "Arial Black")
+    font_size = style.get("font_size", 72)
+    primary_colour = style.get("primary_colour", "&Hffffff")
+    outline_colour = style.get("outline_colour", "&H0")
+    alignment = style.get("alignment", 2)
+    margin_v = style.get("margin_v", 200)
+    
+    return (
+        f"Style: Default,{font_name},{font_size},{primary_colour},&Hffffff,{outline_colour},&Hf0ffffff,"
+        f"1,0,0,0,100,100,0,0,3,0,2,{alignment},80,80,{margin_v},1"
+    )
+
+def format_vtt_time(seconds: float) -> str:
+    """Converts seconds to WebVTT time format HH:MM:SS.mmm."""
+    return format_srt_time(seconds).replace(',', '.')
+
+def vtt_karaoke_lines(words: list, max_chars: int = 50, max_lines: int = 2) -> list[str]:
+    """Lay out timed words as cue lines, tagging each word after the first with its <HH:MM:SS.mmm> start."""
+    lines = break_text_into_lines(' '.join(w['word'] for w in words), max_chars=max_chars, max_lines=max_lines)
+    
+    tagged_lines = []
+    word_index = 0
+    for line in lines:
+        tagged = []
+        for _ in line.split():
+            word = words[word_index]
+            tagged.append(word['word'] if word_index == 0 else f"<{format_vtt_time(word['start'])}>{word['word']}")
+            word_index += 1
+        tagged_lines.append(' '.join(tagged))
+    return tagged_lines
+
+def segments_to_vtt(segments: list, language: str = None) -> str:
+    """
+    Converts whisper segments to WebVTT format, noting the language in the header when known.
+    Word timings become inline timestamps (karaoke-style highlighting) and speakers become <v> voice spans.
+    """
+    vtt_content = f"WEBVTT\nLanguage: {language}\n\n" if language else "WEBVTT\n\n"
+    
+    for i, segment in enumerate(segments, 1):
+        start_time = format_vtt_time(segment['start'])
+        end_time = format_vtt_time(segment['end'])
+        text = segment['text'].strip()
+        
+        words = segment_words(segment)
+        if words:
+            lines = vtt_karaoke_lines(words)
+        else:
+            lines = break_text_into_lines(text, max_chars=50, max_lines=2)
+        if segment.get('speaker') and lines:
+            lines[0] = f"<v {segment['speaker']}>{lines[0]}"
+        text_formatted = '\n'.join(lines)
+        
+        vtt_content += f"{i}\n{start_time} --> {end_time}\n{text_formatted}\n\n"
+    
+    return vtt_content.strip() + "\n"
+
+def segments_to_ass(segments: list, style: dict = None) -> str:
     """Converts whisper segments to ASS format with word-by-word timing synchronized to audio."""
-    ass_header = """[Script Info]
+    ass_header = f"""[Script Info]
 Title: TikTok-Style Video Captions
 ScriptType: v4.00+
 PlayResX: 1080
@@ -33,7 +125,7 @@ PlayResY: 1920
 
 [V4+ Styles]
 Format: Name, Fontname, Fontsize, PrimaryColour, SecondaryColour, OutlineColour, BackColour, Bold, Italic, Underline, StrikeOut, ScaleX, ScaleY, Spacing, Angle, BorderStyle, Outline, Shadow, Alignment, MarginL, MarginR, MarginV, Encoding
-Style: Default,Arial Black,72,&Hffffff,&Hffffff,&H0,&Hf0ffffff,1,0,0,0,100,100,0,0,3,0,2,2,80,80,200,1
+{build_ass_style(style)}
 
 [Events]
 Format: Layer, Start, End, Style, Name, MarginL, MarginR, MarginV, Effect, Text
@@ -54,17 +146,29 @@ Format: Layer, Start, End, Style, Name, MarginL, MarginR, MarginV, Effect, Text
         words = segment_text.split()
         if not words:
             continue
-            
-        # Calculate timing per word within the segment
-        segment_duration = segment_end - segment_start
-        time_per_word = segment_duration / len(words)
         
-        # Build karaoke timing string for word-by-word reveal
-        karaoke_text = ""
-        for word in words:
-            # Convert to centiseconds for ASS karaoke timing
-            word_duration_cs = int(time_per_word * 100)
-            karaoke_text += f"{{\\k{word_duration_cs}}}{word} "
+        timed_words = segment_words(segment)
+        if timed_words:
+            # Real word timings: each word lasts until the next one starts, after any leading silence
+            karaoke_text = ""
+            lead_in_cs = int((timed_words[0]['start'] - segment_start) * 100)
+            if lead_in_cs > 0:
+                karaoke_text += f"{{\\k{lead_in_cs}}}"
+            for i, word in enumerate(timed_words):
+                word_end = timed_words[i + 1]['start'] if i + 1 < len(timed_words) else word['end']
+                word_duration_cs = max(int((word_end - word['start']) * 100), 1)
+                karaoke_text += f"{{\\k{word_duration_cs}}}{word['word']} "
+        else:
+            # Calculate timing per word within the segment
+            segment_duration = segment_end - segment_start
+            time_per_word = segment_duration / len(words)
+            
+            # Build karaoke timing string for word-by-word reveal
+            karaoke_text = ""
+            for word in words:
+                # Convert to centiseconds for ASS karaoke timing
+                word_duration_cs = int(time_per_word * 100)
+                karaoke_text += f"{{\\k{word_duration_cs}}}{word} "
         
         # Add TikTok-style pop animation to the karaoke text
         start_time = format_ass_time(segment_start)
@@ -73,7 +177,9 @@ Format: Layer, Start, End, Style, Name, MarginL, MarginR, MarginV, Effect, Text
         # Combine pop animation with karaoke timing
         animated_text = f"{{\\fade(255,0,0,255,0,100,100)\\t(0,150,\\fscx110\\fscy110)\\t(150,300,\\fscx100\\fscy100)}}{karaoke_text.strip()}"
         
-        ass_content += f"Dialogue: 0,{start_time},{end_time},Default,,0,0,0,,{animated_text}\n"
+        # The Name field carries the speaker label when the transcript has one
+        speaker = str(segment.get('speaker') or '').replace(',', ' ')
+        ass_content += f"Dialogue: 0,{start_time},{end_time},Default,{speaker},0,0,0,,{animated_text}\n"
     
     return ass_content
 
@@ -0,0 +1,1290 @@
+import os
+import re
+import json
+import logging
+import subprocess
+import tempfile
+import threading
+import time
+from functools import lru_cache
+from dataclasses import dataclass, field
+from typing import Callable, List, Optional
+from app.core.progress import WeightedProgress
+
+logger = logging.getLogger(__name__)
+
+class FFmpegError(Exception):
+    """
+    An ffmpeg/ffprobe failure. str() keeps the raw detail for logs while
+    user_message is safe to show to users. Subclasses marked not retryable
+    describe problems with the input that another attempt won't fix.
+    """
+    user_message = "Video processing failed"
+    retryable = True
+
+    def __init__(self, detail: str, user_message: str = None):
+        super().__init__(detail)
+        if user_message:
+            self.user_message = user_message
+
+class InputNotFoundError(FFmpegError):
+    user_message = "The source video could not be found"
+    retryable = False
+
+class UnsupportedCodecError(FFmpegError):
+    user_message = "The video uses a format or codec that is not supported"
+    retryable = False
+
+class NoAudioStreamError(FFmpegError):
+    """Raised when an operation needs an audio stream the input doesn't have."""
+    user_message = "The video has no audio track"
+    retryable = False
+
+class EmptyOutputError(FFmpegError):
+    """Raised when ffmpeg exits cleanly but leaves a missing, header-only or streamless output."""
+    user_message = "Video processing produced no output"
+
+class FFmpegUnavailableError(FFmpegError):
+    """Raised when the ffmpeg or ffprobe binary can't be found or run."""
+    user_message = "Video processing is currently unavailable"
+    retryable = False
+
+class MissingCapabilityError(FFmpegError):
+    """Raised when the installed ffmpeg build lacks an encoder or filter we need."""
+    user_message = "Video processing is not supported by this server's ffmpeg build"
+    retryable = False
+
+class AlreadyVerticalError(FFmpegError):
+    """Raised when asked to reframe a video for vertical playback that is already portrait."""
+    user_message = "The video is already vertical"
+    retryable = False
+
+# stderr fragments mapped to the typed error they indicate
+FFMPEG_ERROR_PATTERNS = [
+    ("No such file or directory", InputNotFoundError),
+    ("Invalid data found when processing input", UnsupportedCodecError),
+    ("Unknown encoder", UnsupportedCodecError),
+    ("Decoder not found", UnsupportedCodecError),
+    ("could not find codec parameters", UnsupportedCodecError),
+    ("does not contain any stream", NoAudioStreamError),
+]
+
+def classify_ffmpeg_error(program: str, stderr: str) -> FFmpegError:
+    """Turn ffmpeg stderr into a typed error with a user-friendly message."""
+    detail = f"{program} failed: {stderr}"
+    for fragment, error_class in FFMPEG_ERROR_PATTERNS:
+        if fragment.lower() in stderr.lower():
+            return error_class(detail)
+    return FFmpegError(detail)
+
+def escape_filter_path(path: str, base_dir: str = None) -> str:
+    """
+    Escape a file path for use as an option value inside a -vf/-filter_complex
+    string (e.g. ass=<path>), so quotes, colons, commas and brackets in it can't
+    break the filtergraph or inject extra filter options. The path must resolve
+    inside base_dir, which defaults to the temp directory our jobs work in.
+    """
+    base_dir = os.path.realpath(base_dir or tempfile.gettempdir())
+    resolved = os.path.realpath(path)
+    if os.path.commonpath([base_dir, resolved]) != base_dir:
+        raise ValueError(f"Refusing to pass {path} to ffmpeg: outside {base_dir}")
+    
+    # First the option value level, then the filtergraph level, as ffmpeg unescapes both in turn
+    escaped = resolved
+    for level_specials in ("\\':", "\\'[],;"):
+        escaped = ''.join('\\' + char if char in level_specials else char for char in escaped)
+    return escaped
+
+def run_ffmpeg(cmd: list, timeout: int = 600) -> subprocess.CompletedProcess:
+    """Run an ffmpeg/ffprobe command, raising with stderr on failure."""
+    logger.info(f"Running FFmpeg command: {' '.join(cmd)}")
+    result = subprocess.run(cmd, capture_output=True, text=True, timeout=timeout)
+    
+    if result.returncode != 0:
+        logger.error(f"{cmd[0]} failed with return code {result.returncode}: {result.stderr}")
+        raise classify_ffmpeg_error(cmd[0], result.stderr)
+    
+    return result
+
+def run_ffmpeg_with_progress(cmd: list, duration: float, on_progress: Optional[Callable[[float], None]] = None,
+                             min_interval: float = 1.0, timeout: Optional[float] = None) -> str:
+    """
+    Run an ffmpeg command with `-progress pipe:1`, reporting completion as a fraction
+    in [0, 1] via on_progress at most once per min_interval seconds.
+    The process is killed if it runs longer than timeout seconds.
+    Returns the captured stderr.
+    """
+    cmd = [cmd[0], '-progress', 'pipe:1', '-nostats'] + cmd[1:]
+    logger.info(f"Running FFmpeg command: {' '.join(cmd)}")
+    
+    process = subprocess.Popen(
+        cmd,
+        stdout=subprocess.PIPE,
+        stderr=subprocess.PIPE,
+        text=True,
+        universal_newlines=True
+    )
+    
+    # Drain stderr in the background so a chatty ffmpeg can't block on a full pipe
+    stderr_lines = []
+    stderr_thread = threading.Thread(target=lambda: stderr_lines.extend(process.stderr), daemon=True)
+    stderr_thread.start()
+    
+    timed_out = threading.Event()
+    
+    def kill_on_timeout():
+        timed_out.set()
+        process.kill()
+    
+    timer = threading.Timer(timeout, kill_on_timeout) if timeout else None
+    if timer:
+        timer.start()
+    
+    try:
+        last_reported = 0.0
+        for line in process.stdout:
+            key, _, value = line.strip().partition('=')
+            
+            if key == 'progress' and value == 'end':
+                if on_progress:
+                    on_progress(1.0)
+                continue
+            
+            # Despite its name, out_time_ms is reported in microseconds, same as out_time_us
+            if key not in ('out_time_us', 'out_time_ms') or duration <= 0 or not on_progress:
+                continue
+            
+            try:
+                fraction = min(max(int(value) / 1_000_000 / duration, 0.0), 1.0)
+            except ValueError:
+                continue  # "N/A" before the first frame is encoded
+            
+            now = time.monotonic()
+            if now - last_reported >= min_interval:
+                last_reported = now
+                on_progress(fraction)
+        
+        process.wait()
+    except BaseException:
+        # Don't leave ffmpeg running if the task is interrupted (e.g. by a Celery time limit)
+        process.kill()
+        process.wait()
+        raise
+    finally:
+        if timer:
+            timer.cancel()
+    
+    stderr_thread.join()
+    stderr = ''.join(stderr_lines)
+    
+    if timed_out.is_set():
+        logger.error(f"FFmpeg killed after exceeding {timeout}s timeout")
+        raise TimeoutError(f"FFmpeg timed out after {timeout} seconds")
+    
+    if process.returncode != 0:
+        logger.error(f"FFmpeg failed with return code {process.returncode}: {stderr}")
+        raise classify_ffmpeg_error(cmd[0], stderr)
+    
+    return stderr
+
+# Anything smaller is a header-only file from an encode that silently produced nothing
+MIN_OUTPUT_BYTES = 1024
+
+def validate_output(output_path: str, min_size: int = MIN_OUTPUT_BYTES, probe: bool = True) -> int:
+    """
+    Check that ffmpeg actually wrote output_path: it exists, is at least min_size
+    bytes and (when probe is set) ffprobe finds a stream in it.
+    Returns the file size, raising EmptyOutputError otherwise.
+    """
+    if not os.path.exists(output_path):
+        raise EmptyOutputError(f"FFmpeg did not produce {output_path}")
+    
+    size = os.path.getsize(output_path)
+    if size < min_size:
+        raise EmptyOutputError(f"FFmpeg output {output_path} is only {size} bytes")
+    
+    if probe and not probe_video(output_path).get("streams"):
+        raise EmptyOutputError(f"FFmpeg output {output_path} contains no streams")
+    
+    return size
+
+def check_available() -> str:
+    """
+    Verify ffmpeg and ffprobe are on PATH and runnable, returning the ffmpeg
+    version (e.g. "6.1.1"). Raises FFmpegUnavailableError otherwise.
+    """
+    versions = {}
+    for program in ('ffmpeg', 'ffprobe'):
+        try:
+            result = subprocess.run([program, '-version'], capture_output=True, text=True, timeout=10)
+        except (OSError, subprocess.TimeoutExpired) as e:
+            raise FFmpegUnavailableError(f"{program} is not available: {str(e)}")
+        if result.returncode != 0:
+            raise FFmpegUnavailableError(f"{program} -version failed: {result.stderr}")
+        
+        # First line reads e.g. "ffmpeg version 6.1.1-3ubuntu5 Copyright (c) ..."
+        first_line = result.stdout.splitlines()[0] if result.stdout else ""
+        parts = first_line.split()
+        versions[program] = parts[2] if len(parts) > 2 and parts[1] == 'version' else "unknown"
+    
+    return versions['ffmpeg']
+
+def _list_components(kind: str) -> frozenset:
+    """Names from `ffmpeg -encoders` or `ffmpeg -filters`, one per listing line."""
+    result = run_ffmpeg(['ffmpeg', '-hide_banner', f'-{kind}'], timeout=10)
+    names = set()
+    for line in result.stdout.splitlines():
+        # Listing lines are " <flags> <name> <description>"; legend lines use "=" as the name
+        parts = line.split()
+        if len(parts) >= 2 and line.startswith(' ') and parts[1] != '=':
+            names.add(parts[1])
+    return frozenset(names)
+
+@lru_cache(maxsize=None)
+def ffmpeg_encoders() -> frozenset:
+    return _list_components('encoders')
+
+@lru_cache(maxsize=None)
+def ffmpeg_filters() -> frozenset:
+    return _list_components('filters')
+
+def require_capabilities(encoders: tuple = (), filters: tuple = ()):
+    """Raise MissingCapabilityError if the ffmpeg build lacks any of the given encoders or filters."""
+    missing = [f"encoder {name}" for name in encoders if name not in ffmpeg_encoders()]
+    missing += [f"filter {name}" for name in filters if name not in ffmpeg_filters()]
+    if missing:
+        raise MissingCapabilityError(f"ffmpeg build is missing: {', '.join(missing)}")
+
+def probe_video(input_path: str) -> dict:
+    """Return the raw ffprobe format/streams data for a media file."""
+    # Inputs may also be (signed) URLs, which ffprobe reads directly
+    if "://" not in input_path and not os.path.exists(input_path):
+        raise InputNotFoundError(f"Input file does not exist: {input_path}")
+    
+    ffprobe_cmd = [
+        'ffprobe', '-v', 'quiet',
+        '-print_format', 'json',
+        '-show_format', '-show_streams',
+        input_path
+    ]
+    result = run_ffmpeg(ffprobe_cmd, timeout=60)
+    return json.loads(result.stdout)
+
+def parse_frame_rate(rate: Optional[str]) -> Optional[float]:
+    """Parse ffprobe's fractional frame rates ("30000/1001", "25/1") into fps; None if unknown ("0/0")."""
+    if not rate:
+        return None
+    numerator, _, denominator = rate.partition('/')
+    try:
+        fps = float(numerator) / float(denominator or 1)
+    except (ValueError, ZeroDivisionError):
+        return None
+    return round(fps, 3) if fps > 0 else None
+
+# Transfer characteristics of HDR video: PQ (HDR10, Dolby Vision) and HLG (most phones)
+HDR_TRANSFERS = ("smpte2084", "arib-std-b67")
+
+def parse_rotation(stream: dict) -> int:
+    """
+    The clockwise display rotation of a stream (0, 90, 180 or 270), from the
+    legacy rotate tag or the display matrix side data newer ffmpeg reports.
+    """
+    rotate_tag = (stream.get("tags") or {}).get("rotate")
+    if rotate_tag is not None:
+        degrees = _optional_int(rotate_tag) or 0
+    else:
+        display_matrix = next(
+            (data for data in stream.get("side_data_list") or [] if data.get("side_data_type") == "Display Matrix"),
+            {}
+        )
+        # The display matrix states the counter-clockwise rotation
+        degrees = -int(display_matrix.get("rotation") or 0)
+    return round(degrees / 90) * 90 % 360
+
+def _optional_int(value) -> Optional[int]:
+    try:
+        return int(value)
+    except (TypeError, ValueError):
+        return None
+
+@dataclass
+class StreamInfo:
+    index: int
+    codec_type: str
+    codec_name: Optional[str] = None
+    width: Optional[int] = None
+    height: Optional[int] = None
+    frame_rate: Optional[float] = None
+    channels: Optional[int] = None
+    language: Optional[str] = None
+    title: Optional[str] = None
+    color_primaries: Optional[str] = None
+    color_transfer: Optional[str] = None
+    color_space: Optional[str] = None
+    rotation: int = 0  # Clockwise degrees players rotate the frames by when displaying them
+
+    @property
+    def display_width(self) -> Optional[int]:
+        return self.height if self.rotation in (90, 270) else self.width
+
+    @property
+    def display_height(self) -> Optional[int]:
+        return self.width if self.rotation in (90, 270) else self.height
+
+    @property
+    def is_hdr(self) -> bool:
+        """Whether the stream uses an HDR transfer function (PQ or HLG)."""
+        return self.color_transfer in HDR_TRANSFERS
+
+    @classmethod
+    def from_probe(cls, stream: dict) -> "StreamInfo":
+        tags = stream.get("tags") or {}
+        return cls(
+            index=stream.get("index", 0),
+            codec_type=stream.get("codec_type", "unknown"),
+            codec_name=stream.get("codec_name"),
+            width=stream.get("width"),
+            height=stream.get("height"),
+            # avg_frame_rate reflects variable frame rate footage better than r_frame_rate
+            frame_rate=parse_frame_rate(stream.get("avg_frame_rate")) or parse_frame_rate(stream.get("r_frame_rate")),
+            channels=stream.get("channels"),
+            language=tags.get("language"),
+            title=tags.get("title"),
+            color_primaries=stream.get("color_primaries"),
+            color_transfer=stream.get("color_transfer"),
+            color_space=stream.get("color_space"),
+            rotation=parse_rotation(stream),
+        )
+
+@dataclass
+class VideoMetadata:
+    """Typed view of ffprobe output. raw keeps the full probe data for anything not surfaced here."""
+    duration: float
+    size: Optional[int]
+    bit_rate: Optional[int]
+    format_name: Optional[str]
+    streams: List[StreamInfo]
+    raw: dict = field(default_factory=dict, repr=False)
+
+    @classmethod
+    def from_probe(cls, metadata: dict) -> "VideoMetadata":
+        format_info = metadata.get("format", {})
+        try:
+            duration = float(format_info.get("duration", 0.0))
+        except (TypeError, ValueError):
+            duration = 0.0  # "N/A" for some streamed inputs
+        return cls(
+            duration=duration,
+            size=_optional_int(format_info.get("size")),
+            bit_rate=_optional_int(format_info.get("bit_rate")),
+            format_name=format_info.get("format_name"),
+            streams=[StreamInfo.from_probe(stream) for stream in metadata.get("streams", [])],
+            raw=metadata,
+        )
+
+    @property
+    def video_streams(self) -> List[StreamInfo]:
+        return [stream for stream in self.streams if stream.codec_type == "video"]
+
+    @property
+    def audio_streams(self) -> List[StreamInfo]:
+        return [stream for stream in self.streams if stream.codec_type == "audio"]
+
+    @property
+    def video(self) -> Optional[StreamInfo]:
+        """The first video stream, if any."""
+        return next(iter(self.video_streams), None)
+
+    def audio_tracks(self) -> List[dict]:
+        """
+        Describe each audio stream in order. "index" is the position among audio
+        streams (what extract_audio's track_index selects), "stream_index" the
+        absolute stream number in the container.
+        """
+        return [
+            {
+                "index": i,
+                "stream_index": stream.index,
+                "codec": stream.codec_name,
+                "channels": stream.channels,
+                "language": stream.language,
+                "title": stream.title
+            }
+            for i, stream in enumerate(self.audio_streams)
+        ]
+
+    def summary(self) -> dict:
+        """JSON-serializable summary for storing on a project: container, first video stream and audio tracks."""
+        video = self.video
+        return {
+            "duration": self.duration or None,
+            "size": self.size,
+            "bit_rate": self.bit_rate,
+            "format": self.format_name,
+            "video": {
+                "codec": video.codec_name,
+                "width": video.width,
+                "height": video.height,
+                "display_width": video.display_width,
+                "display_height": video.display_height,
+                "frame_rate": video.frame_rate,
+                "rotation": video.rotation,
+                "hdr": video.is_hdr
+            } if video else None,
+            "audio_tracks": self.audio_tracks()
+        }
+
+# Bytes at the start of a file needed to recognize its container
+SNIFF_BYTES = 12
+
+def sniff_container(header: bytes) -> Optional[str]:
+    """
+    Recognize a supported video container from a file's first SNIFF_BYTES bytes,
+    returned as the format_name ffprobe reports for it. None for anything else.
+    """
+    # ISO base media (MP4/MOV) starts with a box: 4-byte size, then its type
+    if header[4:8] in (b'ftyp', b'moov', b'mdat', b'free', b'wide', b'skip'):
+        return 'mov,mp4,m4a,3gp,3g2,mj2'
+    # EBML magic number, shared by Matroska and WebM
+    if header[:4] == b'\x1a\x45\xdf\xa3':
+        return 'matroska,webm'
+    if header[:4] == b'RIFF' and header[8:12] == b'AVI ':
+        return 'avi'
+    return None
+
+def probe_metadata(input_path: str) -> VideoMetadata:
+    """Probe a media file into a VideoMetadata."""
+    return VideoMetadata.from_probe(probe_video(input_path))
+
+def get_video_duration(input_path: str) -> float:
+    """Return the container duration in seconds."""
+    return probe_metadata(input_path).duration
+
+def get_video_info(input_path: str) -> dict:
+    """
+    Summarise a video for storage on its project: displayed dimensions of the
+    first video stream (after any rotation), duration rounded to whole seconds,
+    and container format.
+    """
+    metadata = probe_metadata(input_path)
+    video = metadata.video
+    
+    return {
+        "width": video.display_width if video else None,
+        "height": video.display_height if video else None,
+        "duration": int(round(metadata.duration)) if metadata.duration else None,
+        "format": metadata.format_name
+    }
+
+def generate_thumbnail(input_path: str, output_path: str, at_time: float = 1.0, width: int = 640) -> str:
+    """
+    Extract a single poster frame as a JPEG.
+    at_time is clamped to the video duration, falling back to 1s when it is out of range.
+    """
+    if width <= 0:
+        raise ValueError(f"Invalid thumbnail width: {width}")
+    
+    duration = get_video_duration(input_path)
+    if at_time < 0 or (duration > 0 and at_time >= duration):
+        logger.warning(f"Thumbnail time {at_time}s is outside video duration {duration}s, using 1s")
+        at_time = min(1.0, duration / 2) if duration > 0 else 0.0
+    
+    ffmpeg_cmd = [
+        'ffmpeg',
+        '-ss', f"{at_time:.3f}",
+        '-i', input_path,
+        '-frames:v', '1',
+        '-vf', f"scale={width}:-1",
+        '-q:v', '2',  # High JPEG quality
+        '-y',  # Overwrite output file
+        output_path
+    ]
+    run_ffmpeg(ffmpeg_cmd, timeout=120)
+    # A small JPEG is legitimate, so only reject files too short to hold a frame
+    validate_output(output_path, min_size=100, probe=False)
+    
+    return output_path
+
+def has_audio_stream(input_path: str) -> bool:
+    """Whether the file contains at least one audio stream."""
+    return bool(probe_metadata(input_path).audio_streams)
+
+def list_audio_tracks(input_path: str) -> list:
+    """Describe each audio stream of a video in order (see VideoMetadata.audio_tracks)."""
+    return probe_metadata(input_path).audio_tracks()
+
+def extract_audio(input_path: str, output_path: str, codec: str = "libmp3lame",
+                  bitrate: str = "64k", channels: int = 1, track_index: int = 0) -> str:
+    """
+    Write one audio track of a video to an audio-only file, defaulting to the first.
+    Defaults to 64k mono MP3, which is plenty for speech recognition.
+    """
+    tracks = list_audio_tracks(input_path)
+    if not tracks:
+        raise NoAudioStreamError(f"Input has no audio stream: {input_path}")
+    if track_index < 0 or track_index >= len(tracks):
+        raise NoAudioStreamError(
+            f"Audio track {track_index} does not exist in {input_path} ({len(tracks)} tracks)",
+            user_message=f"The video has no audio track {track_index}"
+        )
+    
+    ffmpeg_cmd = [
+        'ffmpeg',
+        '-i', input_path,
+        '-map', f"0:a:{track_index}",
+        '-vn',  # Drop video
+        '-acodec', codec,
+        '-ac', str(channels),
+    ]
+    # Bitrate doesn't apply to uncompressed PCM
+    if not codec.startswith('pcm_'):
+        ffmpeg_cmd += ['-b:a', bitrate]
+    ffmpeg_cmd += ['-y', output_path]
+    
+    run_ffmpeg(ffmpeg_cmd)
+    validate_output(output_path)
+    return output_path
+
+HLS_PLAYLIST_FILENAME = "playlist.m3u8"
+
+# Encoders we transcode with, mapped to the codec_name ffprobe reports for their output
+SUPPORTED_VIDEO_CODECS = {"libx264": "h264", "libx265": "hevc"}
+TRANSCODE_PRESETS = ("ultrafast", "superfast", "veryfast", "faster", "fast", "medium", "slow", "slower", "veryslow")
+
+@dataclass
+class TranscodeOptions:
+    height: int
+    video_codec: str = "libx264"
+    crf: int = 23
+    preset: str = "medium"
+    audio_bitrate: str = "128k"
+    tone_map: str = "auto"  # One of TONE_MAP_MODES
+
+# "auto" tone-maps HDR sources to SDR; "off" encodes them as-is
+TONE_MAP_MODES = ("auto", "off")
+
+# Convert HDR (BT.2020 PQ/HLG) to BT.709 SDR: linearize, map highlights with hable, re-encode the transfer
+HDR_TO_SDR_FILTER = (
+    "zscale=t=linear:npl=100,format=gbrpf32le,zscale=p=bt709,"
+    "tonemap=tonemap=hable:desat=0,zscale=t=bt709:m=bt709:r=tv,format=yuv420p"
+)
+
+def transcode(input_path: str, output_path: str, options: TranscodeOptions,
+              on_progress: Optional[Callable[[float], None]] = None) -> bool:
+    """
+    Encode a web-friendly MP4 scaled to options.height (width keeps the aspect ratio).
+    When the source already has the target codec and height the video is copied
+    instead of re-encoded, along with the audio if it is all AAC already. HDR sources are tone-mapped to SDR unless
+    options.tone_map is "off". Returns True if the output was a stream copy.
+    """
+    if options.video_codec not in SUPPORTED_VIDEO_CODECS:
+        raise UnsupportedCodecError(
+            f"Unsupported video codec: {options.video_codec}",
+            user_message=f"Video codec {options.video_codec} is not supported"
+        )
+    if options.preset not in TRANSCODE_PRESETS:
+        raise ValueError(f"Invalid preset: {options.preset}")
+    if options.height <= 0 or options.height % 2:
+        raise ValueError(f"Invalid output height: {options.height}")
+    if options.tone_map not in TONE_MAP_MODES:
+        raise ValueError(f"Invalid tone_map mode: {options.tone_map}")
+    require_capabilities(encoders=(options.video_codec,), filters=('scale',))
+    
+    metadata = probe_metadata(input_path)
+    video_stream = metadata.video
+    if video_stream is None:
+        raise UnsupportedCodecError(f"Input has no video stream: {input_path}")
+    
+    tone_map = options.tone_map == "auto" and video_stream.is_hdr
+    if tone_map and not {'zscale', 'tonemap'} <= ffmpeg_filters():
+        logger.warning(f"{input_path} is HDR ({video_stream.color_transfer}) but ffmpeg lacks zscale/tonemap, colors may look washed out")
+        tone_map = False
+    
+    # A rotated source is re-encoded so the orientation is baked into the frames;
+    # ffmpeg applies the display rotation while decoding
+    copy = (
+        not tone_map
+        and video_stream.rotation == 0
+        and video_stream.codec_name == SUPPORTED_VIDEO_CODECS[options.video_codec]
+        and video_stream.height == options.height
+    )
+    
+    ffmpeg_cmd = ['ffmpeg', '-i', input_path, '-map', '0:v:0', '-map', '0:a?']
+    if copy:
+        ffmpeg_cmd += ['-c:v', 'copy']
+        # MP4 can't carry every audio codec a source may have (Opus, Vorbis, PCM), so anything but AAC is encoded
+        if all(stream.codec_name == 'aac' for stream in metadata.audio_streams):
+            ffmpeg_cmd += ['-c:a', 'copy']
+        else:
+            ffmpeg_cmd += ['-c:a', 'aac', '-b:a', options.audio_bitrate]
+    else:
+        video_filter = f"scale=-2:{options.height}"
+        if tone_map:
+            logger.info(f"Tone-mapping HDR ({video_stream.color_transfer}) source {input_path} to SDR")
+            video_filter = f"{HDR_TO_SDR_FILTER},{video_filter}"
+            ffmpeg_cmd += ['-color_primaries', 'bt709', '-color_trc', 'bt709', '-colorspace', 'bt709']
+        ffmpeg_cmd += [
+            '-vf', video_filter,
+            '-c:v', options.video_codec,
+            '-crf', str(options.crf),
+            '-preset', options.preset,
+            '-pix_fmt', 'yuv420p',  # Broadest player compatibility
+            '-c:a', 'aac',
+            '-b:a', options.audio_bitrate,
+            '-metadata:s:v:0', 'rotate=0',  # Already applied to the frames
+        ]
+    ffmpeg_cmd += ['-movflags', '+faststart', '-y', output_path]
+    
+    run_ffmpeg_with_progress(ffmpeg_cmd, metadata.duration, on_progress)
+    validate_output(output_path)
+    return copy
+
+def package_hls(input_path: str, output_dir: str, segment_duration: int = 6,
+                on_progress: Optional[Callable[[float], None]] = None) -> str:
+    """
+    Package a video for HLS streaming as playlist.m3u8 plus .ts segments in output_dir.
+    Keyframes are forced at every segment boundary so segments are close to
+    segment_duration seconds long. Segment URIs in the playlist are relative.
+    Returns the playlist path.
+    """
+    if segment_duration <= 0:
+        raise ValueError(f"Invalid segment duration: {segment_duration}")
+    require_capabilities(encoders=('libx264',))
+    
+    duration = get_video_duration(input_path)
+    os.makedirs(output_dir, exist_ok=True)
+    playlist_path = os.path.join(output_dir, HLS_PLAYLIST_FILENAME)
+    
+    ffmpeg_cmd = [
+        'ffmpeg',
+        '-i', input_path,
+        '-map', '0:v:0', '-map', '0:a?',
+        '-c:v', 'libx264', '-preset', 'veryfast', '-crf', '23',
+        '-pix_fmt', 'yuv420p',
+        '-force_key_frames', f"expr:gte(t,n_forced*{segment_duration})",
+        '-c:a', 'aac', '-b:a', '128k',
+        '-f', 'hls',
+        '-hls_time', str(segment_duration),
+        '-hls_playlist_type', 'vod',
+        '-hls_segment_filename', os.path.join(output_dir, 'segment_%05d.ts'),
+        '-y', playlist_path
+    ]
+    run_ffmpeg_with_progress(ffmpeg_cmd, duration, on_progress)
+    
+    validate_output(playlist_path, min_size=1, probe=False)
+    segments = [name for name in os.listdir(output_dir) if name.endswith('.ts')]
+    if not segments:
+        raise EmptyOutputError(f"FFmpeg wrote an HLS playlist without segments in {output_dir}")
+    for name in segments:
+        validate_output(os.path.join(output_dir, name), probe=False)
+    
+    return playlist_path
+
+WATERMARK_IMAGE_EXTENSIONS = (".png", ".jpg", ".jpeg", ".webp")
+
+# overlay x:y expressions for each corner, inset by WATERMARK_MARGIN pixels
+WATERMARK_MARGIN = 16
+WATERMARK_POSITIONS = {
+    "tl": f"{WATERMARK_MARGIN}:{WATERMARK_MARGIN}",
+    "tr": f"main_w-overlay_w-{WATERMARK_MARGIN}:{WATERMARK_MARGIN}",
+    "bl": f"{WATERMARK_MARGIN}:main_h-overlay_h-{WATERMARK_MARGIN}",
+    "br": f"main_w-overlay_w-{WATERMARK_MARGIN}:main_h-overlay_h-{WATERMARK_MARGIN}",
+}
+
+def overlay_watermark(input_path: str, watermark_image: str, output_path: str, position: str = "br",
+                      opacity: float = 0.8, scale: float = 0.15,
+                      on_progress: Optional[Callable[[float], None]] = None) -> str:
+    """
+    Burn a logo into a corner of the video. scale is the watermark width as a
+    fraction of the video width (aspect ratio preserved); opacity is in [0, 1].
+    """
+    if position not in WATERMARK_POSITIONS:
+        raise ValueError(f"Invalid watermark position: {position}")
+    if not 0 <= opacity <= 1:
+        raise ValueError(f"Watermark opacity must be between 0 and 1: {opacity}")
+    if not 0 < scale <= 1:
+        raise ValueError(f"Watermark scale must be in (0, 1]: {scale}")
+    if not os.path.exists(watermark_image):
+        raise InputNotFoundError(f"Watermark image does not exist: {watermark_image}")
+    if os.path.splitext(watermark_image)[1].lower() not in WATERMARK_IMAGE_EXTENSIONS:
+        raise UnsupportedCodecError(
+            f"Unsupported watermark image format: {watermark_image}",
+            user_message=f"Watermark images must be one of: {', '.join(WATERMARK_IMAGE_EXTENSIONS)}"
+        )
+    
+    require_capabilities(encoders=('libx264',), filters=('colorchannelmixer', 'scale2ref', 'overlay'))
+    
+    duration = get_video_duration(input_path)
+    filter_complex = (
+        f"[1:v]format=rgba,colorchannelmixer=aa={opacity}[logo];"
+        f"[logo][0:v]scale2ref=w=main_w*{scale}:h=ow/a[wm][base];"
+        f"[base][wm]overlay={WATERMARK_POSITIONS[position]},format=yuv420p[v]"
+    )
+    
+    ffmpeg_cmd = [
+        'ffmpeg',
+        '-i', input_path,
+        '-i', watermark_image,
+        '-filter_complex', filter_complex,
+        '-map', '[v]', '-map', '0:a?',
+        '-c:v', 'libx264', '-preset', 'medium', '-crf', '23',
+        '-c:a', 'copy',
+        '-movflags', '+faststart',
+        '-y', output_path
+    ]
+    run_ffmpeg_with_progress(ffmpeg_cmd, duration, on_progress)
+    validate_output(output_path)
+    return output_path
+
+def burn_captions(input_path: str, ass_path: str, output_path: str,
+                  on_progress: Optional[Callable[[float], None]] = None) -> int:
+    """
+    Render an ASS subtitle file into the video frames (audio is copied).
+    Returns the output size in bytes.
+    """
+    require_capabilities(encoders=('libx264',), filters=('ass',))
+    
+    try:
+        duration = get_video_duration(input_path)
+    except Exception as probe_error:
+        logger.warning(f"Could not determine video duration, progress will not be reported: {probe_error}")
+        duration = 0.0
+    
+    ffmpeg_cmd = [
+        'ffmpeg',
+        '-i', input_path,
+        '-vf', f"ass={escape_filter_path(ass_path)}",
+        '-c:a', 'copy',  # Copy audio without re-encoding
+        '-c:v', 'libx264',  # Use H.264 for video
+        '-preset', 'medium',  # Balance between speed and quality
+        '-crf', '23',  # Good quality setting
+        '-y',  # Overwrite output file
+        output_path
+    ]
+    run_ffmpeg_with_progress(ffmpeg_cmd, duration, on_progress)
+    return validate_output(output_path)
+
+# Limits that keep GIFs small enough to share
+GIF_MAX_DURATION = 10.0
+GIF_MAX_WIDTH = 800
+GIF_FPS_RANGE = (1, 30)
+
+def generate_gif(input_path: str, output_path: str, start: float = 0.0, duration: float = 3.0,
+                 fps: int = 12, width: int = 480) -> str:
+    """
+    Render a looping GIF of duration seconds from start. Uses a palette generated
+    from the clip itself (palettegen/paletteuse), which looks far better than
+    ffmpeg's default 256-colour palette.
+    """
+    if not 0 < duration <= GIF_MAX_DURATION:
+        raise ValueError(f"GIF duration must be in (0, {GIF_MAX_DURATION}]: {duration}")
+    if not GIF_FPS_RANGE[0] <= fps <= GIF_FPS_RANGE[1]:
+        raise ValueError(f"GIF fps must be between {GIF_FPS_RANGE[0]} and {GIF_FPS_RANGE[1]}: {fps}")
+    if not 0 < width <= GIF_MAX_WIDTH:
+        raise ValueError(f"GIF width must be between 1 and {GIF_MAX_WIDTH}: {width}")
+    require_capabilities(filters=('fps', 'scale', 'palettegen', 'paletteuse'))
+    
+    video_duration = get_video_duration(input_path)
+    if start < 0 or (video_duration > 0 and start >= video_duration):
+        raise ValueError(f"GIF start {start}s is outside video duration {video_duration}s")
+    
+    filter_complex = (
+        f"[0:v]fps={fps},scale={width}:-1:flags=lanczos,split[a][b];"
+        f"[a]palettegen=stats_mode=diff[palette];"
+        f"[b][palette]paletteuse=dither=bayer:bayer_scale=5"
+    )
+    ffmpeg_cmd = [
+        'ffmpeg',
+        '-ss', f"{start:.3f}",
+        '-t', f"{duration:.3f}",
+        '-i', input_path,
+        '-filter_complex', filter_complex,
+        '-loop', '0',  # Loop forever
+        '-y', output_path
+    ]
+    run_ffmpeg(ffmpeg_cmd, timeout=300)
+    validate_output(output_path)
+    
+    return output_path
+
+# Playback speed multipliers accepted by change_speed
+SPEED_FACTOR_MAX = 100.0
+# Outside this range frames are heavily dropped (timelapse) or duplicated (slow motion)
+SPEED_SMOOTH_RANGE = (0.25, 4.0)
+# Factor range a single atempo filter is guaranteed to accept across ffmpeg versions
+ATEMPO_RANGE = (0.5, 2.0)
+
+def atempo_chain(factor: float) -> list:
+    """
+    Split a tempo factor into atempo values within ATEMPO_RANGE whose product is
+    factor, e.g. 5.0 -> [2.0, 2.0, 1.25] and 0.2 -> [0.5, 0.5, 0.8].
+    """
+    if factor <= 0:
+        raise ValueError(f"Tempo factor must be positive: {factor}")
+    
+    chain = []
+    while factor > ATEMPO_RANGE[1]:
+        chain.append(ATEMPO_RANGE[1])
+        factor /= ATEMPO_RANGE[1]
+    while factor < ATEMPO_RANGE[0]:
+        chain.append(ATEMPO_RANGE[0])
+        factor /= ATEMPO_RANGE[0]
+    chain.append(round(factor, 6))
+    return chain
+
+def change_speed(input_path: str, output_path: str, factor: float,
+                 on_progress: Optional[Callable[[float], None]] = None) -> str:
+    """
+    Speed a video up (factor > 1, timelapse) or slow it down (factor < 1, slow
+    motion). Video timestamps are scaled with setpts and audio with a chain of
+    atempo filters of the same overall factor, so the two stay in sync.
+    """
+    if not 0 < factor <= SPEED_FACTOR_MAX:
+        raise ValueError(f"Speed factor must be in (0, {SPEED_FACTOR_MAX}]: {factor}")
+    require_capabilities(encoders=('libx264',), filters=('setpts', 'atempo'))
+    
+    duration = get_video_duration(input_path)
+    
+    ffmpeg_cmd = ['ffmpeg', '-i', input_path, '-map', '0:v:0', '-filter:v', f"setpts=PTS/{factor}"]
+    if has_audio_stream(input_path):
+        atempo = ",".join(f"atempo={value}" for value in atempo_chain(factor))
+        ffmpeg_cmd += ['-map', '0:a:0', '-filter:a', atempo, '-c:a', 'aac', '-b:a', '128k']
+    ffmpeg_cmd += [
+        '-c:v', 'libx264',
+        '-preset', 'fast',
+        '-crf', '23',
+        '-pix_fmt', 'yuv420p',
+        '-movflags', '+faststart',
+        '-y', output_path
+    ]
+    
+    # Progress is measured against the output timeline, which is duration / factor long
+    run_ffmpeg_with_progress(ffmpeg_cmd, duration / factor, on_progress)
+    validate_output(output_path)
+    
+    return output_path
+
+# Integrated loudness targets loudnorm accepts, in LUFS
+LOUDNESS_TARGET_RANGE = (-70.0, -5.0)
+# What most social platforms normalize playback to
+DEFAULT_LOUDNESS_TARGET = -14.0
+LOUDNESS_TRUE_PEAK = -1.5
+LOUDNESS_RANGE = 11.0
+
+def parse_loudnorm_stats(stderr: str) -> dict:
+    """Pull the JSON block loudnorm prints with print_format=json out of ffmpeg's stderr."""
+    start = stderr.rfind('{')
+    end = stderr.rfind('}')
+    if start == -1 or end < start:
+        raise FFmpegError(f"loudnorm printed no measurements: {stderr[-500:]}")
+    try:
+        return json.loads(stderr[start:end + 1])
+    except json.JSONDecodeError as e:
+        raise FFmpegError(f"Could not parse loudnorm measurements: {e}")
+
+def normalize_loudness(input_path: str, output_path: str, target_lufs: float = DEFAULT_LOUDNESS_TARGET,
+                       on_progress: Optional[Callable[[float], None]] = None) -> dict:
+    """
+    Normalize a video's audio to target_lufs integrated loudness (EBU R128) with
+    two loudnorm passes: the first measures the input, the second applies a
+    linear gain computed from those measurements, which is more accurate than
+    loudnorm's single-pass dynamic mode. The video stream is copied unchanged.
+    Returns the first-pass measurements.
+    """
+    if not LOUDNESS_TARGET_RANGE[0] <= target_lufs <= LOUDNESS_TARGET_RANGE[1]:
+        raise ValueError(f"Loudness target must be between {LOUDNESS_TARGET_RANGE[0]} and {LOUDNESS_TARGET_RANGE[1]} LUFS: {target_lufs}")
+    if not has_audio_stream(input_path):
+        raise NoAudioStreamError(f"Input has no audio stream: {input_path}")
+    require_capabilities(filters=('loudnorm',))
+    
+    duration = get_video_duration(input_path)
+    targets = f"I={target_lufs}:TP={LOUDNESS_TRUE_PEAK}:LRA={LOUDNESS_RANGE}"
+    
+    # Each pass reads the whole input, so report them as the two halves of the job
+    def pass_progress(offset: float):
+        if on_progress is None:
+            return None
+        return lambda fraction: on_progress(offset + fraction / 2)
+    
+    measure_cmd = [
+        'ffmpeg', '-i', input_path,
+        '-map', '0:a:0',
+        '-af', f"loudnorm={targets}:print_format=json",
+        '-f', 'null', '-'
+    ]
+    stats = parse_loudnorm_stats(run_ffmpeg_with_progress(measure_cmd, duration, pass_progress(0.0)))
+    
+    if stats.get("input_i") in (None, "-inf"):
+        raise NoAudioStreamError(
+            f"Audio is silent, measured {stats.get('input_i')} LUFS: {input_path}",
+            user_message="The video's audio is silent and can't be normalized"
+        )
+    
+    measured = (
+        f"measured_I={stats['input_i']}:measured_TP={stats['input_tp']}:"
+        f"measured_LRA={stats['input_lra']}:measured_thresh={stats['input_thresh']}:"
+        f"offset={stats['target_offset']}"
+    )
+    apply_cmd = [
+        'ffmpeg', '-i', input_path,
+        '-map', '0:v:0?', '-map', '0:a:0',
+        '-af', f"loudnorm={targets}:{measured}:linear=true",
+        '-c:v', 'copy',
+        '-c:a', 'aac', '-b:a', '192k',
+        '-ar', '48000',  # loudnorm upsamples to 192kHz internally
+        '-movflags', '+faststart',
+        '-y', output_path
+    ]
+    run_ffmpeg_with_progress(apply_cmd, duration, pass_progress(0.5))
+    validate_output(output_path)
+    
+    return stats
+
+# transpose filters turning frames clockwise by the given degrees
+ROTATE_FILTERS = {
+    90: "transpose=clock",
+    180: "transpose=clock,transpose=clock",
+    270: "transpose=cclock",
+}
+
+def rotate_video(input_path: str, output_path: str, degrees: int,
+                 on_progress: Optional[Callable[[float], None]] = None) -> str:
+    """
+    Rotate a video clockwise by 90, 180 or 270 degrees, on top of its display
+    rotation (which ffmpeg applies while decoding). The result is baked into
+    the frames and carries no rotation metadata. Audio is copied.
+    """
+    if degrees not in ROTATE_FILTERS:
+        raise ValueError(f"Rotation must be one of {sorted(ROTATE_FILTERS)}: {degrees}")
+    require_capabilities(encoders=('libx264',), filters=('transpose',))
+    
+    duration = get_video_duration(input_path)
+    ffmpeg_cmd = [
+        'ffmpeg', '-i', input_path,
+        '-map', '0:v:0', '-map', '0:a?',
+        '-vf', ROTATE_FILTERS[degrees],
+        '-c:v', 'libx264',
+        '-preset', 'fast',
+        '-crf', '20',
+        '-pix_fmt', 'yuv420p',
+        '-c:a', 'copy',
+        '-metadata:s:v:0', 'rotate=0',
+        '-movflags', '+faststart',
+        '-y', output_path
+    ]
+    run_ffmpeg_with_progress(ffmpeg_cmd, duration, on_progress)
+    validate_output(output_path)
+    
+    return output_path
+
+# select's scene score (0-1) above which a frame starts a new scene
+DEFAULT_SCENE_THRESHOLD = 0.4
+
+def detect_scenes(input_path: str, threshold: float = DEFAULT_SCENE_THRESHOLD, timeout: int = 3600) -> List[float]:
+    """Timestamps in seconds of the frames where a new scene starts, in order."""
+    if not 0 < threshold < 1:
+        raise ValueError(f"Scene threshold must be between 0 and 1: {threshold}")
+    require_capabilities(filters=('select', 'metadata'))
+    
+    ffmpeg_cmd = [
+        'ffmpeg', '-i', input_path,
+        '-map', '0:v:0', '-an',
+        '-vf', f"select='gt(scene,{threshold})',metadata=print:file=-",
+        '-f', 'null', '-'
+    ]
+    # Scene scoring decodes every frame, so by default allow as long as an encode
+    result = run_ffmpeg(ffmpeg_cmd, timeout=timeout)
+    
+    cuts = []
+    for match in re.finditer(r'pts_time:(-?[\d.]+)', result.stdout):
+        cut = float(match.group(1))
+        if cut > 0 and (not cuts or cut > cuts[-1]):
+            cuts.append(cut)
+    return cuts
+
+@dataclass
+class CropWindow:
+    """From start (seconds) until the next window, keep the part of the frame centered at center (0-1 of the width)."""
+    start: float
+    center: float
+
+# Signature of a crop planner: (input path, display width, display height) -> windows ordered by start.
+# plan_motion_crop is a heuristic; a face or speaker detector can be dropped in with the same signature.
+CropPlanner = Callable[[str, int, int], List[CropWindow]]
+
+# Motion analysis runs on small grayscale frames sampled at this rate
+MOTION_SAMPLE_WIDTH = 160
+MOTION_SAMPLE_FPS = 2
+# Average per-pixel frame difference below which a scene counts as static and stays centered
+MIN_MOTION_ENERGY = 1.0
+
+def motion_columns(input_path: str, width: int, height: int) -> List[tuple]:
+    """
+    Per sampled frame, (timestamp, per-column motion energy): how much each
+    column of a MOTION_SAMPLE_WIDTH-wide grayscale rendition differs from the
+    previous sampled frame.
+    """
+    sample_height = max(2, round(MOTION_SAMPLE_WIDTH * height / width / 2) * 2)
+    frame_size = MOTION_SAMPLE_WIDTH * sample_height
+    ffmpeg_cmd = [
+        'ffmpeg', '-v', 'error', '-i', input_path,
+        '-map', '0:v:0', '-an',
+        '-vf', (
+            f"fps={MOTION_SAMPLE_FPS},scale={MOTION_SAMPLE_WIDTH}:{sample_height},"
+            "format=gray,tblend=all_mode=difference"
+        ),
+        '-f', 'rawvideo', '-pix_fmt', 'gray', 'pipe:1'
+    ]
+    logger.info(f"Running FFmpeg command: {' '.join(ffmpeg_cmd)}")
+    
+    process = subprocess.Popen(ffmpeg_cmd, stdout=subprocess.PIPE, stderr=subprocess.PIPE)
+    stderr_chunks = []
+    stderr_thread = threading.Thread(target=lambda: stderr_chunks.append(process.stderr.read()), daemon=True)
+    stderr_thread.start()
+    
+    frames = []
+    try:
+        while True:
+            frame = process.stdout.read(frame_size)
+            if len(frame) < frame_size:
+                break
+            # tblend's first output is the difference between the first two samples
+            timestamp = (len(frames) + 1) / MOTION_SAMPLE_FPS
+            columns = [sum(frame[column::MOTION_SAMPLE_WIDTH]) / sample_height for column in range(MOTION_SAMPLE_WIDTH)]
+            frames.append((timestamp, columns))
+        process.wait()
+    except BaseException:
+        process.kill()
+        process.wait()
+        raise
+    
+    stderr_thread.join()
+    if process.returncode != 0:
+        stderr = b''.join(stderr_chunks).decode(errors='replace')
+        logger.error(f"FFmpeg failed with return code {process.returncode}: {stderr}")
+        raise classify_ffmpeg_error('ffmpeg', stderr)
+    
+    return frames
+
+def plan_motion_crop(input_path: str, width: int, height: int) -> List[CropWindow]:
+    """
+    Place the crop once per scene, centered on where the frame changes most
+    (usually whoever is speaking or moving). Static scenes keep the previous
+    scene's position, starting from the center.
+    """
+    scene_starts = [0.0] + detect_scenes(input_path)
+    frames = motion_columns(input_path, width, height)
+    
+    windows = []
+    center = 0.5
+    for i, start in enumerate(scene_starts):
+        end = scene_starts[i + 1] if i + 1 < len(scene_starts) else float("inf")
+        totals = [0.0] * MOTION_SAMPLE_WIDTH
+        sampled = 0
+        for timestamp, columns in frames:
+            if start <= timestamp < end:
+                totals = [total + energy for total, energy in zip(totals, columns)]
+                sampled += 1
+        
+        energy = sum(totals)
+        if sampled and energy / (sampled * MOTION_SAMPLE_WIDTH) >= MIN_MOTION_ENERGY:
+            centroid = sum((column + 0.5) * total for column, total in enumerate(totals)) / energy
+            center = centroid / MOTION_SAMPLE_WIDTH
+        windows.append(CropWindow(start=start, center=center))
+    
+    logger.info(f"Planned smart crop for {input_path}: {len(windows)} scenes")
+    return windows
+
+def plan_center_crop(input_path: str, width: int, height: int) -> List[CropWindow]:
+    return [CropWindow(start=0.0, center=0.5)]
+
+def crop_x_expression(windows: List[CropWindow], frame_width: int, crop_width: int) -> str:
+    """A crop x expression switching between the windows' positions by timestamp, as nested if()s."""
+    def offset(window: CropWindow) -> int:
+        x = round(window.center * frame_width - crop_width / 2)
+        return min(max(x, 0), frame_width - crop_width) // 2 * 2
+    
+    expression = str(offset(windows[-1]))
+    for current, following in reversed(list(zip(windows, windows[1:]))):
+        expression = f"if(lt(t,{following.start:.3f}),{offset(current)},{expression})"
+    return expression
+
+# Tallest output of a vertical reframe; smaller sources are not upscaled
+REFRAME_MAX_HEIGHT = 1920
+
+def reframe_vertical(input_path: str, output_path: str, smart_crop: bool = True,
+                     on_progress: Optional[Callable[[float], None]] = None,
+                     planner: Optional[CropPlanner] = None) -> List[CropWindow]:
+    """
+    Crop a landscape video to 9:16 for vertical platforms. With smart_crop the
+    crop follows the action scene by scene (plan_motion_crop, unless another
+    planner is given); otherwise it stays centered. Audio is copied. Returns
+    the crop windows used.
+    """
+    require_capabilities(encoders=('libx264',), filters=('crop', 'scale'))
+    
+    metadata = probe_metadata(input_path)
+    video = metadata.video
+    if not video or not video.display_width or not video.display_height:
+        raise UnsupportedCodecError(f"No video stream with dimensions in {input_path}")
+    
+    width, height = video.display_width, video.display_height
+    crop_width = int(height * 9 / 16) // 2 * 2
+    if crop_width >= width:
+        raise AlreadyVerticalError(f"Cannot reframe {width}x{height} video to 9:16")
+    
+    progress = WeightedProgress({"analysis": 1, "render": 2}, on_progress or (lambda fraction: None))
+    
+    planner = planner or (plan_motion_crop if smart_crop else plan_center_crop)
+    windows = planner(input_path, width, height) or [CropWindow(start=0.0, center=0.5)]
+    progress.report("analysis", 1.0)
+    
+    x = crop_x_expression(windows, width, crop_width)
+    ffmpeg_cmd = [
+        'ffmpeg', '-i', input_path,
+        '-map', '0:v:0', '-map', '0:a?',
+        '-vf', f"crop=w={crop_width}:h={height}:x='{x}':y=0,scale=-2:'min(ih,{REFRAME_MAX_HEIGHT})',setsar=1",
+        '-c:v', 'libx264',
+        '-preset', 'fast',
+        '-crf', '20',
+        '-pix_fmt', 'yuv420p',
+        '-c:a', 'copy',
+        '-metadata:s:v:0', 'rotate=0',
+        '-movflags', '+faststart',
+        '-y', output_path
+    ]
+    run_ffmpeg_with_progress(ffmpeg_cmd, metadata.duration, progress.step("render"))
+    validate_output(output_path)
+    
+    return windows
+
+# Ranges accepted for silence detection: audio below noise_db (dBFS) for at least min_duration seconds
+SILENCE_NOISE_DB_RANGE = (-90.0, 0.0)
+SILENCE_MIN_DURATION_RANGE = (0.1, 60.0)
+DEFAULT_SILENCE_NOISE_DB = -30.0
+DEFAULT_SILENCE_MIN_DURATION = 0.5
+# Most silences removed from one video; beyond this only the longest are cut
+MAX_SILENCE_CUTS = 200
+# Seconds of each silence kept on either side of a cut so speech isn't clipped
+SILENCE_PADDING = 0.1
+
+@dataclass
+class SilenceRange:
+    start: float
+    end: float
+
+    @property
+    def duration(self) -> float:
+        return self.end - self.start
+
+def parse_silencedetect(stderr: str, duration: float) -> List[SilenceRange]:
+    """Pair silencedetect's silence_start/silence_end log lines; a silence still open at the end runs to duration."""
+    silences = []
+    start = None
+    for match in re.finditer(r'silence_(start|end): (-?[\d.]+)', stderr):
+        kind, value = match.group(1), max(float(match.group(2)), 0.0)
+        if kind == 'start':
+            start = value
+        elif start is not None:
+            silences.append(SilenceRange(start=start, end=value))
+            start = None
+    if start is not None and duration > start:
+        silences.append(SilenceRange(start=start, end=duration))
+    return silences
+
+def detect_silence(input_path: str, noise_db: float = DEFAULT_SILENCE_NOISE_DB,
+                   min_duration: float = DEFAULT_SILENCE_MIN_DURATION, timeout: int = 1800) -> List[SilenceRange]:
+    """Stretches of the first audio track quieter than noise_db dBFS lasting at least min_duration seconds."""
+    if not SILENCE_NOISE_DB_RANGE[0] <= noise_db <= SILENCE_NOISE_DB_RANGE[1]:
+        raise ValueError(f"Silence threshold must be between {SILENCE_NOISE_DB_RANGE[0]} and {SILENCE_NOISE_DB_RANGE[1]} dB: {noise_db}")
+    if not SILENCE_MIN_DURATION_RANGE[0] <= min_duration <= SILENCE_MIN_DURATION_RANGE[1]:
+        raise ValueError(
+            f"Minimum silence must be between {SILENCE_MIN_DURATION_RANGE[0]} and {SILENCE_MIN_DURATION_RANGE[1]} seconds: {min_duration}"
+        )
+    metadata = probe_metadata(input_path)
+    if not metadata.audio_streams:
+        raise NoAudioStreamError(f"Input has no audio stream: {input_path}")
+    require_capabilities(filters=('silencedetect',))
+    
+    ffmpeg_cmd = [
+        'ffmpeg', '-i', input_path,
+        '-map', '0:a:0', '-vn',
+        '-af', f"silencedetect=noise={noise_db}dB:d={min_duration}",
+        '-f', 'null', '-'
+    ]
+    result = run_ffmpeg(ffmpeg_cmd, timeout=timeout)
+    return parse_silencedetect(result.stderr, metadata.duration)
+
+def silence_cuts(silences: List[SilenceRange], duration: float) -> List[tuple]:
+    """
+    The (start, end) ranges to keep when cutting silences out of a video of the
+    given duration: at most MAX_SILENCE_CUTS of the longest silences, each
+    shortened by SILENCE_PADDING next to the sound around it. Silence at the
+    very start or end is cut completely.
+    """
+    longest = sorted(silences, key=lambda silence: silence.duration, reverse=True)[:MAX_SILENCE_CUTS]
+    cuts = sorted(
+        (
+            silence.start + SILENCE_PADDING if silence.start > 0 else 0.0,
+            silence.end - SILENCE_PADDING if silence.end < duration else duration
+        )
+        for silence in longest
+    )
+    
+    keep = []
+    position = 0.0
+    for cut_start, cut_end in cuts:
+        if cut_end <= cut_start:
+            continue
+        if cut_start > position:
+            keep.append((position, cut_start))
+        position = max(position, cut_end)
+    if duration > position:
+        keep.append((position, duration))
+    return keep
+
+def remove_silence(input_path: str, output_path: str, noise_db: float = DEFAULT_SILENCE_NOISE_DB,
+                   min_duration: float = DEFAULT_SILENCE_MIN_DURATION,
+                   on_progress: Optional[Callable[[float], None]] = None) -> List[SilenceRange]:
+    """
+    Cut detected silences out of a video by keeping only the frames and samples
+    around them, re-encoding video and audio. Returns the silences that were found.
+    """
+    require_capabilities(encoders=('libx264', 'aac'), filters=('select', 'aselect', 'setpts', 'asetpts'))
+    
+    silences = detect_silence(input_path, noise_db, min_duration)
+    duration = get_video_duration(input_path)
+    keep = silence_cuts(silences, duration)
+    if not keep:
+        raise NoAudioStreamError(
+            f"Nothing left after removing silence from {input_path}",
+            user_message="The video is entirely silent"
+        )
+    
+    # One select per stream rather than a trim chain per kept part: each chain would
+    # buffer the decoded stream until its part came up, so memory grew with the cut count.
+    # The kept frames and samples are then renumbered into continuous timestamps
+    kept = '+'.join(f"between(t,{start:.3f},{end:.3f})" for start, end in keep)
+    filter_graph = (
+        f"[0:v:0]select='{kept}',setpts=N/FRAME_RATE/TB[v];"
+        f"[0:a:0]aselect='{kept}',asetpts=N/SR/TB[a]"
+    )
+    
+    ffmpeg_cmd = [
+        'ffmpeg', '-i', input_path,
+        '-filter_complex', filter_graph,
+        '-map', '[v]', '-map', '[a]',
+        '-c:v', 'libx264',
+        '-preset', 'fast',
+        '-crf', '20',
+        '-pix_fmt', 'yuv420p',
+        '-c:a', 'aac',
+        '-b:a', '192k',
+        '-movflags', '+faststart',
+        '-y', output_path
+    ]
+    kept_duration = sum(end - start for start, end in keep)
+    run_ffmpeg_with_progress(ffmpeg_cmd, kept_duration, on_progress)
+    validate_output(output_path)
+    
+    return silences
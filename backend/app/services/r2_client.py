@@ -5,6 +5,7 @@ import ssl
 import urllib3
 import certifi
 import socket
+import threading
 from botocore.exceptions import ClientError, NoCredentialsError, SSLError, EndpointConnectionError
 from botocore.config import Config
 from dotenv import load_dotenv
@@ -12,12 +13,21 @@ from typing import Optional, Dict, Any
 import time
 from functools import wraps
 import random
+from app.core.config import storage_settings
 
 logger = logging.getLogger(__name__)
 
 # Load environment variables
 load_dotenv(override=True)
 
+class PartialDeleteError(Exception):
+    """Some objects under a prefix could not be deleted; failed_keys lists them."""
+    
+    def __init__(self, prefix: str, failed_keys: list):
+        super().__init__(f"Failed to delete {len(failed_keys)} objects under {prefix}")
+        self.prefix = prefix
+        self.failed_keys = failed_keys
+
 class R2Client:
     """
     Cloudflare R2 storage client using S3-compatible API.
@@ -29,7 +39,7 @@ class R2Client:
         self.account_id = os.environ.get("CLOUDFLARE_ACCOUNT_ID")
         self.access_key = os.environ.get("R2_ACCESS_KEY_ID") 
         self.secret_key = os.environ.get("R2_SECRET_ACCESS_KEY")
-        self.bucket_name = os.environ.get("R2_BUCKET_NAME", "videos")
+        self.bucket_name = storage_settings.bucket_name
         
         # Debug: Print all environment variables for troubleshooting
         logger.debug("Environment variables:")
@@ -200,10 +210,38 @@ class R2Client:
         Returns:
             dict: Upload result with success status and metadata
         """
-        try:
-            file_size = os.path.getsize(file_path)
-            logger.info(f"Starting multipart upload for {object_key} ({file_size} bytes)")
+        file_size = os.path.getsize(file_path)
+        logger.info(f"Starting multipart upload for {object_key} ({file_size} bytes)")
+        
+        with open(file_path, 'rb') as file_obj:
+            result = self._multipart_upload_fileobj(file_obj, object_key, extra_args)
+        
+        return {**result, "file_size": file_size}
+    
+    def upload_fileobj(self, file_obj, object_key: str, content_type: str) -> dict:
+        """
+        Stream a readable file-like object to R2 using multipart upload, without
+        needing it on disk as a single file (e.g. a reader chaining upload chunks).
+        
+        Args:
+            file_obj: Object with a read(size) method returning bytes
+            object_key: S3 object key (path in the bucket)
+            content_type: MIME type of the file
             
+        Returns:
+            dict: Upload result with success status and metadata
+        """
+        start_time = time.time()
+        logger.info(f"Starting streaming upload for {object_key}")
+        
+        result = self._multipart_upload_fileobj(file_obj, object_key, {'ContentType': content_type})
+        
+        logger.info(f"Streaming upload completed: {object_key} in {time.time() - start_time:.1f}s")
+        return result
+    
+    def _multipart_upload_fileobj(self, file_obj, object_key: str, extra_args: dict) -> dict:
+        """Upload everything read from file_obj as an 8MB-part multipart upload, aborting on failure."""
+        try:
             # Create multipart upload
             mpu = self.s3_client.create_multipart_upload(
                 Bucket=self.bucket_name,
@@ -216,37 +254,36 @@ class R2Client:
             part_size = 8 * 1024 * 1024  # 8MB parts
             parts = []
             
-            with open(file_path, 'rb') as file_obj:
-                part_number = 1
-                while True:
-                    data = file_obj.read(part_size)
-                    if not data:
-                        break
-                        
-                    logger.debug(f"Uploading part {part_number} for {object_key}")
-                    
-                    # Retry logic for each part
-                    for attempt in range(3):
-                        try:
-                            part = self.s3_client.upload_part(
-                                Bucket=self.bucket_name,
-                                Key=object_key,
-                                PartNumber=part_number,
-                                UploadId=upload_id,
-                                Body=data
-                            )
-                            parts.append({
-                                'PartNumber': part_number,
-                                'ETag': part['ETag']
-                            })
-                            break
-                        except Exception as e:
-                            if attempt == 2:  # Last attempt
-                                raise
-                            logger.warning(f"Part {part_number} upload failed (attempt {attempt + 1}/3): {str(e)}")
-                            time.sleep(2 ** attempt)  # Exponential backoff
+            part_number = 1
+            while True:
+                data = file_obj.read(part_size)
+                if not data:
+                    break
                     
-                    part_number += 1
+                logger.debug(f"Uploading part {part_number} for {object_key}")
+                
+                # Retry logic for each part
+                for attempt in range(3):
+                    try:
+                        part = self.s3_client.upload_part(
+                            Bucket=self.bucket_name,
+                            Key=object_key,
+                            PartNumber=part_number,
+                            UploadId=upload_id,
+                            Body=data
+                        )
+                        parts.append({
+                            'PartNumber': part_number,
+                            'ETag': part['ETag']
+                        })
+                        break
+                    except Exception as e:
+                        if attempt == 2:  # Last attempt
+                            raise
+                        logger.warning(f"Part {part_number} upload failed (attempt {attempt + 1}/3): {str(e)}")
+                        time.sleep(2 ** attempt)  # Exponential backoff
+                
+                part_number += 1
             
             # Complete multipart upload
             result = self.s3_client.complete_multipart_upload(
@@ -260,7 +297,6 @@ class R2Client:
             return {
                 "success": True,
                 "object_key": object_key,
-                "file_size": file_size,
                 "upload_id": upload_id
             }
             
@@ -314,6 +350,86 @@ class R2Client:
             logger.error(f"Unexpected error during download: {str(e)}")
             raise Exception(f"Download failed: {str(e)}")
     
+    def read_file(self, object_key: str) -> bytes:
+        """
+        Read a small object (e.g. a playlist) from R2 storage into memory.
+        
+        Args:
+            object_key: Key/name of the object in R2 storage
+            
+        Returns:
+            bytes: Object contents
+        """
+        try:
+            response = self.s3_client.get_object(Bucket=self.bucket_name, Key=object_key)
+            return response['Body'].read()
+        except ClientError as e:
+            error_code = e.response['Error']['Code']
+            if error_code == 'NoSuchKey':
+                logger.error(f"File not found in R2: {object_key}")
+                raise Exception(f"File not found: {object_key}")
+            logger.error(f"R2 read failed with code {error_code}: {str(e)}")
+            raise Exception(f"R2 read failed: {error_code} - {str(e)}")
+    
+    def set_content_type(self, object_key: str, content_type: str) -> bool:
+        """
+        Replace the Content-Type of an existing object (copies it onto itself).
+        
+        Args:
+            object_key: Key/name of the object
+            content_type: New MIME type
+            
+        Returns:
+            bool: True if the update succeeded
+        """
+        try:
+            self.s3_client.copy_object(
+                Bucket=self.bucket_name,
+                Key=object_key,
+                CopySource={'Bucket': self.bucket_name, 'Key': object_key},
+                ContentType=content_type,
+                MetadataDirective='REPLACE'
+            )
+            logger.info(f"Set content type of {object_key} to {content_type}")
+            return True
+        except ClientError as e:
+            logger.error(f"Failed to set content type of {object_key}: {str(e)}")
+            return False
+    
+    def delete_prefix(self, prefix: str) -> int:
+        """
+        Delete every object whose key starts with prefix.
+        
+        Args:
+            prefix: Key prefix, e.g. "hls/<project_id>/"
+            
+        Returns:
+            int: Number of objects deleted
+            
+        Raises:
+            PartialDeleteError: once every page was tried, if any object could not be deleted
+        """
+        deleted = 0
+        failed_keys = []
+        paginator = self.s3_client.get_paginator('list_objects_v2')
+        
+        for page in paginator.paginate(Bucket=self.bucket_name, Prefix=prefix):
+            keys = [{'Key': obj['Key']} for obj in page.get('Contents', [])]
+            if not keys:
+                continue
+            
+            response = self.s3_client.delete_objects(Bucket=self.bucket_name, Delete={'Objects': keys, 'Quiet': True})
+            errors = response.get('Errors', [])
+            if errors:
+                logger.error(f"Failed to delete {len(errors)} objects under {prefix}: {errors[:3]}")
+                failed_keys.extend(error['Key'] for error in errors)
+            deleted += len(keys) - len(errors)
+        
+        logger.info(f"Deleted {deleted} objects under prefix: {prefix}")
+        if failed_keys:
+            raise PartialDeleteError(prefix, failed_keys)
+        return deleted
+    
     def delete_file(self, object_key: str) -> bool:
         """
         Delete a file from R2 storage.
@@ -344,17 +460,19 @@ class R2Client:
             logger.error(f"Unexpected error during delete: {str(e)}")
             return False
     
-    def get_file_url(self, object_key: str, expires_in: int = 3600) -> str:
+    def get_file_url(self, object_key: str, expires_in: int = None) -> str:
         """
         Generate a presigned URL for accessing a file.
         
         Args:
             object_key: Key/name of the object
-            expires_in: URL expiration time in seconds (default: 1 hour)
+            expires_in: URL expiration time in seconds (default: SIGNED_URL_TTL_SECONDS)
             
         Returns:
             str: Presigned URL
         """
+        expires_in = expires_in or storage_settings.signed_url_ttl
+        
         try:
             url = self.s3_client.generate_presigned_url(
                 'get_object',
@@ -478,31 +596,41 @@ class R2Client:
 
 # Global R2 client instance (lazy-loaded)
 _r2_client_instance = None
+_r2_client_lock = threading.Lock()
 
 def get_r2_client():
-    """Get or initialize the R2 client with lazy loading."""
+    """
+    Get or initialize the R2 client with lazy loading. Safe to call from
+    several threads at once: the client is built and verified once, and only
+    published once verification succeeded.
+    """
     global _r2_client_instance
     
-    if _r2_client_instance is None:
+    if _r2_client_instance is not None:
+        return _r2_client_instance
+    
+    with _r2_client_lock:
+        if _r2_client_instance is not None:
+            return _r2_client_instance
+        
         try:
-            _r2_client_instance = R2Client()
+            client = R2Client()
             logger.info("R2 client initialized successfully")
             
             # Test bucket access and create if needed
-            if _r2_client_instance.create_bucket_if_not_exists():
+            if client.create_bucket_if_not_exists():
                 logger.info("R2 bucket access verified")
                 # Test health
-                health = _r2_client_instance.health_check()
+                health = client.health_check()
                 logger.info(f"R2 health check: {health['status']}")
                 if health['status'] != 'healthy':
                     logger.warning(f"R2 health check warning: {health.get('error', 'Unknown issue')}")
+                _r2_client_instance = client
             else:
                 logger.error("Failed to verify or create R2 bucket")
-                _r2_client_instance = None
                 
         except Exception as e:
             logger.error(f"Failed to initialize R2 client: {e}")
-            _r2_client_instance = None
     
     return _r2_client_instance
 
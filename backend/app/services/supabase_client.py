@@ -8,6 +8,7 @@ from typing import Optional
 import logging
 import time
 from functools import wraps
+from app.core.config import storage_settings, supabase_settings
 
 logger = logging.getLogger(__name__)
 
@@ -43,11 +44,8 @@ class OptimizedSupabaseClient:
     """
     
     def __init__(self):
-        self.url = "https://ghkowjxqwxsikrdivwxl.supabase.co"
-        self.key = os.environ.get("SUPABASE_ANON_KEY")
-        
-        if not self.url or not self.key:
-            raise EnvironmentError("Supabase URL and Key must be set")
+        self.url = supabase_settings.url
+        self.key = supabase_settings.key
         
         # Configure HTTP client with optimized settings for large uploads
         self.http_client = httpx.Client(
@@ -185,8 +183,9 @@ class OptimizedSupabaseClient:
             # Don't raise for file deletion failures
             return False
     
-    def get_file_url(self, bucket: str, path: str, expires_in: int = 3600) -> str:
+    def get_file_url(self, bucket: str, path: str, expires_in: int = None) -> str:
         """Get a signed URL for a file."""
+        expires_in = expires_in or storage_settings.signed_url_ttl
         try:
             response = self.client.storage.from_(bucket).create_signed_url(path, expires_in)
             if 'error' in response:
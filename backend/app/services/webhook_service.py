@@ -0,0 +1,64 @@
+import os
+import hmac
+import json
+import socket
+import hashlib
+import logging
+import ipaddress
+from urllib.parse import urlparse
+import httpx
+
+logger = logging.getLogger(__name__)
+
+SIGNATURE_HEADER = "X-YoVideo-Signature"
+
+class UnsafeCallbackURL(ValueError):
+    """A callback URL that isn't http(s) or points at a private, loopback or link-local address."""
+
+def check_callback_url(url: str):
+    """
+    Resolve a callback URL's host and reject it unless every address it resolves
+    to is public, so webhooks can't be aimed at the metadata service, localhost
+    or other hosts on the internal network.
+    """
+    parsed = urlparse(url)
+    if parsed.scheme not in ("http", "https") or not parsed.hostname:
+        raise UnsafeCallbackURL("callback_url must be an http(s) URL")
+    
+    try:
+        addresses = {info[4][0] for info in socket.getaddrinfo(parsed.hostname, parsed.port or None)}
+    except (socket.gaierror, UnicodeError):
+        raise UnsafeCallbackURL(f"callback_url host {parsed.hostname} could not be resolved")
+    
+    for address in addresses:
+        ip = ipaddress.ip_address(address.split("%")[0])
+        if not ip.is_global or ip.is_multicast:
+            raise UnsafeCallbackURL("callback_url must not point at a private, loopback or link-local address")
+
+def sign_payload(body: bytes, secret: str) -> str:
+    """HMAC-SHA256 signature of a webhook body, formatted as sha256=<hex>."""
+    digest = hmac.new(secret.encode(), body, hashlib.sha256).hexdigest()
+    return f"sha256={digest}"
+
+def deliver_webhook(url: str, payload: dict, timeout: float = 10.0) -> int:
+    """
+    POST a JSON payload to a callback URL, signed with WEBHOOK_SECRET when configured.
+    Raises for network errors and non-2xx responses so the caller can retry, and
+    UnsafeCallbackURL if the host now resolves to an internal address.
+    """
+    check_callback_url(url)
+    
+    body = json.dumps(payload, separators=(",", ":")).encode()
+    headers = {"Content-Type": "application/json"}
+    
+    secret = os.environ.get("WEBHOOK_SECRET")
+    if secret:
+        headers[SIGNATURE_HEADER] = sign_payload(body, secret)
+    else:
+        logger.warning("WEBHOOK_SECRET is not set, sending unsigned webhook")
+    
+    response = httpx.post(url, content=body, headers=headers, timeout=timeout)
+    response.raise_for_status()
+    
+    logger.info(f"Delivered webhook to {url} ({response.status_code})")
+    return response.status_code
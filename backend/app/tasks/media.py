@@ -0,0 +1,585 @@
+import os
+import shutil
+import socket
+import tempfile
+import logging
+import threading
+from datetime import datetime, timedelta, timezone
+from typing import Any, Callable, Optional, Tuple
+from celery.exceptions import SoftTimeLimitExceeded
+from app.core.celery_app import (
+    celery_app, get_job_timeout, should_retry, retry_countdown, user_error_message,
+    PermanentError, JOB_TIMEOUT_MESSAGE, MAX_JOB_RETRIES, PRIORITY_LOW, ACTIVE_JOB_STATUSES,
+    JOB_LEASE_SECONDS
+)
+from app.core.statuses import JobStatus, job_status_sources
+from app.core.temp_storage import ensure_free_space
+from app.core.progress import WeightedProgress
+from app.core.render_cache import render_cache_key, find_cached_render, cache_render
+from app.services.supabase_client import supabase
+from app.services.r2_client import get_r2_client
+from app.services.ffmpeg_service import (
+    generate_thumbnail, transcode, TranscodeOptions, package_hls, overlay_watermark, generate_gif, change_speed,
+    normalize_loudness, rotate_video, reframe_vertical, remove_silence
+)
+from app.tasks.notifications import queue_job_webhooks
+
+# Configure logging
+logging.basicConfig(level=logging.INFO)
+logger = logging.getLogger(__name__)
+
+def download_project_video(project_id: str) -> str:
+    """Download a project's source video from R2 into a temporary file and return its path."""
+    project_response = supabase.table("projects").select("video_path, file_size").eq("id", project_id).execute()
+    
+    if not project_response.data or len(project_response.data) == 0:
+        raise PermanentError(f"No project found with id {project_id}")
+    
+    video_path = project_response.data[0].get("video_path")
+    if not video_path:
+        raise PermanentError(f"No video_path found for project {project_id}")
+    
+    # Room for the source plus an output of about the same size; retried later if the disk is full
+    ensure_free_space(tempfile.gettempdir(), (project_response.data[0].get("file_size") or 0) * 2)
+    
+    with tempfile.NamedTemporaryFile(delete=False, suffix=os.path.splitext(video_path)[1]) as tmp_video_file:
+        tmp_video_file_path = tmp_video_file.name
+    
+    client = get_r2_client()
+    if client is None:
+        raise Exception("Failed to initialize R2 client")
+    
+    logger.info(f"Downloading {video_path} from R2 Storage...")
+    client.download_file(video_path, tmp_video_file_path)
+    
+    return tmp_video_file_path
+
+# Progress a job is set to on entering these statuses
+JOB_STATUS_PROGRESS = {JobStatus.COMPLETED: 1, JobStatus.RETRYING: 0}
+
+def update_job_status(job_id: str, status: str, error_message: str = None):
+    """
+    Update a single processing_jobs record. Only valid transitions apply, so jobs
+    that already finished (or were cancelled) are left alone. Completing a job
+    sets its progress to 1, including jobs whose steps report no progress of
+    their own; a retry starts it again from 0.
+    """
+    update_data = {"status": status}
+    if error_message is not None:
+        update_data["error_message"] = error_message
+    if status in JOB_STATUS_PROGRESS:
+        update_data["progress"] = JOB_STATUS_PROGRESS[status]
+    
+    supabase.table("processing_jobs").update(update_data).eq("id", job_id).in_("status", job_status_sources(status)).execute()
+
+def is_job_cancelled(job_id: str) -> bool:
+    """Whether a processing job was cancelled through the API."""
+    if not job_id:
+        return False
+    response = supabase.table("processing_jobs").select("status").eq("id", job_id).execute()
+    return bool(response.data) and response.data[0].get("status") == JobStatus.CANCELLED
+
+def worker_id() -> str:
+    """Identifies this worker process in processing_jobs.claimed_by."""
+    return f"{socket.gethostname()}:{os.getpid()}"
+
+def claim_job(task, job_id: str) -> bool:
+    """
+    Atomically mark a job as processing by this worker. Only pending or retrying
+    jobs, or processing ones whose heartbeat went stale, can be claimed, so a
+    redelivered task can't run alongside a live one.
+    Returns False when the task should exit: the job already finished, was
+    cancelled or no longer exists, or another worker holds a live lease. In the
+    last case the task is queued again for when the lease would have expired,
+    picking the job up if that worker died.
+    """
+    now = datetime.now(timezone.utc)
+    stale_before = (now - timedelta(seconds=JOB_LEASE_SECONDS)).isoformat()
+    claimed = supabase.table("processing_jobs").update({
+        "status": JobStatus.PROCESSING,
+        "claimed_by": worker_id(),
+        "heartbeat_at": now.isoformat()
+    }).eq("id", job_id).or_(
+        f"status.in.(pending,retrying),heartbeat_at.is.null,heartbeat_at.lt.\"{stale_before}\""
+    ).in_("status", job_status_sources(JobStatus.PROCESSING)).execute()
+    if claimed.data:
+        return True
+    
+    response = supabase.table("processing_jobs").select("status").eq("id", job_id).execute()
+    if not response.data:
+        # Deleted along with its project; there's nothing left to render or upload for
+        logger.warning(f"Skipping job {job_id}, it no longer exists")
+        return False
+    
+    if response.data[0]["status"] not in ACTIVE_JOB_STATUSES:
+        logger.info(f"Skipping job {job_id}, already {response.data[0]['status']}")
+        return False
+    
+    # Queued again under the same task id rather than through task.retry(), which would count
+    # lease waits against the failure retry budget and eventually give up on a job that
+    # still needs a worker if the current holder crashes
+    logger.info(f"Job {job_id} is held by another worker, checking again in {JOB_LEASE_SECONDS}s")
+    task.signature_from_request(task.request, countdown=JOB_LEASE_SECONDS, retries=task.request.retries).apply_async()
+    return False
+
+class JobHeartbeat:
+    """
+    Refresh a claimed job's heartbeat_at in the background until stop() is called.
+    Beats stop landing once another worker has reclaimed the job.
+    """
+    
+    def __init__(self, job_id: str, interval: float = JOB_LEASE_SECONDS / 5):
+        self.job_id = job_id
+        self.interval = interval
+        self._stopped = threading.Event()
+        self._thread = threading.Thread(target=self._run, daemon=True)
+    
+    def start(self) -> "JobHeartbeat":
+        self._thread.start()
+        return self
+    
+    def stop(self):
+        self._stopped.set()
+        self._thread.join()
+    
+    def _run(self):
+        while not self._stopped.wait(self.interval):
+            try:
+                supabase.table("processing_jobs").update({
+                    "heartbeat_at": datetime.now(timezone.utc).isoformat()
+                }).eq("id", self.job_id).eq("claimed_by", worker_id()).in_("status", ACTIVE_JOB_STATUSES).execute()
+            except Exception as e:
+                # A missed beat only matters if it lasts a whole lease
+                logger.warning(f"Failed to refresh heartbeat for job {self.job_id}: {str(e)}")
+
+def complete_from_cache(job_id: str, project_id: str, cache_key: str) -> bool:
+    """
+    Complete a job with the output of an identical earlier render, if one is
+    cached. Returns False when the job has to render for itself.
+    """
+    cached = find_cached_render(cache_key)
+    if cached is None:
+        return False
+    
+    supabase.table("processing_jobs").update({
+        "output_details": {**cached, "cached": True}
+    }).eq("id", job_id).execute()
+    
+    update_job_status(job_id, JobStatus.COMPLETED)
+    queue_job_webhooks(project_id, job_id=job_id)
+    logger.info(f"Completed job {job_id} for project {project_id} from the render cache")
+    return True
+
+class MediaJob:
+    """
+    What a render step gets from run_media_job: the downloaded source video,
+    temporary files that are removed once the job ends, progress reporting,
+    storage and a place to record the job's output_details.
+    Files stored through upload_output are listed in output_details["output_keys"],
+    which is what the render cache checks and project deletion removes.
+    """
+    
+    def __init__(self, project_id: str, job_id: str):
+        self.project_id = project_id
+        self.job_id = job_id
+        self.video_path = None
+        self.output_details = None
+        self.output_keys = []
+        self._temp_paths = []
+    
+    def temp_file(self, suffix: str) -> str:
+        with tempfile.NamedTemporaryFile(suffix=suffix, delete=False) as temp_file:
+            self._temp_paths.append(temp_file.name)
+        return temp_file.name
+    
+    def temp_dir(self, prefix: str) -> str:
+        path = tempfile.mkdtemp(prefix=prefix)
+        self._temp_paths.append(path)
+        return path
+    
+    def report_progress(self, fraction: float):
+        supabase.table("processing_jobs").update({
+            "progress": round(fraction, 4)
+        }).eq("id", self.job_id).execute()
+    
+    def storage(self):
+        client = get_r2_client()
+        if client is None:
+            raise Exception("Failed to initialize R2 client")
+        return client
+    
+    def upload_output(self, local_path: str, storage_key: str, content_type: str):
+        self.storage().upload_file(local_path, storage_key, content_type)
+        self.output_keys.append(storage_key)
+    
+    def save_output(self, output_details: dict):
+        output_details = {**output_details, "output_keys": list(self.output_keys)}
+        self.output_details = output_details
+        supabase.table("processing_jobs").update({
+            "output_details": output_details
+        }).eq("id", self.job_id).execute()
+    
+    def cleanup(self):
+        for path in [self.video_path] + self._temp_paths:
+            if path and os.path.isdir(path):
+                shutil.rmtree(path, ignore_errors=True)
+            elif path and os.path.exists(path):
+                os.unlink(path)
+
+def run_media_job(task, project_id: str, job_id: str, description: str, render: Callable[[MediaJob], Any],
+                  cache_as: Optional[Tuple[str, dict]] = None):
+    """
+    Run a processing job around its render step: claim the job and keep its
+    heartbeat going, download the project's video and call render(job). The job
+    is then completed, or retried or failed if render raised, and its webhook
+    queued; temporary files are removed either way.
+    With cache_as=(job_type, params) an identical earlier render completes the
+    job without running render, and the output_details render saves are cached.
+    Returns what render returned, or None when the job didn't run to completion.
+    """
+    if not claim_job(task, job_id):
+        return None
+    heartbeat = JobHeartbeat(job_id).start()
+    job = MediaJob(project_id, job_id)
+    
+    try:
+        cache_key = None
+        if cache_as:
+            cache_key = render_cache_key(project_id, *cache_as)
+            if complete_from_cache(job_id, project_id, cache_key):
+                return None
+        
+        job.video_path = download_project_video(project_id)
+        result = render(job)
+        if cache_as and job.output_details is not None:
+            cache_render(cache_key, project_id, cache_as[0], job.output_details)
+        
+        update_job_status(job_id, JobStatus.COMPLETED)
+        queue_job_webhooks(project_id, job_id=job_id)
+        return result
+    
+    except Exception as e:
+        if is_job_cancelled(job_id):
+            logger.info(f"{description} cancelled for project {project_id}")
+            return None
+        
+        error_message = JOB_TIMEOUT_MESSAGE if isinstance(e, SoftTimeLimitExceeded) else user_error_message(e)
+        logger.error(f"{description} failed for project {project_id}: {str(e)}", exc_info=True)
+        
+        if should_retry(task, e):
+            attempt = task.request.retries + 1
+            update_job_status(job_id, JobStatus.RETRYING, f"Attempt {attempt}/{task.max_retries + 1} failed: {error_message}")
+            raise task.retry(exc=e, countdown=retry_countdown(task))
+        
+        update_job_status(job_id, JobStatus.FAILED, error_message)
+        queue_job_webhooks(project_id, job_id=job_id)
+        return None
+    
+    finally:
+        heartbeat.stop()
+        job.cleanup()
+
+THUMBNAIL_TIMEOUT = get_job_timeout("thumbnail", 300)
+
+@celery_app.task(bind=True, priority=PRIORITY_LOW, max_retries=MAX_JOB_RETRIES,
+                 soft_time_limit=THUMBNAIL_TIMEOUT, time_limit=THUMBNAIL_TIMEOUT + 60)
+def generate_thumbnail_task(self, project_id: str, job_id: str, at_time: float = 1.0, width: int = 640):
+    logger.info(f"Starting thumbnail generation for project_id: {project_id}")
+    
+    def render(job: MediaJob) -> str:
+        thumbnail_path = job.temp_file('.jpg')
+        generate_thumbnail(job.video_path, thumbnail_path, at_time, width)
+        
+        thumbnail_filename = f"thumbnail_{project_id}.jpg"
+        job.storage().upload_file(thumbnail_path, thumbnail_filename, "image/jpeg")
+        
+        supabase.table("projects").update({
+            "thumbnail_path": thumbnail_filename
+        }).eq("id", project_id).execute()
+        
+        logger.info(f"Thumbnail generated for project {project_id}: {thumbnail_filename}")
+        return thumbnail_filename
+    
+    return run_media_job(self, project_id, job_id, "Thumbnail generation", render)
+
+TRANSCODE_TIMEOUT = get_job_timeout("transcode", 3600)
+
+@celery_app.task(bind=True, priority=PRIORITY_LOW, max_retries=MAX_JOB_RETRIES,
+                 soft_time_limit=TRANSCODE_TIMEOUT, time_limit=TRANSCODE_TIMEOUT + 60)
+def transcode_video_task(self, project_id: str, job_id: str, heights: list, video_codec: str = "libx264",
+                         crf: int = 23, preset: str = "medium", tone_map: str = "auto"):
+    """
+    Encode a project's video at each requested height and upload the variants.
+    The job's output_details maps each resolution (e.g. "720p") to its storage path,
+    plus output_size_bytes for all variants together.
+    """
+    logger.info(f"Starting transcode for project_id: {project_id} at {heights}")
+    
+    def render(job: MediaJob) -> dict:
+        output_details = {}
+        output_size = 0
+        
+        # Each variant is an equal share of the job
+        progress = WeightedProgress({i: 1 for i in range(len(heights))}, job.report_progress)
+        for i, height in enumerate(heights):
+            output_path = job.temp_file('.mp4')
+            
+            options = TranscodeOptions(height=height, video_codec=video_codec, crf=crf, preset=preset, tone_map=tone_map)
+            copied = transcode(job.video_path, output_path, options, progress.step(i))
+            progress.report(i, 1.0)  # Stream copies report no progress of their own
+            
+            resolution = f"{height}p"
+            storage_filename = f"transcode_{project_id}_{resolution}.mp4"
+            job.upload_output(output_path, storage_filename, "video/mp4")
+            output_details[resolution] = storage_filename
+            output_size += os.path.getsize(output_path)
+            logger.info(f"Uploaded {resolution} variant for project {project_id} ({'stream copy' if copied else 'encoded'})")
+        
+        output_details["output_size_bytes"] = output_size
+        job.save_output(output_details)
+        return output_details
+    
+    return run_media_job(self, project_id, job_id, "Transcode", render)
+
+HLS_TIMEOUT = get_job_timeout("hls", 3600)
+
+def hls_prefix(project_id: str) -> str:
+    """Storage prefix holding a project's HLS playlist and segments."""
+    return f"hls/{project_id}/"
+
+@celery_app.task(bind=True, priority=PRIORITY_LOW, max_retries=MAX_JOB_RETRIES,
+                 soft_time_limit=HLS_TIMEOUT, time_limit=HLS_TIMEOUT + 60)
+def package_hls_task(self, project_id: str, job_id: str, segment_duration: int = 6):
+    """Package a project's video as HLS and upload the playlist and segments under hls/<project_id>/."""
+    logger.info(f"Starting HLS packaging for project_id: {project_id}")
+    
+    def render(job: MediaJob) -> str:
+        output_dir = job.temp_dir(f"hls_{project_id}_")
+        playlist_file = package_hls(job.video_path, output_dir, segment_duration, job.report_progress)
+        
+        client = job.storage()
+        
+        # Replace any previous packaging so stale segments don't linger
+        prefix = hls_prefix(project_id)
+        client.delete_prefix(prefix)
+        
+        segments = sorted(name for name in os.listdir(output_dir) if name.endswith('.ts'))
+        for name in segments:
+            client.upload_file(os.path.join(output_dir, name), f"{prefix}{name}", "video/mp2t")
+        
+        # Upload the playlist last so it never references missing segments
+        playlist_key = f"{prefix}{os.path.basename(playlist_file)}"
+        client.upload_file(playlist_file, playlist_key, "application/vnd.apple.mpegurl")
+        
+        supabase.table("projects").update({
+            "hls_playlist_path": playlist_key
+        }).eq("id", project_id).execute()
+        
+        logger.info(f"HLS packaged for project {project_id}: {len(segments)} segments")
+        return playlist_key
+    
+    return run_media_job(self, project_id, job_id, "HLS packaging", render)
+
+WATERMARK_TIMEOUT = get_job_timeout("watermark", 3600)
+
+@celery_app.task(bind=True, priority=PRIORITY_LOW, max_retries=MAX_JOB_RETRIES,
+                 soft_time_limit=WATERMARK_TIMEOUT, time_limit=WATERMARK_TIMEOUT + 60)
+def overlay_watermark_task(self, project_id: str, job_id: str, watermark_key: str, position: str = "br",
+                           opacity: float = 0.8, scale: float = 0.15):
+    """Burn the uploaded watermark image into a project's video and upload the result."""
+    logger.info(f"Starting watermark overlay for project_id: {project_id}")
+    
+    def render(job: MediaJob) -> str:
+        client = job.storage()
+        
+        watermark_path = job.temp_file(os.path.splitext(watermark_key)[1])
+        client.download_file(watermark_key, watermark_path)
+        
+        output_path = job.temp_file('.mp4')
+        overlay_watermark(job.video_path, watermark_path, output_path, position, opacity, scale, job.report_progress)
+        
+        watermarked_filename = f"watermarked_{project_id}.mp4"
+        job.upload_output(output_path, watermarked_filename, "video/mp4")
+        # Uploaded by the API for this job, so it goes when the job's outputs do
+        job.output_keys.append(watermark_key)
+        
+        job.save_output({
+            "video": watermarked_filename,
+            "watermark_image": watermark_key,
+            "output_size_bytes": os.path.getsize(output_path)
+        })
+        
+        logger.info(f"Watermarked video uploaded for project {project_id}: {watermarked_filename}")
+        return watermarked_filename
+    
+    return run_media_job(self, project_id, job_id, "Watermark overlay", render)
+
+GIF_TIMEOUT = get_job_timeout("gif", 300)
+
+@celery_app.task(bind=True, priority=PRIORITY_LOW, max_retries=MAX_JOB_RETRIES,
+                 soft_time_limit=GIF_TIMEOUT, time_limit=GIF_TIMEOUT + 60)
+def generate_gif_task(self, project_id: str, job_id: str, start: float = 0.0, duration: float = 3.0,
+                      fps: int = 12, width: int = 480):
+    """Render a short looping GIF of a project's video. output_details records its storage path and size."""
+    logger.info(f"Starting GIF generation for project_id: {project_id}")
+    
+    def render(job: MediaJob) -> str:
+        gif_path = job.temp_file('.gif')
+        generate_gif(job.video_path, gif_path, start, duration, fps, width)
+        
+        # One file per job, so several GIFs of the same project can coexist
+        gif_filename = f"gif_{project_id}_{job_id}.gif"
+        job.upload_output(gif_path, gif_filename, "image/gif")
+        
+        job.save_output({"gif": gif_filename, "output_size_bytes": os.path.getsize(gif_path)})
+        
+        logger.info(f"GIF generated for project {project_id}: {gif_filename}")
+        return gif_filename
+    
+    params = {"start": start, "duration": duration, "fps": fps, "width": width}
+    return run_media_job(self, project_id, job_id, "GIF generation", render, cache_as=("gif", params))
+
+SPEED_TIMEOUT = get_job_timeout("speed", 3600)
+
+@celery_app.task(bind=True, priority=PRIORITY_LOW, max_retries=MAX_JOB_RETRIES,
+                 soft_time_limit=SPEED_TIMEOUT, time_limit=SPEED_TIMEOUT + 60)
+def change_speed_task(self, project_id: str, job_id: str, factor: float):
+    """Render a sped-up or slowed-down copy of a project's video. output_details records its storage path and size."""
+    logger.info(f"Starting speed change x{factor} for project_id: {project_id}")
+    
+    def render(job: MediaJob) -> str:
+        output_path = job.temp_file('.mp4')
+        change_speed(job.video_path, output_path, factor, job.report_progress)
+        
+        # One file per job, so several speeds of the same project can coexist
+        speed_filename = f"speed_{project_id}_{job_id}.mp4"
+        job.upload_output(output_path, speed_filename, "video/mp4")
+        
+        job.save_output({
+            "video": speed_filename,
+            "factor": factor,
+            "output_size_bytes": os.path.getsize(output_path)
+        })
+        
+        logger.info(f"Speed-changed video uploaded for project {project_id}: {speed_filename}")
+        return speed_filename
+    
+    return run_media_job(self, project_id, job_id, "Speed change", render, cache_as=("speed", {"factor": factor}))
+
+LOUDNESS_TIMEOUT = get_job_timeout("loudness", 3600)
+
+@celery_app.task(bind=True, priority=PRIORITY_LOW, max_retries=MAX_JOB_RETRIES,
+                 soft_time_limit=LOUDNESS_TIMEOUT, time_limit=LOUDNESS_TIMEOUT + 60)
+def normalize_loudness_task(self, project_id: str, job_id: str, target_lufs: float):
+    """
+    Render a copy of a project's video with its audio normalized to target_lufs.
+    output_details records its storage path and size along with the measured input loudness.
+    """
+    logger.info(f"Starting loudness normalization to {target_lufs} LUFS for project_id: {project_id}")
+    
+    def render(job: MediaJob) -> str:
+        output_path = job.temp_file('.mp4')
+        stats = normalize_loudness(job.video_path, output_path, target_lufs, job.report_progress)
+        
+        normalized_filename = f"loudness_{project_id}_{job_id}.mp4"
+        job.upload_output(output_path, normalized_filename, "video/mp4")
+        
+        job.save_output({
+            "video": normalized_filename,
+            "target_lufs": target_lufs,
+            "measured_lufs": float(stats["input_i"]),
+            "output_size_bytes": os.path.getsize(output_path)
+        })
+        
+        logger.info(f"Normalized video uploaded for project {project_id}: {normalized_filename} ({stats['input_i']} -> {target_lufs} LUFS)")
+        return normalized_filename
+    
+    return run_media_job(self, project_id, job_id, "Loudness normalization", render,
+                         cache_as=("loudness", {"target_lufs": target_lufs}))
+
+ROTATE_TIMEOUT = get_job_timeout("rotate", 3600)
+
+@celery_app.task(bind=True, priority=PRIORITY_LOW, max_retries=MAX_JOB_RETRIES,
+                 soft_time_limit=ROTATE_TIMEOUT, time_limit=ROTATE_TIMEOUT + 60)
+def rotate_video_task(self, project_id: str, job_id: str, degrees: int):
+    """Render a copy of a project's video rotated clockwise by degrees. output_details records its storage path and size."""
+    logger.info(f"Starting {degrees} degree rotation for project_id: {project_id}")
+    
+    def render(job: MediaJob) -> str:
+        output_path = job.temp_file('.mp4')
+        rotate_video(job.video_path, output_path, degrees, job.report_progress)
+        
+        rotated_filename = f"rotated_{project_id}_{job_id}.mp4"
+        job.upload_output(output_path, rotated_filename, "video/mp4")
+        
+        job.save_output({
+            "video": rotated_filename,
+            "degrees": degrees,
+            "output_size_bytes": os.path.getsize(output_path)
+        })
+        
+        logger.info(f"Rotated video uploaded for project {project_id}: {rotated_filename}")
+        return rotated_filename
+    
+    return run_media_job(self, project_id, job_id, "Rotation", render, cache_as=("rotate", {"degrees": degrees}))
+
+REFRAME_TIMEOUT = get_job_timeout("reframe", 3600)
+
+@celery_app.task(bind=True, priority=PRIORITY_LOW, max_retries=MAX_JOB_RETRIES,
+                 soft_time_limit=REFRAME_TIMEOUT, time_limit=REFRAME_TIMEOUT + 60)
+def reframe_video_task(self, project_id: str, job_id: str, smart_crop: bool = True):
+    """
+    Render a 9:16 copy of a project's video, cropped to follow the action when smart_crop
+    is set. output_details records its storage path, size and the crop centers used.
+    """
+    logger.info(f"Starting vertical reframe for project_id: {project_id} (smart_crop={smart_crop})")
+    
+    def render(job: MediaJob) -> str:
+        output_path = job.temp_file('.mp4')
+        windows = reframe_vertical(job.video_path, output_path, smart_crop, job.report_progress)
+        
+        reframed_filename = f"vertical_{project_id}_{job_id}.mp4"
+        job.upload_output(output_path, reframed_filename, "video/mp4")
+        
+        job.save_output({
+            "video": reframed_filename,
+            "smart_crop": smart_crop,
+            "crop_windows": [{"start": window.start, "center": round(window.center, 4)} for window in windows],
+            "output_size_bytes": os.path.getsize(output_path)
+        })
+        
+        logger.info(f"Reframed video uploaded for project {project_id}: {reframed_filename}")
+        return reframed_filename
+    
+    return run_media_job(self, project_id, job_id, "Reframe", render, cache_as=("reframe", {"smart_crop": smart_crop}))
+
+TRIM_SILENCE_TIMEOUT = get_job_timeout("trim_silence", 3600)
+
+@celery_app.task(bind=True, priority=PRIORITY_LOW, max_retries=MAX_JOB_RETRIES,
+                 soft_time_limit=TRIM_SILENCE_TIMEOUT, time_limit=TRIM_SILENCE_TIMEOUT + 60)
+def trim_silence_task(self, project_id: str, job_id: str, noise_db: float, min_duration: float):
+    """
+    Render a copy of a project's video with its silences cut out. output_details
+    records its storage path, size, and how many seconds of silence were removed.
+    """
+    logger.info(f"Starting silence trim for project_id: {project_id} ({noise_db}dB, {min_duration}s)")
+    
+    def render(job: MediaJob) -> str:
+        output_path = job.temp_file('.mp4')
+        silences = remove_silence(job.video_path, output_path, noise_db, min_duration, job.report_progress)
+        
+        trimmed_filename = f"trimmed_{project_id}_{job_id}.mp4"
+        job.upload_output(output_path, trimmed_filename, "video/mp4")
+        
+        job.save_output({
+            "video": trimmed_filename,
+            "silences": len(silences),
+            "silence_seconds": round(sum(silence.duration for silence in silences), 3),
+            "output_size_bytes": os.path.getsize(output_path)
+        })
+        
+        logger.info(f"Trimmed video uploaded for project {project_id}: {trimmed_filename}")
+        return trimmed_filename
+    
+    params = {"noise_db": noise_db, "min_duration": min_duration}
+    return run_media_job(self, project_id, job_id, "Silence trim", render, cache_as=("trim_silence", params))
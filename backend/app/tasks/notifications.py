@@ -0,0 +1,57 @@
+import logging
+from app.core.celery_app import celery_app, PRIORITY_LOW
+from app.services.supabase_client import supabase
+from app.services.webhook_service import deliver_webhook, UnsafeCallbackURL
+
+# Configure logging
+logging.basicConfig(level=logging.INFO)
+logger = logging.getLogger(__name__)
+
+# Webhooks run on their own low-priority tasks so a slow receiver never holds up a processing job
+@celery_app.task(bind=True, priority=PRIORITY_LOW, max_retries=5, soft_time_limit=60, time_limit=90)
+def send_job_webhook_task(self, job_id: str):
+    job_response = supabase.table("processing_jobs").select("*").eq("id", job_id).execute()
+    
+    if not job_response.data:
+        logger.warning(f"Skipping webhook for unknown job {job_id}")
+        return
+    
+    job = job_response.data[0]
+    callback_url = job.get("callback_url")
+    if not callback_url:
+        return
+    
+    payload = {
+        "job_id": job["id"],
+        "project_id": job["project_id"],
+        "job_type": job["job_type"],
+        "status": job["status"],
+        "error": job.get("error_message"),
+        # Where the rendered files are, so callers don't have to poll the job for them
+        "output_details": job.get("output_details")
+    }
+    
+    try:
+        deliver_webhook(callback_url, payload)
+    except UnsafeCallbackURL as e:
+        # Retrying won't make the address public
+        logger.error(f"Not delivering webhook for job {job_id}: {str(e)}")
+    except Exception as e:
+        logger.error(f"Webhook delivery for job {job_id} failed (attempt {self.request.retries + 1}): {str(e)}")
+        raise self.retry(exc=e, countdown=5 * (2 ** self.request.retries))
+
+def queue_job_webhooks(project_id: str, job_type: str = None, job_id: str = None):
+    """Queue webhook deliveries for a project's finished jobs that registered a callback_url."""
+    try:
+        query = supabase.table("processing_jobs").select("id, callback_url").eq("project_id", project_id)
+        if job_type:
+            query = query.eq("job_type", job_type)
+        if job_id:
+            query = query.eq("id", job_id)
+        
+        for job in query.execute().data or []:
+            if job.get("callback_url"):
+                send_job_webhook_task.delay(job["id"])
+    except Exception as e:
+        # Notification problems must never fail the job itself
+        logger.error(f"Failed to queue webhooks for project {project_id}: {str(e)}")
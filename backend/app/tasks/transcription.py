@@ -1,46 +1,110 @@
 import os
+import shutil
 import tempfile
 import logging
 import subprocess
 import json
+import re
+import threading
+import time
+from typing import Callable, Optional
 from celery import current_task
-from app.core.celery_app import celery_app
+from celery.exceptions import SoftTimeLimitExceeded
+from app.core.celery_app import (
+    celery_app, get_job_timeout, should_retry, retry_countdown, user_error_message,
+    PermanentError, JOB_TIMEOUT_MESSAGE, MAX_JOB_RETRIES, PRIORITY_HIGH, ACTIVE_JOB_STATUSES
+)
+from app.core.statuses import ProjectStatus, JobStatus, project_status_sources, job_status_sources
 from app.services.supabase_client import supabase
 from app.services.r2_client import get_r2_client
 from app.services.caption_service import segments_to_ass
+from app.tasks.notifications import queue_job_webhooks
+from app.tasks.media import is_job_cancelled, claim_job, JobHeartbeat
+from app.core.progress import WeightedProgress
+from app.services.ffmpeg_service import get_video_duration, has_audio_stream, extract_audio, burn_captions, NoAudioStreamError
 
 # Configure logging
 logging.basicConfig(level=logging.INFO)
 logger = logging.getLogger(__name__)
 
-def run_whisper_subprocess(video_path):
-    """Run whisper via subprocess to avoid memory issues."""
+# Segment lines whisper prints with --verbose True, e.g. "[00:01.000 --> 00:04.500]  Hello there"
+WHISPER_SEGMENT_PATTERN = re.compile(r"^\[((?:\d+:)?\d+:\d+\.\d+) --> ((?:\d+:)?\d+:\d+\.\d+)\]\s*(.*)$")
+
+def parse_whisper_timestamp(timestamp: str) -> float:
+    """Convert whisper's [HH:]MM:SS.mmm timestamps to seconds."""
+    seconds = 0.0
+    for part in timestamp.split(":"):
+        seconds = seconds * 60 + float(part)
+    return seconds
+
+def run_whisper_subprocess(video_path, output_dir: str, on_segment: Optional[Callable[[dict], None]] = None,
+                           language: Optional[str] = None, word_timestamps: bool = True):
+    """
+    Run whisper via subprocess to avoid memory issues, writing its JSON into
+    output_dir (a directory of the caller's job). Whisper detects the
+    language itself unless a language hint is given. With word_timestamps
+    each segment in the result also carries a "words" list of timed words.
+    Segments are passed to on_segment as whisper prints them, so callers can
+    persist partial results; the JSON written at the end is the final result.
+    """
     try:
         # Set up environment with virtual environment PATH
         env = os.environ.copy()
         venv_bin = os.path.join(os.path.dirname(os.path.dirname(os.path.dirname(__file__))), '.venv', 'bin')
         env['PATH'] = f"{venv_bin}:{env.get('PATH', '')}"
+        # Print segments as they're decoded rather than when the buffer fills
+        env['PYTHONUNBUFFERED'] = '1'
         
-        # Use whisper CLI with JSON output
+        # Use whisper CLI with JSON output, printing segments as they're produced
         cmd = [
             'whisper', video_path,
             '--model', 'tiny',
             '--output_format', 'json',
-            '--output_dir', '/tmp',
+            '--output_dir', output_dir,
             '--fp16', 'False',
-            '--verbose', 'False'
+            '--verbose', 'True'
         ]
+        if language:
+            cmd += ['--language', language]
+        if word_timestamps:
+            cmd += ['--word_timestamps', 'True']
         
         logger.info(f"Running whisper command: {' '.join(cmd)}")
-        result = subprocess.run(cmd, capture_output=True, text=True, timeout=300, env=env)
+        process = subprocess.Popen(cmd, stdout=subprocess.PIPE, stderr=subprocess.PIPE, text=True, env=env)
         
-        if result.returncode != 0:
-            logger.error(f"Whisper subprocess failed: {result.stderr}")
-            raise Exception(f"Whisper failed: {result.stderr}")
+        # Drain stderr in the background so a chatty whisper can't block on a full pipe
+        stderr_lines = []
+        stderr_thread = threading.Thread(target=lambda: stderr_lines.extend(process.stderr), daemon=True)
+        stderr_thread.start()
+        
+        # No timer of its own: the task's soft_time_limit (TRANSCRIPTION_TIMEOUT_SECONDS)
+        # bounds whisper, and the kill below stops it when that fires
+        try:
+            for line in process.stdout:
+                match = WHISPER_SEGMENT_PATTERN.match(line.strip())
+                if match and on_segment:
+                    on_segment({
+                        "start": parse_whisper_timestamp(match.group(1)),
+                        "end": parse_whisper_timestamp(match.group(2)),
+                        "text": match.group(3)
+                    })
+            process.wait()
+        except BaseException:
+            # Don't leave whisper running if the task is interrupted (e.g. cancelled or timed out)
+            process.kill()
+            process.wait()
+            raise
+        
+        stderr_thread.join()
+        stderr = ''.join(stderr_lines)
+        
+        if process.returncode != 0:
+            logger.error(f"Whisper subprocess failed: {stderr}")
+            raise Exception(f"Whisper failed: {stderr}")
         
         # Read the JSON output
         video_name = os.path.splitext(os.path.basename(video_path))[0]
-        json_path = f"/tmp/{video_name}.json"
+        json_path = os.path.join(output_dir, f"{video_name}.json")
         
         if not os.path.exists(json_path):
             raise Exception(f"Whisper output file not found: {json_path}")
@@ -53,33 +117,95 @@ def run_whisper_subprocess(video_path):
         logger.info(f"Parsed Whisper result keys: {list(whisper_result.keys())}")
         logger.info(f"Whisper segments count: {len(whisper_result.get('segments', []))}")
         
-        # Clean up the JSON file
-        os.remove(json_path)
-        
         return whisper_result
         
-    except subprocess.TimeoutExpired:
-        logger.error("Whisper subprocess timed out")
-        raise Exception("Transcription timed out")
     except Exception as e:
         logger.error(f"Whisper subprocess error: {str(e)}")
         raise
 
-@celery_app.task(bind=True)
-def transcribe_video_task(self, project_id: str):
+def save_transcription(project_id: str, transcription_data: dict):
+    """Replace any transcription from an earlier attempt so retries don't duplicate rows."""
+    supabase.table("transcriptions").delete().eq("project_id", project_id).execute()
+    supabase.table("transcriptions").insert(transcription_data).execute()
+
+# Relative share of a transcription job's progress covered by whisper and by the caption overlay
+TRANSCRIPTION_PROGRESS_WEIGHTS = {"whisper": 1, "captions": 1}
+
+# Minimum seconds between saves of a partial transcript
+PARTIAL_SAVE_INTERVAL = 5.0
+
+def update_transcription_job_progress(job_id: str, progress: float):
+    supabase.table("processing_jobs").update({
+        "progress": round(progress, 4)
+    }).eq("id", job_id).in_("status", ACTIVE_JOB_STATUSES).execute()
+
+class PartialTranscriptWriter:
+    """
+    Collects segments as whisper produces them and periodically saves them as a
+    partial transcription, so the UI can show captions before whisper finishes
+    and a timeout doesn't lose everything. The final result replaces it.
+    """
+    
+    def __init__(self, project_id: str, duration: float, language: Optional[str] = None,
+                 on_progress: Optional[Callable[[float], None]] = None):
+        self.project_id = project_id
+        self.duration = duration
+        self.language = language
+        self.on_progress = on_progress
+        self.segments = []
+        self._last_saved = 0.0
+    
+    def add_segment(self, segment: dict):
+        self.segments.append({"id": len(self.segments), **segment})
+        
+        now = time.monotonic()
+        if now - self._last_saved < PARTIAL_SAVE_INTERVAL:
+            return
+        self._last_saved = now
+        
+        try:
+            save_transcription(self.project_id, {
+                "project_id": self.project_id,
+                "transcription_data": {
+                    "text": " ".join(s["text"] for s in self.segments).strip(),
+                    "segments": self.segments,
+                    "language": self.language,
+                    "partial": True
+                },
+                "srt_content": ""
+            })
+            if self.duration > 0 and self.on_progress:
+                self.on_progress(min(segment["end"] / self.duration, 1.0))
+        except Exception as e:
+            # Partial results are best-effort; the final save is what matters
+            logger.warning(f"Failed to save partial transcription for project {self.project_id}: {str(e)}")
+
+TRANSCRIPTION_TIMEOUT = get_job_timeout("transcription", 1500)
+
+@celery_app.task(bind=True, priority=PRIORITY_HIGH, max_retries=MAX_JOB_RETRIES,
+                 soft_time_limit=TRANSCRIPTION_TIMEOUT, time_limit=TRANSCRIPTION_TIMEOUT + 60)
+def transcribe_video_task(self, project_id: str, caption_style: dict = None, audio_track: int = 0,
+                          language: str = None, word_timestamps: bool = True):
     logger.info(f"Starting transcription for project_id: {project_id}")
+    
+    # Jobs created by /transcribe are queued with their job id as the task id. Every job update
+    # filters on it, so a cancelled run that is still winding down can't touch a newer job
+    job_id = self.request.id
+    if not claim_job(self, job_id):
+        return
+    heartbeat = JobHeartbeat(job_id).start()
 
     try:
         # 1. Get video path from the projects table
         project_response = supabase.table("projects").select("video_path").eq("id", project_id).execute()
         
         if not project_response.data or len(project_response.data) == 0:
-            raise ValueError(f"No project found with id {project_id}")
+            raise PermanentError(f"No project found with id {project_id}")
             
         video_path = project_response.data[0].get("video_path")
 
         if not video_path:
-            raise ValueError(f"No video_path found for project {project_id}")
+            raise PermanentError(f"No video_path found for project {project_id}")
 
         # 2. Download video from R2 Storage
         with tempfile.NamedTemporaryFile(delete=False, suffix=os.path.splitext(video_path)[1]) as tmp_video_file:
@@ -106,35 +232,53 @@ def transcribe_video_task(self, project_id: str):
             raise Exception("Downloaded video file is empty")
             
         # Check if file has audio using ffprobe
+        transcription_input_path = tmp_video_file_path
         try:
-            ffprobe_cmd = [
-                'ffprobe', '-v', 'quiet', '-select_streams', 'a:0', 
-                '-show_entries', 'stream=codec_type', '-of', 'csv=p=0', 
-                tmp_video_file_path
-            ]
-            result = subprocess.run(ffprobe_cmd, capture_output=True, text=True, timeout=30)
-            has_audio = result.stdout.strip() == 'audio'
+            has_audio = has_audio_stream(tmp_video_file_path)
             logger.info(f"Video has audio track: {has_audio}")
             
-            if not has_audio:
+            if has_audio:
+                # Whisper only needs the speech, so hand it a small mono audio file instead of the full video
+                tmp_audio_file_path = f"{os.path.splitext(tmp_video_file_path)[0]}_audio.mp3"
+                extract_audio(tmp_video_file_path, tmp_audio_file_path, track_index=audio_track)
+                transcription_input_path = tmp_audio_file_path
+                logger.info(f"Extracted audio to {tmp_audio_file_path} ({os.path.getsize(tmp_audio_file_path)} bytes)")
+            else:
                 logger.warning("Video file has no audio track - transcription will be empty")
                 # Still proceed but with a warning
                 
+        except (SoftTimeLimitExceeded, NoAudioStreamError):
+            # A requested audio track that doesn't exist must fail rather than silently use another
+            raise
         except Exception as probe_error:
-            logger.warning(f"Could not probe video file: {probe_error}")
-            # Continue anyway
+            logger.warning(f"Could not probe or extract audio from video file: {probe_error}")
+            # Continue anyway with the full video
 
         # 3. Transcribe the video file
-        logger.info(f"Starting transcription for {tmp_video_file_path}...")
+        logger.info(f"Starting transcription for {transcription_input_path}...")
         
         # Update project status to processing
         supabase.table("projects").update({
-            "status": "processing"
-        }).eq("id", project_id).execute()
+            "status": ProjectStatus.PROCESSING
+        }).eq("id", project_id).in_("status", project_status_sources(ProjectStatus.PROCESSING)).execute()
         
         try:
-            # Run whisper via subprocess
-            result = run_whisper_subprocess(tmp_video_file_path)
+            duration = get_video_duration(tmp_video_file_path)
+        except Exception as probe_error:
+            logger.warning(f"Could not determine video duration, transcription progress will not be reported: {probe_error}")
+            duration = 0.0
+        
+        progress = WeightedProgress(
+            TRANSCRIPTION_PROGRESS_WEIGHTS, lambda fraction: update_transcription_job_progress(job_id, fraction)
+        )
+        partial_writer = PartialTranscriptWriter(project_id, duration, language, progress.step("whisper"))
+        
+        try:
+            # Run whisper via subprocess, saving segments as they arrive. Its output goes in a
+            # directory of this job's under TEMP_DIR, so concurrent jobs can't read each other's
+            whisper_output_dir = tempfile.mkdtemp(prefix=f"whisper_{job_id}_")
+            result = run_whisper_subprocess(transcription_input_path, whisper_output_dir, on_segment=partial_writer.add_segment,
+                                            language=language, word_timestamps=word_timestamps)
             
             # Extract transcription text and segments
             transcription_text = result["text"]
@@ -154,6 +298,13 @@ def transcribe_video_task(self, project_id: str):
         segments = result.get("segments", [])
         transcription_text = result.get("text", "").strip()
         
+        # Record the hinted language, or whatever whisper detected
+        detected_language = language or result.get("language")
+        if detected_language:
+            supabase.table("projects").update({
+                "language": detected_language
+            }).eq("id", project_id).execute()
+        
         if not segments and not transcription_text:
             logger.warning("Whisper produced no segments or text - likely no audible speech in video")
             # Create a minimal transcription entry to avoid breaking the workflow
@@ -162,23 +313,26 @@ def transcribe_video_task(self, project_id: str):
                 "transcription_data": {
                     "text": "",
                     "segments": [],
-                    "language": result.get("language", "en")
+                    "language": detected_language or "en"
                 },
                 "srt_content": ""
             }
             
-            supabase.table("transcriptions").insert(transcription_data).execute()
+            save_transcription(project_id, transcription_data)
             logger.info(f"Saved empty transcription to database for project {project_id}")
             
             # Update project status to completed (no caption overlay needed)
             supabase.table("projects").update({
-                "status": "completed"
-            }).eq("id", project_id).execute()
+                "status": ProjectStatus.COMPLETED,
+                "error_message": None
+            }).eq("id", project_id).in_("status", project_status_sources(ProjectStatus.COMPLETED)).execute()
             
             # Update processing job status to completed
             supabase.table("processing_jobs").update({
-                "status": "completed"
-            }).eq("project_id", project_id).execute()
+                "status": JobStatus.COMPLETED,
+                "progress": 1
+            }).eq("id", job_id).in_("status", job_status_sources(JobStatus.COMPLETED)).execute()
+            queue_job_webhooks(project_id, job_id=job_id)
             
             logger.info(f"Transcription completed for project {project_id} (no speech detected)")
             return
@@ -189,7 +343,7 @@ def transcribe_video_task(self, project_id: str):
             raise Exception("Transcription produced no segments")
         
         # Use ASS format for better animation capabilities
-        ass_content = segments_to_ass(segments)
+        ass_content = segments_to_ass(segments, caption_style)
         logger.info(f"Generated ASS content length: {len(ass_content)}")
         if len(ass_content) == 0:
             logger.error("ASS content is empty despite having segments")
@@ -202,55 +356,80 @@ def transcribe_video_task(self, project_id: str):
             "transcription_data": {
                 "text": transcription_text,
                 "segments": result["segments"],
-                "language": result.get("language", "en")
+                "language": detected_language or "en"
             },
             "srt_content": ass_content
         }
         
-        supabase.table("transcriptions").insert(transcription_data).execute()
+        save_transcription(project_id, transcription_data)
         logger.info(f"Saved transcription to database for project {project_id}")
 
         # 5. Generate video with caption overlay
         logger.info(f"Starting caption overlay for project {project_id}")
-        processed_video_path = generate_caption_overlay(project_id, tmp_video_file.name, ass_content)
+        processed_video_path = generate_caption_overlay(project_id, tmp_video_file.name, ass_content, progress.step("captions"))
         
         if processed_video_path:
             logger.info(f"Caption overlay completed for project {project_id}")
         
         # 6. Update project status to completed
         supabase.table("projects").update({
-            "status": "completed"
-        }).eq("id", project_id).execute()
+            "status": ProjectStatus.COMPLETED,
+            "error_message": None
+        }).eq("id", project_id).in_("status", project_status_sources(ProjectStatus.COMPLETED)).execute()
 
         # 7. Update processing job status to completed
         supabase.table("processing_jobs").update({
-            "status": "completed"
-        }).eq("project_id", project_id).execute()
+            "status": JobStatus.COMPLETED,
+            "progress": 1
+        }).eq("id", job_id).in_("status", job_status_sources(JobStatus.COMPLETED)).execute()
+        queue_job_webhooks(project_id, job_id=job_id)
 
         logger.info(f"Transcription and caption overlay completed for project {project_id}")
 
     except Exception as e:
-        error_message = str(e)
-        logger.error(f"Transcription failed for project {project_id}: {error_message}", exc_info=True)
+        if is_job_cancelled(job_id):
+            logger.info(f"Transcription cancelled for project {project_id}")
+            return
+        
+        error_message = JOB_TIMEOUT_MESSAGE if isinstance(e, SoftTimeLimitExceeded) else user_error_message(e)
+        logger.error(f"Transcription failed for project {project_id}: {str(e)}", exc_info=True)
+        
+        if should_retry(self, e):
+            attempt = self.request.retries + 1
+            supabase.table("processing_jobs").update({
+                "status": JobStatus.RETRYING,
+                "error_message": f"Attempt {attempt}/{self.max_retries + 1} failed: {error_message}",
+                "progress": 0
+            }).eq("id", job_id).in_("status", job_status_sources(JobStatus.RETRYING)).execute()
+            raise self.retry(exc=e, countdown=retry_countdown(self))
         
         # Update processing job status to failed
         supabase.table("processing_jobs").update({
-            "status": "failed",
+            "status": JobStatus.FAILED,
             "error_message": error_message
-        }).eq("project_id", project_id).execute()
+        }).eq("id", job_id).in_("status", job_status_sources(JobStatus.FAILED)).execute()
+        queue_job_webhooks(project_id, job_id=job_id)
         
-        # Update project status to failed
+        # Update project status to failed with a message the frontend can show
         supabase.table("projects").update({
-            "status": "failed"
-        }).eq("id", project_id).execute()
+            "status": ProjectStatus.FAILED,
+            "error_message": user_error_message(e)
+        }).eq("id", project_id).in_("status", project_status_sources(ProjectStatus.FAILED)).execute()
 
     finally:
+        heartbeat.stop()
+        
         # Clean up temporary video file
         if 'tmp_video_file' in locals() and os.path.exists(tmp_video_file.name):
             os.unlink(tmp_video_file.name)
+        if 'tmp_audio_file_path' in locals() and os.path.exists(tmp_audio_file_path):
+            os.unlink(tmp_audio_file_path)
+        if 'whisper_output_dir' in locals():
+            shutil.rmtree(whisper_output_dir, ignore_errors=True)
 
 
-def generate_caption_overlay(project_id: str, input_video_path: str, ass_content: str) -> str:
+def generate_caption_overlay(project_id: str, input_video_path: str, ass_content: str,
+                             on_progress: Optional[Callable[[float], None]] = None) -> str:
     """Generate a video with caption overlay using FFmpeg."""
     ass_file_path = None
     output_video_path = None
@@ -277,48 +456,15 @@ def generate_caption_overlay(project_id: str, input_video_path: str, ass_content
         with tempfile.NamedTemporaryFile(suffix='.mp4', delete=False) as output_file:
             output_video_path = output_file.name
 
-        # FFmpeg command to overlay captions using ASS format for animations
-        ffmpeg_cmd = [
-            'ffmpeg',
-            '-i', input_video_path,
-            '-vf', f"ass={ass_file_path}",
-            '-c:a', 'copy',  # Copy audio without re-encoding
-            '-c:v', 'libx264',  # Use H.264 for video
-            '-preset', 'medium',  # Balance between speed and quality
-            '-crf', '23',  # Good quality setting
-            '-y',  # Overwrite output file
-            output_video_path
-        ]
-
-        logger.info(f"Running FFmpeg command: {' '.join(ffmpeg_cmd)}")
-        
         # Update project status to indicate caption overlay is starting
         supabase.table("projects").update({
-            "status": "adding_captions"
-        }).eq("id", project_id).execute()
-        
-        # Run FFmpeg with progress monitoring
-        process = subprocess.Popen(
-            ffmpeg_cmd,
-            stdout=subprocess.PIPE,
-            stderr=subprocess.PIPE,
-            text=True,
-            universal_newlines=True
-        )
+            "status": ProjectStatus.ADDING_CAPTIONS
+        }).eq("id", project_id).in_("status", project_status_sources(ProjectStatus.ADDING_CAPTIONS)).execute()
         
-        # Capture all output
-        stdout, stderr = process.communicate()
-        
-        logger.info(f"FFmpeg stdout: {stdout}")
-        logger.info(f"FFmpeg stderr: {stderr}")
-        
-        if process.returncode != 0:
-            logger.error(f"FFmpeg failed with return code {process.returncode}")
-            logger.error(f"FFmpeg stdout: {stdout}")
-            logger.error(f"FFmpeg stderr: {stderr}")
-            raise Exception(f"FFmpeg processing failed: {stderr}")
+        # Burn in the captions using ASS format for animations
+        output_size = burn_captions(input_video_path, ass_file_path, output_video_path, on_progress)
         
-        logger.info("FFmpeg processing completed successfully")
+        logger.info(f"FFmpeg processing completed successfully ({output_size} bytes)")
 
         # Upload processed video to R2 Storage
         processed_filename = f"processed_{project_id}.mp4"
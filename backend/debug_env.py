@@ -37,13 +37,6 @@ if key:
 else:
     print("SUPABASE_ANON_KEY: None")
 
-# Check if it's the correct project
-if url:
-    if "ghkowjxqwxsikrdivwxl" in url:
-        print("✅ Correct videothingy project URL loaded")
-    else:
-        print("❌ Wrong project URL loaded")
-        
 if key:
     if "service_role" in key:
         print("✅ Service role key detected")
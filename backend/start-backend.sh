@@ -33,12 +33,15 @@ echo "Starting FastAPI application..."
 # Set default RELOAD to true if not set
 RELOAD=${RELOAD:-true}
 
+# On shutdown, stop accepting connections and give in-flight requests this long to finish
+SHUTDOWN_TIMEOUT_SECONDS=${SHUTDOWN_TIMEOUT_SECONDS:-60}
+
 # Start Uvicorn server with conditional reload
 echo "Starting Uvicorn with reload=$RELOAD..."
 if [ "$RELOAD" = "true" ]; then
-    ./.venv/bin/uvicorn app.main:app --host 0.0.0.0 --port 8000 --reload > fastapi_logs.txt 2>&1 &
+    ./.venv/bin/uvicorn app.main:app --host 0.0.0.0 --port 8000 --reload --timeout-graceful-shutdown $SHUTDOWN_TIMEOUT_SECONDS > fastapi_logs.txt 2>&1 &
 else
-    ./.venv/bin/uvicorn app.main:app --host 0.0.0.0 --port 8000 --no-reload > fastapi_logs.txt 2>&1 &
+    ./.venv/bin/uvicorn app.main:app --host 0.0.0.0 --port 8000 --no-reload --timeout-graceful-shutdown $SHUTDOWN_TIMEOUT_SECONDS > fastapi_logs.txt 2>&1 &
 fi
 UVICORN_PID=$!
 echo "FastAPI app started with PID: $UVICORN_PID (reload=$RELOAD)"
@@ -51,16 +54,18 @@ echo "- FastAPI logs are being written to fastapi_logs.txt"
 # --- Function to stop services ---
 cleanup() {
     echo "\nStopping services..."
-    kill $CELERY_PID
-    kill $UVICORN_PID
+    # SIGTERM lets Celery finish running tasks (warm shutdown) and Uvicorn drain open requests
+    kill -TERM $CELERY_PID $UVICORN_PID 2>/dev/null || true
+    wait $UVICORN_PID 2>/dev/null || true
+    wait $CELERY_PID 2>/dev/null || true
     # Optional: stop the redis container
     # echo "Stopping Redis container..."
     # docker stop videothingy-redis
     echo "Services stopped."
 }
 
-# Trap SIGINT (Ctrl+C) and call cleanup
-trap cleanup SIGINT
+# Trap SIGINT (Ctrl+C) and SIGTERM and call cleanup
+trap cleanup SIGINT SIGTERM
 
 # Wait for background processes to finish
 wait $CELERY_PID
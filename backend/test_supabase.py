@@ -2,7 +2,7 @@
 
 import os
 import sys
-sys.path.append('/Users/akinpound/Documents/experiments/videothingy/backend')
+sys.path.append(os.path.dirname(os.path.abspath(__file__)))
 
 from dotenv import load_dotenv
 from supabase import create_client
@@ -0,0 +1,14 @@
+import os
+import sys
+import tempfile
+from unittest import mock
+
+# Settings are checked when app.core.config is imported; tests never talk to a real project
+os.environ.setdefault("SUPABASE_URL", "http://supabase.test")
+os.environ.setdefault("SUPABASE_ANON_KEY", "test-key")
+os.environ.setdefault("UPLOAD_TEMP_DIR", os.path.join(tempfile.gettempdir(), "yovideo-test-uploads"))
+
+# The Supabase and R2 client modules connect when imported. Tests patch the clients where
+# they're used, so swap the modules for stubs before any app module loads them.
+for module in ("app.services.supabase_client", "app.services.r2_client"):
+    sys.modules.setdefault(module, mock.MagicMock())
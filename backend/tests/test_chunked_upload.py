@@ -0,0 +1,124 @@
+import os
+import io
+import uuid
+import asyncio
+import hashlib
+import unittest
+from unittest import mock
+from fastapi import HTTPException
+from app.api import endpoints
+from app.api.endpoints import (
+    UploadSession, UploadCompleteRequest, ChunkMetadata, complete_chunked_upload, upload_chunk, chunk_filename,
+    get_upload_session, upload_sessions, UPLOAD_TEMP_DIR
+)
+from app.core.auth import CurrentUser
+
+MP4_HEADER = b'\x00\x00\x00\x20ftypisom'
+CHUNKS = [MP4_HEADER + b'a' * 20, b'b' * 32, b'c' * 16]
+
+class FakeUploadFile:
+    def __init__(self, content: bytes):
+        self.file = io.BytesIO(content)
+
+    async def read(self):
+        return self.file.read()
+
+class CompleteChunkedUploadTests(unittest.TestCase):
+    def setUp(self):
+        self.user = CurrentUser(id="user-1")
+        self.upload_id = str(uuid.uuid4())
+        temp_dir = UPLOAD_TEMP_DIR / f"upload_{self.upload_id}"
+        temp_dir.mkdir(parents=True, exist_ok=True)
+        self.session = UploadSession(
+            upload_id=self.upload_id, project_id="project-1", file_name="clip.mp4",
+            file_size=sum(len(chunk) for chunk in CHUNKS), file_type="video/mp4",
+            total_chunks=len(CHUNKS), temp_dir=str(temp_dir)
+        )
+        upload_sessions[self.upload_id] = self.session
+        self.session.write_manifest()
+        for i, content in enumerate(CHUNKS):
+            self.write_chunk(i, content)
+        self.addCleanup(endpoints.discard_upload_session, self.session)
+
+        self.stored = {}
+
+        async def stream_to_r2(reader, storage_filename, content_type, timeout=300):
+            self.stored[storage_filename] = reader.read()
+
+        for name, patch in [
+            ("supabase", mock.MagicMock()),
+            ("get_r2_client", mock.MagicMock()),
+            ("require_project_access", mock.Mock(return_value={})),
+            ("start_transcription_after_upload", mock.Mock()),
+            ("probe_stored_video", mock.Mock(return_value={"width": 1920, "height": 1080, "duration": 10, "format": None})),
+            ("stream_to_r2_with_timeout", stream_to_r2),
+        ]:
+            patcher = mock.patch.object(endpoints, name, patch)
+            patcher.start()
+            self.addCleanup(patcher.stop)
+
+    def write_chunk(self, chunk_index: int, content: bytes):
+        path = os.path.join(self.session.temp_dir, chunk_filename(chunk_index))
+        with open(path, "wb") as f:
+            f.write(content)
+        self.session.add_chunk(chunk_index, path)
+
+    def complete(self, chunks: list):
+        request = UploadCompleteRequest(
+            uploadId=self.upload_id, projectId="project-1", chunks=[],
+            expectedChecksum=hashlib.sha256(b"".join(chunks)).hexdigest()
+        )
+        return asyncio.run(complete_chunked_upload(request, self.user))
+
+    def resend_chunk(self, chunk_index: int, content: bytes):
+        metadata = ChunkMetadata(
+            chunkIndex=chunk_index, chunkSize=len(content), totalChunks=len(CHUNKS),
+            totalSize=self.session.file_size, fileName="clip.mp4", fileType="video/mp4",
+            uploadId=self.upload_id, projectId="project-1"
+        )
+        return asyncio.run(upload_chunk(FakeUploadFile(content), metadata.model_dump_json(), self.user))
+
+    def test_checksum_mismatch_keeps_the_session_for_a_resend(self):
+        # The client sent a corrupted middle chunk of the right size
+        intended = [CHUNKS[0], b'B' * 32, CHUNKS[2]]
+
+        with self.assertLogs("app.api.endpoints", "ERROR"), self.assertRaises(HTTPException) as raised:
+            self.complete(intended)
+        self.assertEqual(raised.exception.status_code, 422)
+        self.assertTrue(os.path.isdir(self.session.temp_dir))
+
+        # A server restart in between must not lose the session either
+        upload_sessions.clear()
+        self.assertIsNotNone(get_upload_session(self.upload_id))
+
+        self.resend_chunk(1, intended[1])
+        result = self.complete(intended)
+
+        self.assertEqual(result["status"], "uploaded")
+        self.assertEqual(self.stored["project-1.mp4"], b"".join(intended))
+        self.assertFalse(os.path.exists(self.session.temp_dir))
+        self.assertNotIn(self.upload_id, upload_sessions)
+
+    def test_storage_failure_keeps_the_session(self):
+        async def failing_upload(*args, **kwargs):
+            raise ConnectionError("R2 connection reset")
+
+        with mock.patch.object(endpoints, "stream_to_r2_with_timeout", failing_upload):
+            with self.assertLogs("app.api.endpoints", "ERROR"), self.assertRaises(HTTPException) as raised:
+                self.complete(CHUNKS)
+        self.assertEqual(raised.exception.status_code, 500)
+        self.assertTrue(os.path.isdir(self.session.temp_dir))
+
+        self.assertEqual(self.complete(CHUNKS)["status"], "uploaded")
+
+    def test_non_video_discards_the_session(self):
+        self.write_chunk(0, b'%PDF-1.7' + b'\0' * (len(CHUNKS[0]) - 8))
+
+        with self.assertRaises(HTTPException) as raised:
+            self.complete(CHUNKS)
+
+        self.assertEqual(raised.exception.status_code, 415)
+        self.assertFalse(os.path.exists(self.session.temp_dir))
+
+if __name__ == "__main__":
+    unittest.main()
@@ -0,0 +1,83 @@
+import os
+import asyncio
+import tempfile
+import unittest
+from unittest import mock
+from fastapi import HTTPException
+from app.api import endpoints
+from app.api.endpoints import upload_video, UPLOAD_TEMP_DIR
+from app.core.auth import CurrentUser
+
+MP4_CONTENT = b'\x00\x00\x00\x20ftypisom' + b'v' * 4000
+
+class SpooledUploadFile:
+    """An UploadFile as Starlette hands it over, already spooled (and rolled over to disk)."""
+
+    def __init__(self, content: bytes, filename: str = "clip.mp4", content_type: str = "video/mp4"):
+        self.file = tempfile.SpooledTemporaryFile(max_size=1024)
+        self.file.write(content)
+        self.filename = filename
+        self.content_type = content_type
+        self.size = len(content)
+
+class UploadVideoTests(unittest.TestCase):
+    def setUp(self):
+        self.user = CurrentUser(id="user-1")
+        self.stored = {}
+        self.probed = {"width": 1920, "height": 1080, "duration": 10, "format": "mov,mp4,m4a,3gp,3g2,mj2"}
+
+        async def stream_to_r2(file_obj, storage_filename, content_type, timeout=300):
+            self.stored[storage_filename] = file_obj.read()
+
+        self.supabase = mock.MagicMock()
+        self.supabase.table.return_value.insert.return_value.execute.return_value = mock.Mock(data=[{"id": "project-1"}])
+        self.r2 = mock.MagicMock()
+        for name, patch in [
+            ("supabase", self.supabase),
+            ("get_r2_client", mock.Mock(return_value=self.r2)),
+            ("start_transcription_after_upload", mock.Mock()),
+            ("probe_stored_video", mock.Mock(side_effect=lambda key: dict(self.probed))),
+            ("stream_to_r2_with_timeout", stream_to_r2),
+        ]:
+            patcher = mock.patch.object(endpoints, name, patch)
+            patcher.start()
+            self.addCleanup(patcher.stop)
+
+    def upload(self, content: bytes, file_size=None, **kwargs):
+        return asyncio.run(upload_video(SpooledUploadFile(content, **kwargs), "My clip", file_size, self.user))
+
+    def test_streams_the_spooled_file_without_copying_it(self):
+        temp_files_before = set(os.listdir(UPLOAD_TEMP_DIR))
+
+        result = self.upload(MP4_CONTENT, file_size=len(MP4_CONTENT))
+
+        self.assertEqual(self.stored[result["filename"]], MP4_CONTENT)
+        self.assertEqual(set(os.listdir(UPLOAD_TEMP_DIR)), temp_files_before)
+        project = self.supabase.table.return_value.insert.call_args.args[0]
+        self.assertEqual((project["file_size"], project["width"]), (len(MP4_CONTENT), 1920))
+        self.r2.set_content_type.assert_not_called()
+
+    def test_size_mismatch_is_400(self):
+        with self.assertRaises(HTTPException) as raised:
+            self.upload(MP4_CONTENT, file_size=len(MP4_CONTENT) + 1)
+        self.assertEqual(raised.exception.status_code, 400)
+        self.assertEqual(self.stored, {})
+
+    def test_non_video_is_415_before_upload(self):
+        with self.assertRaises(HTTPException) as raised:
+            self.upload(b'%PDF-1.7' + b'\0' * 100)
+        self.assertEqual(raised.exception.status_code, 415)
+        self.assertEqual(self.stored, {})
+
+    def test_stored_file_without_video_stream_is_deleted(self):
+        self.probed = {"width": None, "height": None, "duration": 10, "format": "mov,mp4,m4a,3gp,3g2,mj2"}
+
+        with self.assertRaises(HTTPException) as raised:
+            self.upload(MP4_CONTENT)
+
+        self.assertEqual(raised.exception.status_code, 415)
+        self.r2.delete_file.assert_called_once_with(next(iter(self.stored)))
+        self.supabase.table.return_value.insert.assert_not_called()
+
+if __name__ == "__main__":
+    unittest.main()
@@ -0,0 +1,112 @@
+import json
+import asyncio
+import unittest
+from uuid import UUID
+from typing import List, Literal
+from pydantic import BaseModel, Field, ValidationError, field_validator
+from fastapi import HTTPException, Request
+from fastapi.exceptions import RequestValidationError
+from app.core.errors import (
+    error_body, http_exception_handler, unhandled_exception_handler, format_validation_errors,
+    validation_exception_handler
+)
+
+def make_request(method: str = "GET", path: str = "/api/v1/projects") -> Request:
+    return Request({"type": "http", "method": method, "path": path, "headers": []})
+
+def handle(handler, exc):
+    response = asyncio.run(handler(make_request(), exc))
+    return response, json.loads(response.body)
+
+class ExportRequest(BaseModel):
+    project_id: UUID
+    resolutions: List[int] = Field(min_length=1)
+    quality: Literal["low", "high"]
+    fps: int = Field(ge=1, le=60)
+
+    @field_validator("resolutions")
+    @classmethod
+    def known_resolutions(cls, value):
+        if any(resolution not in (480, 720, 1080) for resolution in value):
+            raise ValueError("Resolutions must be 480, 720 or 1080")
+        return value
+
+def validation_errors(data: dict, location: str = "body") -> list:
+    try:
+        ExportRequest(**data)
+    except ValidationError as e:
+        # FastAPI reports the same errors with the request part prefixed to each location
+        return [{**error, "loc": (location, *error["loc"])} for error in e.errors()]
+    raise AssertionError("expected a validation error")
+
+class ErrorBodyTests(unittest.TestCase):
+    def test_string_detail(self):
+        self.assertEqual(error_body("Project not found"), {"detail": "Project not found"})
+        self.assertEqual(error_body("Chunks missing", missingChunks=[2, 5]), {"detail": "Chunks missing", "missingChunks": [2, 5]})
+
+    def test_dict_detail_is_flattened(self):
+        body = error_body({"message": "A transcription job is already running", "job_id": "job-1"})
+        self.assertEqual(body, {"detail": "A transcription job is already running", "job_id": "job-1"})
+
+    def test_dict_detail_without_message(self):
+        self.assertEqual(error_body({"job_id": "job-1"}), {"detail": "Request failed", "job_id": "job-1"})
+
+class ExceptionHandlerTests(unittest.TestCase):
+    def test_http_exception_keeps_status_and_headers(self):
+        response, body = handle(http_exception_handler, HTTPException(
+            status_code=409, detail={"message": "Job already running", "job_id": "job-1"}, headers={"Retry-After": "30"}
+        ))
+
+        self.assertEqual(response.status_code, 409)
+        self.assertEqual(response.headers["Retry-After"], "30")
+        self.assertEqual(body, {"detail": "Job already running", "job_id": "job-1"})
+
+    def test_unhandled_exception_hides_its_message(self):
+        with self.assertLogs("app.core.errors", "ERROR"):
+            response, body = handle(unhandled_exception_handler, RuntimeError("postgres password rejected"))
+
+        self.assertEqual(response.status_code, 500)
+        self.assertEqual(body, {"detail": "Internal server error"})
+
+    def test_validation_errors_are_422_with_field_detail(self):
+        errors = validation_errors({"project_id": "abc", "resolutions": [720], "quality": "high", "fps": 30})
+        with self.assertLogs("app.core.errors", "INFO"):
+            response, body = handle(validation_exception_handler, RequestValidationError(errors))
+
+        self.assertEqual(response.status_code, 422)
+        self.assertEqual(body["detail"], "Request validation failed")
+        self.assertEqual(body["errors"], [
+            {"field": "project_id", "tag": "uuid", "message": "Must be a valid UUID", "param": None}
+        ])
+
+class FormatValidationErrorsTests(unittest.TestCase):
+    def by_field(self, data: dict) -> dict:
+        return {error["field"]: error for error in format_validation_errors(validation_errors(data))}
+
+    def test_tags_and_params(self):
+        errors = self.by_field({"resolutions": [], "quality": "medium", "fps": 0})
+
+        self.assertEqual(errors["project_id"]["tag"], "required")
+        self.assertEqual(errors["project_id"]["message"], "This field is required")
+        self.assertEqual((errors["resolutions"]["tag"], errors["resolutions"]["param"]), ("min", 1))
+        self.assertEqual(errors["quality"]["tag"], "oneof")
+        self.assertEqual(errors["quality"]["message"], f"Must be one of {errors['quality']['param']}")
+        self.assertEqual((errors["fps"]["tag"], errors["fps"]["param"], errors["fps"]["message"]), ("gte", 1, "Must be at least 1"))
+
+    def test_nested_fields_are_dotted(self):
+        errors = self.by_field({"project_id": "4f9a6b1e-1c1d-4a55-9f3e-2b0c1d2e3f40", "resolutions": [720, "wide"], "quality": "low", "fps": 30})
+
+        self.assertEqual(list(errors), ["resolutions.1"])
+        self.assertEqual(errors["resolutions.1"]["tag"], "int")
+
+    def test_custom_validator_message_is_kept(self):
+        errors = self.by_field({"project_id": "4f9a6b1e-1c1d-4a55-9f3e-2b0c1d2e3f40", "resolutions": [360], "quality": "low", "fps": 30})
+
+        self.assertEqual(errors["resolutions"]["message"], "Resolutions must be 480, 720 or 1080")
+
+    def test_query_location_is_dropped(self):
+        [error] = format_validation_errors([{"loc": ("query", "limit"), "type": "less_than_equal", "msg": "", "ctx": {"le": 100}}])
+        self.assertEqual(error, {"field": "limit", "tag": "lte", "message": "Must be at most 100", "param": 100})
+
+if __name__ == "__main__":
+    unittest.main()
@@ -0,0 +1,64 @@
+import json
+import unittest
+from datetime import datetime, timezone
+from fastapi import Request
+from app.core.etag import compute_etag, etag_matches, conditional_json
+
+def make_request(if_none_match: str = None) -> Request:
+    headers = [(b"if-none-match", if_none_match.encode())] if if_none_match is not None else []
+    return Request({"type": "http", "method": "GET", "path": "/api/v1/jobs/job-1", "headers": headers})
+
+JOB = {"id": "job-1", "status": "processing", "progress": 0.4, "updated_at": datetime(2026, 10, 16, 9, 30, tzinfo=timezone.utc)}
+
+class ComputeEtagTests(unittest.TestCase):
+    def test_stable_for_equal_content(self):
+        reordered = {key: JOB[key] for key in reversed(list(JOB))}
+        self.assertEqual(compute_etag(JOB), compute_etag(reordered))
+
+    def test_changes_with_content(self):
+        self.assertNotEqual(compute_etag(JOB), compute_etag({**JOB, "progress": 0.5}))
+        self.assertNotEqual(compute_etag(JOB), compute_etag({**JOB, "status": "completed"}))
+
+    def test_is_a_quoted_strong_validator(self):
+        etag = compute_etag(JOB)
+        self.assertTrue(etag.startswith('"') and etag.endswith('"'))
+        self.assertFalse(etag.startswith("W/"))
+
+class EtagMatchesTests(unittest.TestCase):
+    def setUp(self):
+        self.etag = compute_etag(JOB)
+
+    def test_matching_validators(self):
+        for header in [self.etag, f"W/{self.etag}", f'"stale", {self.etag}', "*", '"stale" , *']:
+            with self.subTest(header=header):
+                self.assertTrue(etag_matches(make_request(header), self.etag))
+
+    def test_non_matching_validators(self):
+        for header in [None, "", '"stale"', self.etag.strip('"'), f'W/"stale", "{self.etag}"']:
+            with self.subTest(header=header):
+                self.assertFalse(etag_matches(make_request(header), self.etag))
+
+class ConditionalJsonTests(unittest.TestCase):
+    def test_200_then_304_once_the_client_has_it(self):
+        first = conditional_json(make_request(), JOB)
+        self.assertEqual(first.status_code, 200)
+        self.assertEqual(json.loads(first.body)["updated_at"], "2026-10-16T09:30:00+00:00")
+        etag = first.headers["ETag"]
+
+        second = conditional_json(make_request(etag), JOB)
+        self.assertEqual(second.status_code, 304)
+        self.assertEqual(second.body, b"")
+        self.assertEqual(second.headers["ETag"], etag)
+        self.assertEqual(second.headers["Cache-Control"], "private, no-cache")
+
+    def test_changed_content_is_sent_again(self):
+        etag = conditional_json(make_request(), JOB).headers["ETag"]
+
+        response = conditional_json(make_request(etag), {**JOB, "progress": 0.8})
+
+        self.assertEqual(response.status_code, 200)
+        self.assertNotEqual(response.headers["ETag"], etag)
+        self.assertEqual(json.loads(response.body)["progress"], 0.8)
+
+if __name__ == "__main__":
+    unittest.main()
@@ -0,0 +1,65 @@
+import os
+import shutil
+import tempfile
+import unittest
+from app.services.ffmpeg_service import escape_filter_path
+
+def unescape_level(value: str, specials: str) -> str:
+    """Undo one level of ffmpeg escaping, failing if a special character was left unescaped."""
+    unescaped = []
+    chars = iter(value)
+    for char in chars:
+        if char == "\\":
+            unescaped.append(next(chars))
+        elif char in specials:
+            raise AssertionError(f"Unescaped {char!r} in {value!r}")
+        else:
+            unescaped.append(char)
+    return "".join(unescaped)
+
+def ffmpeg_unescape(value: str) -> str:
+    """What ffmpeg hands a filter as the option value: the filtergraph level is unescaped first, then the option level."""
+    return unescape_level(unescape_level(value, "'[],;"), "':")
+
+class EscapeFilterPathTests(unittest.TestCase):
+    def setUp(self):
+        self.base_dir = os.path.realpath(tempfile.mkdtemp())
+        self.addCleanup(shutil.rmtree, self.base_dir)
+
+    def path(self, name: str) -> str:
+        return os.path.join(self.base_dir, name)
+
+    def test_special_characters_survive_both_levels(self):
+        for name in ["caption's.ass", "a:b.ass", "a,b.ass", "[in]captions.ass", "a;b.ass", "a]b[c.ass", "back\\slash.ass"]:
+            with self.subTest(name=name):
+                escaped = escape_filter_path(self.path(name), self.base_dir)
+                self.assertEqual(ffmpeg_unescape(escaped), self.path(name))
+
+    def test_injected_filter_options_stay_in_the_path(self):
+        name = "x.ass:force_style='Fontsize=99',drawtext=text=pwned;[out]null"
+        escaped = escape_filter_path(self.path(name), self.base_dir)
+        self.assertEqual(ffmpeg_unescape(escaped), self.path(name))
+
+    def test_spaces_are_left_alone(self):
+        escaped = escape_filter_path(self.path("my captions.ass"), self.base_dir)
+        self.assertEqual(escaped, self.path("my captions.ass"))
+
+    def test_rejects_paths_outside_base_dir(self):
+        for path in ["/etc/passwd", self.path("../escaped.ass"), self.base_dir + "-sibling/captions.ass"]:
+            with self.subTest(path=path), self.assertRaises(ValueError):
+                escape_filter_path(path, self.base_dir)
+
+    def test_rejects_symlink_out_of_base_dir(self):
+        outside_dir = tempfile.mkdtemp()
+        self.addCleanup(shutil.rmtree, outside_dir)
+        os.symlink(outside_dir, self.path("link"))
+
+        with self.assertRaises(ValueError):
+            escape_filter_path(self.path("link/captions.ass"), self.base_dir)
+
+    def test_defaults_to_temp_dir(self):
+        path = os.path.join(tempfile.gettempdir(), "captions.ass")
+        self.assertEqual(ffmpeg_unescape(escape_filter_path(path)), os.path.realpath(path))
+
+if __name__ == "__main__":
+    unittest.main()
@@ -0,0 +1,132 @@
+import threading
+import unittest
+from unittest import mock
+from app.core.celery_app import JOB_LEASE_SECONDS
+from app.core.statuses import JobStatus
+from app.tasks import media
+from app.tasks.media import claim_job
+
+class FakeJobs:
+    """
+    A processing_jobs table holding one job, applying claims the way the database
+    does: the conditional update is atomic, so only one of several racing claims
+    finds the job still claimable.
+    """
+
+    def __init__(self, status=JobStatus.PENDING, exists=True):
+        self.status = status
+        self.exists = exists
+        self.claims = []
+        self._lock = threading.Lock()
+
+    def table(self, name):
+        return FakeQuery(self)
+
+class FakeQuery:
+    def __init__(self, jobs: FakeJobs):
+        self.jobs = jobs
+        self.update_data = None
+        self.filters = []
+
+    def update(self, data):
+        self.update_data = data
+        return self
+
+    def select(self, columns):
+        return self
+
+    def eq(self, column, value):
+        self.filters.append(("eq", column, value))
+        return self
+
+    def or_(self, condition):
+        self.filters.append(("or", condition))
+        return self
+
+    def in_(self, column, values):
+        self.filters.append(("in", column, values))
+        return self
+
+    def execute(self):
+        with self.jobs._lock:
+            if not self.jobs.exists:
+                return mock.Mock(data=[])
+            if self.update_data is None:
+                return mock.Mock(data=[{"status": self.jobs.status}])
+            self.jobs.claims.append(self.filters)
+            if self.jobs.status not in (JobStatus.PENDING, JobStatus.RETRYING):
+                return mock.Mock(data=[])
+            self.jobs.status = self.update_data["status"]
+            return mock.Mock(data=[{"id": "job-1", **self.update_data}])
+
+def fake_task(retries: int = 0):
+    task = mock.Mock()
+    task.request.retries = retries
+    return task
+
+class ClaimJobTests(unittest.TestCase):
+    def use_jobs(self, jobs: FakeJobs):
+        patcher = mock.patch.object(media, "supabase", jobs)
+        patcher.start()
+        self.addCleanup(patcher.stop)
+        return jobs
+
+    def test_concurrent_claims_have_exactly_one_winner(self):
+        self.use_jobs(FakeJobs())
+        tasks = [fake_task(), fake_task()]
+        results = [None, None]
+        start = threading.Barrier(len(tasks))
+
+        def claim(i):
+            start.wait()
+            results[i] = claim_job(tasks[i], "job-1")
+
+        threads = [threading.Thread(target=claim, args=(i,)) for i in range(len(tasks))]
+        for thread in threads:
+            thread.start()
+        for thread in threads:
+            thread.join()
+
+        self.assertEqual(sorted(results), [False, True])
+        loser = tasks[results.index(False)]
+        loser.signature_from_request.return_value.apply_async.assert_called_once_with()
+        tasks[results.index(True)].signature_from_request.assert_not_called()
+
+    def test_lease_wait_requeues_without_spending_retries(self):
+        self.use_jobs(FakeJobs(status=JobStatus.PROCESSING))
+        task = fake_task(retries=2)
+
+        self.assertFalse(claim_job(task, "job-1"))
+
+        task.retry.assert_not_called()
+        task.signature_from_request.assert_called_once_with(task.request, countdown=JOB_LEASE_SECONDS, retries=2)
+
+    def test_claim_accepts_stale_heartbeats(self):
+        jobs = self.use_jobs(FakeJobs())
+
+        claim_job(fake_task(), "job-1")
+
+        [filters] = jobs.claims
+        self.assertIn(("eq", "id", "job-1"), filters)
+        [condition] = [f[1] for f in filters if f[0] == "or"]
+        self.assertIn("status.in.(pending,retrying)", condition)
+        self.assertIn("heartbeat_at.lt.", condition)
+
+    def test_finished_job_is_skipped(self):
+        for status in (JobStatus.COMPLETED, JobStatus.FAILED, JobStatus.CANCELLED):
+            with self.subTest(status=status):
+                self.use_jobs(FakeJobs(status=status))
+                task = fake_task()
+
+                self.assertFalse(claim_job(task, "job-1"))
+                task.signature_from_request.assert_not_called()
+
+    def test_deleted_job_is_skipped(self):
+        self.use_jobs(FakeJobs(exists=False))
+        task = fake_task()
+
+        self.assertFalse(claim_job(task, "job-1"))
+        task.signature_from_request.assert_not_called()
+
+if __name__ == "__main__":
+    unittest.main()
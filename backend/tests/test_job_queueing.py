@@ -0,0 +1,51 @@
+import json
+import asyncio
+import unittest
+from unittest import mock
+from fastapi import HTTPException, Request
+from app.api import endpoints
+from app.api.endpoints import enqueue_job, QUEUE_RETRY_AFTER_SECONDS
+from app.core.errors import http_exception_handler
+from app.core.statuses import JobStatus
+
+class EnqueueJobTests(unittest.TestCase):
+    def setUp(self):
+        patcher = mock.patch.object(endpoints, "supabase")
+        self.supabase = patcher.start()
+        self.addCleanup(patcher.stop)
+        self.task = mock.Mock()
+        self.task.name = "app.tasks.media.generate_gif_task"
+
+    def test_queues_task_under_the_job_id(self):
+        enqueue_job(self.task, "job-1", "project-1", "job-1")
+
+        self.task.apply_async.assert_called_once_with(args=("project-1", "job-1"), task_id="job-1")
+        self.supabase.table.assert_not_called()
+
+    def test_unavailable_broker_fails_the_job_and_returns_503(self):
+        self.task.apply_async.side_effect = ConnectionError("Error 111 connecting to redis:6379")
+
+        with self.assertRaises(HTTPException) as raised:
+            enqueue_job(self.task, "job-1", "project-1", "job-1")
+
+        self.assertEqual(raised.exception.status_code, 503)
+        self.assertEqual(raised.exception.headers, {"Retry-After": str(QUEUE_RETRY_AFTER_SECONDS)})
+
+        update = self.supabase.table.return_value.update
+        self.assertEqual(update.call_args.args[0]["status"], JobStatus.QUEUE_FAILED)
+        update.return_value.eq.assert_called_once_with("id", "job-1")
+
+    def test_503_keeps_retry_after_in_the_response(self):
+        self.task.apply_async.side_effect = ConnectionError("Error 111 connecting to redis:6379")
+        with self.assertRaises(HTTPException) as raised:
+            enqueue_job(self.task, "job-1", "project-1", "job-1")
+
+        request = Request({"type": "http", "method": "POST", "path": "/api/v1/projects/project-1/gif", "headers": []})
+        response = asyncio.run(http_exception_handler(request, raised.exception))
+
+        self.assertEqual(response.status_code, 503)
+        self.assertEqual(response.headers["Retry-After"], str(QUEUE_RETRY_AFTER_SECONDS))
+        self.assertEqual(json.loads(response.body), {"detail": "Job queue unavailable, please retry later"})
+
+if __name__ == "__main__":
+    unittest.main()
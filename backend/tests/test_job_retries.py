@@ -0,0 +1,84 @@
+import unittest
+from unittest import mock
+from celery.exceptions import Retry, SoftTimeLimitExceeded
+from app.core import celery_app
+from app.core.celery_app import should_retry, retry_countdown, PermanentError
+from app.core.statuses import JobStatus
+from app.services.ffmpeg_service import FFmpegError, InputNotFoundError
+from app.tasks import media
+from app.tasks.media import run_media_job
+
+def fake_task(retries: int = 0, max_retries: int = 3):
+    task = mock.Mock(max_retries=max_retries)
+    task.request.retries = retries
+    task.retry.side_effect = Retry()
+    return task
+
+class ShouldRetryTests(unittest.TestCase):
+    def test_transient_errors_retry_until_the_limit(self):
+        self.assertTrue(should_retry(fake_task(retries=0), FFmpegError("exit 1")))
+        self.assertTrue(should_retry(fake_task(retries=2), ConnectionError("reset by peer")))
+        self.assertFalse(should_retry(fake_task(retries=3), FFmpegError("exit 1")))
+
+    def test_permanent_errors_never_retry(self):
+        for error in [PermanentError("No project found"), InputNotFoundError("missing"), SoftTimeLimitExceeded()]:
+            with self.subTest(error=type(error).__name__):
+                self.assertFalse(should_retry(fake_task(), error))
+
+    def test_backoff_doubles_each_attempt(self):
+        with mock.patch.object(celery_app, "JOB_RETRY_BACKOFF_SECONDS", 10):
+            self.assertEqual([retry_countdown(fake_task(retries=n)) for n in range(4)], [10, 20, 40, 80])
+
+class RetryLifecycleTests(unittest.TestCase):
+    def setUp(self):
+        for name in ("claim_job", "JobHeartbeat", "supabase", "download_project_video", "is_job_cancelled", "queue_job_webhooks"):
+            patcher = mock.patch.object(media, name)
+            patcher.start()
+            self.addCleanup(patcher.stop)
+        media.claim_job.return_value = True
+        media.is_job_cancelled.return_value = False
+        media.download_project_video.return_value = None
+
+        self.statuses = []
+        patcher = mock.patch.object(media, "update_job_status", side_effect=lambda job_id, *update: self.statuses.append(update))
+        patcher.start()
+        self.addCleanup(patcher.stop)
+
+    def test_job_failing_twice_then_succeeding_ends_completed(self):
+        outcomes = [FFmpegError("exit 1"), ConnectionError("R2 upload reset"), "done.mp4"]
+
+        def render(job):
+            outcome = outcomes.pop(0)
+            if isinstance(outcome, Exception):
+                raise outcome
+            return outcome
+
+        # Each delivery of the task is a new attempt with request.retries counting the earlier ones
+        for attempt in range(2):
+            task = fake_task(retries=attempt)
+            with self.assertRaises(Retry):
+                run_media_job(task, "project-1", "job-1", "Test render", render)
+            self.assertEqual(task.retry.call_args.kwargs["countdown"], retry_countdown(task))
+
+        self.assertEqual(run_media_job(fake_task(retries=2), "project-1", "job-1", "Test render", render), "done.mp4")
+
+        self.assertEqual(self.statuses, [
+            (JobStatus.RETRYING, "Attempt 1/4 failed: Video processing failed"),
+            (JobStatus.RETRYING, "Attempt 2/4 failed: R2 upload reset"),
+            (JobStatus.COMPLETED,),
+        ])
+        media.queue_job_webhooks.assert_called_once_with("project-1", job_id="job-1")
+
+    def test_job_fails_once_retries_are_exhausted(self):
+        def render(job):
+            raise FFmpegError("exit 1")
+
+        for attempt in range(3):
+            with self.assertRaises(Retry):
+                run_media_job(fake_task(retries=attempt), "project-1", "job-1", "Test render", render)
+        run_media_job(fake_task(retries=3), "project-1", "job-1", "Test render", render)
+
+        self.assertEqual([status[0] for status in self.statuses], [JobStatus.RETRYING] * 3 + [JobStatus.FAILED])
+
+if __name__ == "__main__":
+    unittest.main()
@@ -0,0 +1,187 @@
+import os
+import tempfile
+import unittest
+from unittest import mock
+from celery.exceptions import Retry, SoftTimeLimitExceeded
+from app.core.celery_app import JOB_TIMEOUT_MESSAGE
+from app.core.statuses import JobStatus
+from app.services.ffmpeg_service import FFmpegError, UnsupportedCodecError
+from app.tasks import media
+from app.tasks.media import run_media_job, update_job_status
+
+FFMPEG_STDERR = "[libx264 @ 0x5581] broken frame at /tmp/tmpa1b2c3.mp4"
+
+class RunMediaJobTests(unittest.TestCase):
+    def setUp(self):
+        self.task = mock.Mock(max_retries=3)
+        self.task.request.retries = 0
+        self.task.retry.side_effect = Retry()
+
+        self.patch("claim_job", return_value=True)
+        self.patch("JobHeartbeat")
+        self.patch("supabase")
+        self.patch("download_project_video", side_effect=self.fake_download)
+        self.patch("is_job_cancelled", return_value=False)
+        self.update_job_status = self.patch("update_job_status")
+        self.queue_job_webhooks = self.patch("queue_job_webhooks")
+        self.source_paths = []
+
+    def patch(self, name, **kwargs):
+        patcher = mock.patch.object(media, name, **kwargs)
+        self.addCleanup(patcher.stop)
+        return patcher.start()
+
+    def fake_download(self, project_id):
+        with tempfile.NamedTemporaryFile(suffix=".mp4", delete=False) as source:
+            self.source_paths.append(source.name)
+        return source.name
+
+    def run_job(self, render, **kwargs):
+        return run_media_job(self.task, "project-1", "job-1", "Test render", render, **kwargs)
+
+    def assert_cleaned_up(self, *paths):
+        for path in list(paths) + self.source_paths:
+            self.assertFalse(os.path.exists(path), f"{path} was left behind")
+
+    def test_completes_job_and_removes_temp_files(self):
+        created = []
+
+        def render(job):
+            created.append(job.temp_file(".mp4"))
+            created.append(job.temp_dir("segments_"))
+            job.save_output({"video": "out.mp4"})
+            return "out.mp4"
+
+        self.assertEqual(self.run_job(render), "out.mp4")
+
+        self.update_job_status.assert_called_once_with("job-1", JobStatus.COMPLETED)
+        self.queue_job_webhooks.assert_called_once_with("project-1", job_id="job-1")
+        self.assert_cleaned_up(*created)
+
+    def test_retry_records_user_message_not_ffmpeg_output(self):
+        created = []
+
+        def render(job):
+            created.append(job.temp_file(".mp4"))
+            raise FFmpegError(FFMPEG_STDERR)
+
+        with self.assertRaises(Retry):
+            self.run_job(render)
+
+        self.update_job_status.assert_called_once_with(
+            "job-1", JobStatus.RETRYING, "Attempt 1/4 failed: Video processing failed"
+        )
+        self.queue_job_webhooks.assert_not_called()
+        self.assert_cleaned_up(*created)
+
+    def test_fails_with_user_message_once_retries_run_out(self):
+        self.task.request.retries = 3
+
+        def render(job):
+            raise FFmpegError(FFMPEG_STDERR, user_message="Video codec vp9 is not supported")
+
+        self.assertIsNone(self.run_job(render))
+
+        self.update_job_status.assert_called_once_with("job-1", JobStatus.FAILED, "Video codec vp9 is not supported")
+        self.queue_job_webhooks.assert_called_once_with("project-1", job_id="job-1")
+        self.task.retry.assert_not_called()
+
+    def test_does_not_retry_permanent_errors(self):
+        def render(job):
+            raise UnsupportedCodecError(FFMPEG_STDERR)
+
+        self.run_job(render)
+
+        self.update_job_status.assert_called_once_with("job-1", JobStatus.FAILED, UnsupportedCodecError.user_message)
+        self.task.retry.assert_not_called()
+
+    def test_timeout_fails_with_timeout_message(self):
+        def render(job):
+            raise SoftTimeLimitExceeded()
+
+        self.run_job(render)
+
+        self.update_job_status.assert_called_once_with("job-1", JobStatus.FAILED, JOB_TIMEOUT_MESSAGE)
+        self.task.retry.assert_not_called()
+
+    def test_cancelled_job_is_left_alone(self):
+        media.is_job_cancelled.return_value = True
+
+        def render(job):
+            raise SoftTimeLimitExceeded()
+
+        self.assertIsNone(self.run_job(render))
+
+        self.update_job_status.assert_not_called()
+        self.queue_job_webhooks.assert_not_called()
+        self.assert_cleaned_up()
+
+    def test_unclaimed_job_does_not_render(self):
+        media.claim_job.return_value = False
+        render = mock.Mock()
+
+        self.assertIsNone(self.run_job(render))
+
+        render.assert_not_called()
+        media.download_project_video.assert_not_called()
+
+    def test_cache_hit_skips_download_and_render(self):
+        self.patch("render_cache_key", return_value="cache-key")
+        complete_from_cache = self.patch("complete_from_cache", return_value=True)
+        render = mock.Mock()
+
+        self.assertIsNone(self.run_job(render, cache_as=("gif", {"fps": 12})))
+
+        complete_from_cache.assert_called_once_with("job-1", "project-1", "cache-key")
+        render.assert_not_called()
+        media.download_project_video.assert_not_called()
+
+    def test_cache_miss_caches_saved_output(self):
+        render_cache_key = self.patch("render_cache_key", return_value="cache-key")
+        self.patch("complete_from_cache", return_value=False)
+        cache_render = self.patch("cache_render")
+
+        storage = self.patch("get_r2_client").return_value
+
+        def render(job):
+            job.upload_output("/tmp/out.gif", "out.gif", "image/gif")
+            job.save_output({"gif": "out.gif", "dither": "bayer", "output_size_bytes": 10})
+            return "out.gif"
+
+        self.run_job(render, cache_as=("gif", {"fps": 12}))
+
+        storage.upload_file.assert_called_once_with("/tmp/out.gif", "out.gif", "image/gif")
+        render_cache_key.assert_called_once_with("project-1", "gif", {"fps": 12})
+        # Only uploaded files are listed as outputs, never other string fields
+        cache_render.assert_called_once_with("cache-key", "project-1", "gif", {
+            "gif": "out.gif", "dither": "bayer", "output_size_bytes": 10, "output_keys": ["out.gif"]
+        })
+        self.update_job_status.assert_called_once_with("job-1", JobStatus.COMPLETED)
+
+class UpdateJobStatusTests(unittest.TestCase):
+    def setUp(self):
+        patcher = mock.patch.object(media, "supabase")
+        self.supabase = patcher.start()
+        self.addCleanup(patcher.stop)
+
+    def written(self, *args) -> dict:
+        update_job_status("job-1", *args)
+        return self.supabase.table.return_value.update.call_args.args[0]
+
+    def test_completion_sets_progress_to_one(self):
+        # Steps run through plain run_ffmpeg (thumbnail, gif) never report progress themselves
+        self.assertEqual(self.written(JobStatus.COMPLETED), {"status": JobStatus.COMPLETED, "progress": 1})
+
+    def test_retry_resets_progress(self):
+        self.assertEqual(
+            self.written(JobStatus.RETRYING, "Attempt 1/4 failed: Video processing failed"),
+            {"status": JobStatus.RETRYING, "error_message": "Attempt 1/4 failed: Video processing failed", "progress": 0}
+        )
+
+    def test_failure_keeps_progress(self):
+        self.assertEqual(self.written(JobStatus.FAILED, "Video processing failed"), {
+            "status": JobStatus.FAILED, "error_message": "Video processing failed"
+        })
+
+if __name__ == "__main__":
+    unittest.main()
@@ -0,0 +1,128 @@
+import unittest
+from unittest import mock
+from fastapi import HTTPException
+from app.api import endpoints
+from app.api.endpoints import queue_media_job, job_output_url
+from app.core.statuses import JobStatus
+
+class FakeTable:
+    """Answers every query on one table with rows, recording inserts."""
+
+    def __init__(self, rows=None):
+        self.rows = rows if rows is not None else []
+        self.inserted = []
+
+    def select(self, columns):
+        return self
+
+    def eq(self, column, value):
+        return self
+
+    def in_(self, column, values):
+        return self
+
+    def limit(self, count):
+        return self
+
+    def insert(self, data):
+        self.inserted.append(data)
+        self.rows = [{"id": "job-1", **data}]
+        return self
+
+    def execute(self):
+        return mock.Mock(data=self.rows)
+
+class FakeSupabase:
+    def __init__(self, **tables):
+        self.tables = tables
+
+    def table(self, name):
+        return self.tables.setdefault(name, FakeTable())
+
+class QueueMediaJobTests(unittest.TestCase):
+    def use_tables(self, project=None, active_jobs=()):
+        self.projects = FakeTable([project] if project else [])
+        self.jobs = FakeTable(list(active_jobs))
+        patcher = mock.patch.object(endpoints, "supabase", FakeSupabase(projects=self.projects, processing_jobs=self.jobs))
+        patcher.start()
+        self.addCleanup(patcher.stop)
+        self.task = mock.Mock()
+
+    def assertStatus(self, status_code, **kwargs):
+        with self.assertRaises(HTTPException) as raised:
+            queue_media_job("project-1", "gif", self.task, (0.0, 3.0), **kwargs)
+        self.assertEqual(raised.exception.status_code, status_code)
+        self.task.apply_async.assert_not_called()
+
+    def test_creates_and_queues_the_job(self):
+        self.use_tables(project={"id": "project-1", "video_path": "project-1.mp4"})
+
+        with self.assertLogs("app.api.endpoints", "INFO"):
+            job_id = queue_media_job("project-1", "gif", self.task, (0.0, 3.0), "https://example.com/hook")
+
+        self.assertEqual(job_id, "job-1")
+        self.assertEqual(self.jobs.inserted, [{
+            "project_id": "project-1", "job_type": "gif", "status": JobStatus.PENDING,
+            "callback_url": "https://example.com/hook"
+        }])
+        self.task.apply_async.assert_called_once_with(args=("project-1", "job-1", 0.0, 3.0), task_id="job-1")
+
+    def test_records_output_details_from_the_start(self):
+        self.use_tables(project={"id": "project-1", "video_path": "project-1.mp4"})
+
+        with self.assertLogs("app.api.endpoints", "INFO"):
+            queue_media_job("project-1", "watermark", self.task, output_details={"watermark_image": "logo.png"})
+
+        self.assertEqual(self.jobs.inserted[0]["output_details"], {"watermark_image": "logo.png"})
+
+    def test_missing_project_is_404(self):
+        self.use_tables()
+        self.assertStatus(404)
+
+    def test_unfinished_upload_is_409(self):
+        self.use_tables(project={"id": "project-1", "video_path": ""})
+        self.assertStatus(409)
+
+    def test_duplicate_job_is_409(self):
+        self.use_tables(project={"id": "project-1", "video_path": "project-1.mp4"}, active_jobs=[{"id": "job-0"}])
+        self.assertStatus(409)
+        self.assertEqual(self.jobs.inserted, [])
+
+class JobOutputUrlTests(unittest.TestCase):
+    def use_job(self, job=None):
+        patcher = mock.patch.object(endpoints, "supabase", FakeSupabase(processing_jobs=FakeTable([job] if job else [])))
+        patcher.start()
+        self.addCleanup(patcher.stop)
+        patcher = mock.patch.object(endpoints, "get_r2_client")
+        self.r2 = patcher.start().return_value
+        self.r2.get_file_url.side_effect = lambda key: f"https://r2.test/{key}?signed"
+        self.addCleanup(patcher.stop)
+
+    def test_signs_the_output_with_extra_fields(self):
+        self.use_job({"status": JobStatus.COMPLETED, "output_details": {
+            "video": "loudness_project-1.mp4", "target_lufs": -14, "measured_lufs": -22.5
+        }})
+
+        result = job_output_url("project-1", "job-1", "loudness", "video", extra={"targetLufs": "target_lufs", "measuredLufs": "measured_lufs"})
+
+        self.assertEqual(result["url"], "https://r2.test/loudness_project-1.mp4?signed")
+        self.assertEqual((result["targetLufs"], result["measuredLufs"]), (-14, -22.5))
+        self.assertIn("expiresAt", result)
+
+    def test_missing_job_is_404(self):
+        self.use_job()
+        with self.assertRaises(HTTPException) as raised:
+            job_output_url("project-1", "job-1", "gif", "gif")
+        self.assertEqual(raised.exception.status_code, 404)
+
+    def test_unfinished_job_is_409(self):
+        for job in [{"status": JobStatus.PROCESSING, "output_details": None}, {"status": JobStatus.COMPLETED, "output_details": {}}]:
+            with self.subTest(job=job):
+                self.use_job(job)
+                with self.assertRaises(HTTPException) as raised:
+                    job_output_url("project-1", "job-1", "gif", "gif")
+                self.assertEqual(raised.exception.status_code, 409)
+                self.r2.get_file_url.assert_not_called()
+
+if __name__ == "__main__":
+    unittest.main()
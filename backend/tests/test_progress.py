@@ -0,0 +1,67 @@
+import random
+import threading
+import unittest
+from app.core.progress import WeightedProgress
+
+class WeightedProgressTests(unittest.TestCase):
+    def setUp(self):
+        self.reported = []
+
+    def test_steps_are_weighted_by_their_share(self):
+        progress = WeightedProgress({"whisper": 1, "captions": 3}, self.reported.append)
+
+        progress.report("whisper", 1.0)
+        progress.report("captions", 0.5)
+
+        self.assertEqual(progress.shares, {"whisper": 0.25, "captions": 0.75})
+        self.assertEqual(self.reported, [0.25, 0.625])
+
+    def test_never_moves_backwards(self):
+        progress = WeightedProgress({"a": 1, "b": 1}, self.reported.append)
+
+        progress.step("a")(0.8)
+        progress.step("a")(0.2)  # e.g. a retried ffmpeg pass starting over
+        progress.step("b")(-1)
+        progress.step("b")(5)
+
+        self.assertEqual(self.reported, [0.4, 0.9])
+
+    def test_rejects_invalid_weights(self):
+        for weights in [{}, {"a": 0}, {"a": 1, "b": -1}]:
+            with self.subTest(weights=weights), self.assertRaises(ValueError):
+                WeightedProgress(weights, self.reported.append)
+
+    def test_rejects_unknown_step(self):
+        progress = WeightedProgress({"a": 1}, self.reported.append)
+        with self.assertRaises(KeyError):
+            progress.step("b")
+
+    def test_concurrent_reports_stay_monotonic_and_sum_to_one(self):
+        weights = {step: step + 1 for step in range(8)}
+        progress = WeightedProgress(weights, self.reported.append)
+        start = threading.Barrier(len(weights))
+
+        def report_step(step):
+            callback = progress.step(step)
+            # Out-of-order updates within a step must not pull the total back either
+            early = [i / 200 for i in range(100)]
+            random.Random(step).shuffle(early)
+            fractions = early + [i / 200 for i in range(100, 201)]
+            start.wait()
+            for fraction in fractions:
+                callback(fraction)
+
+        threads = [threading.Thread(target=report_step, args=(step,)) for step in weights]
+        for thread in threads:
+            thread.start()
+        for thread in threads:
+            thread.join()
+
+        self.assertTrue(self.reported)
+        self.assertTrue(all(a < b for a, b in zip(self.reported, self.reported[1:])), "progress moved backwards")
+        self.assertAlmostEqual(self.reported[-1], 1.0)
+        self.assertAlmostEqual(sum(progress.shares.values()), 1.0)
+        self.assertAlmostEqual(progress.shares[7], 8 / 36)
+
+if __name__ == "__main__":
+    unittest.main()
@@ -0,0 +1,53 @@
+import unittest
+from unittest import mock
+from app.core import render_cache
+from app.core.render_cache import find_cached_render
+
+class FindCachedRenderTests(unittest.TestCase):
+    def setUp(self):
+        patcher = mock.patch.object(render_cache, "supabase")
+        self.supabase = patcher.start()
+        self.addCleanup(patcher.stop)
+        patcher = mock.patch.object(render_cache, "get_r2_client")
+        self.storage = patcher.start().return_value
+        self.addCleanup(patcher.stop)
+        self.stored = {"gif_project-1_job-1.gif"}
+        self.storage.file_exists.side_effect = lambda key: key in self.stored
+
+    def cache_entry(self, output_details: dict):
+        query = self.supabase.table.return_value.select.return_value.eq.return_value.gt.return_value
+        query.execute.return_value = mock.Mock(data=[{"output_details": output_details}])
+
+    def assertDropped(self):
+        self.supabase.table.return_value.delete.return_value.eq.assert_called_once_with("key", "cache-key")
+
+    def test_hit_checks_only_the_listed_files(self):
+        output_details = {
+            "gif": "gif_project-1_job-1.gif", "dither": "bayer", "output_size_bytes": 10,
+            "output_keys": ["gif_project-1_job-1.gif"]
+        }
+        self.cache_entry(output_details)
+
+        self.assertEqual(find_cached_render("cache-key"), output_details)
+        self.storage.file_exists.assert_called_once_with("gif_project-1_job-1.gif")
+
+    def test_missing_file_drops_the_entry(self):
+        self.cache_entry({"gif": "gif_project-1_job-0.gif", "output_keys": ["gif_project-1_job-0.gif"]})
+
+        with self.assertLogs("app.core.render_cache", "INFO"):
+            self.assertIsNone(find_cached_render("cache-key"))
+        self.assertDropped()
+
+    def test_entry_without_output_keys_is_dropped(self):
+        self.cache_entry({"gif": "gif_project-1_job-1.gif"})
+
+        with self.assertLogs("app.core.render_cache", "INFO"):
+            self.assertIsNone(find_cached_render("cache-key"))
+        self.assertDropped()
+
+    def test_no_key(self):
+        self.assertIsNone(find_cached_render(None))
+        self.supabase.table.assert_not_called()
+
+if __name__ == "__main__":
+    unittest.main()
@@ -0,0 +1,110 @@
+import re
+import json
+import asyncio
+import unittest
+from app.core.timeout import TimeoutMiddleware, REQUEST_TIMEOUT_ROUTES, DEFAULT_REQUEST_TIMEOUT
+
+def json_app(delay: float = 0, body: dict = None):
+    """An ASGI app answering 200 with body after sleeping for delay seconds."""
+    async def app(scope, receive, send):
+        await asyncio.sleep(delay)
+        content = json.dumps(body or {"ok": True}).encode()
+        await send({"type": "http.response.start", "status": 200, "headers": [(b"content-type", b"application/json")]})
+        await send({"type": "http.response.body", "body": content})
+    return app
+
+def streaming_app(chunks: int, interval: float):
+    """An ASGI app that starts its response at once and then keeps sending chunks."""
+    async def app(scope, receive, send):
+        await send({"type": "http.response.start", "status": 200, "headers": []})
+        for i in range(chunks):
+            await asyncio.sleep(interval)
+            await send({"type": "http.response.body", "body": f"{i}\n".encode(), "more_body": True})
+        await send({"type": "http.response.body", "body": b""})
+    return app
+
+def call(middleware, method: str = "GET", path: str = "/api/v1/projects") -> list:
+    sent = []
+
+    async def receive():
+        return {"type": "http.request", "body": b"", "more_body": False}
+
+    async def send(message):
+        sent.append(message)
+
+    asyncio.run(middleware({"type": "http", "method": method, "path": path}, receive, send))
+    return sent
+
+def response(sent: list) -> tuple:
+    body = b"".join(message.get("body", b"") for message in sent if message["type"] == "http.response.body")
+    return sent[0]["status"], body
+
+class TimeoutMiddlewareTests(unittest.TestCase):
+    def test_fast_request_passes_through(self):
+        status, body = response(call(TimeoutMiddleware(json_app(), default_timeout=1)))
+
+        self.assertEqual(status, 200)
+        self.assertEqual(json.loads(body), {"ok": True})
+
+    def test_slow_request_gets_504(self):
+        with self.assertLogs("app.core.timeout", "WARNING"):
+            sent = call(TimeoutMiddleware(json_app(delay=1), default_timeout=0.05))
+
+        status, body = response(sent)
+        self.assertEqual(status, 504)
+        self.assertEqual(json.loads(body), {"detail": "Request timed out after 0.05 seconds"})
+        self.assertIn((b"content-length", str(len(body)).encode()), sent[0]["headers"])
+
+    def test_route_timeout_overrides_the_default(self):
+        routes = [("POST", re.compile(r"^/api/v1/upload$"), 1)]
+        middleware = TimeoutMiddleware(json_app(delay=0.1), default_timeout=0.05, routes=routes)
+
+        self.assertEqual(response(call(middleware, "POST", "/api/v1/upload"))[0], 200)
+        with self.assertLogs("app.core.timeout", "WARNING"):
+            # The same path under another method keeps the default
+            self.assertEqual(response(call(middleware, "GET", "/api/v1/upload"))[0], 504)
+
+    def test_route_without_deadline_is_never_cut_off(self):
+        routes = [("GET", re.compile(r"^/api/v1/jobs/[^/]+/events$"), None)]
+        middleware = TimeoutMiddleware(streaming_app(chunks=5, interval=0.03), default_timeout=0.05, routes=routes)
+
+        status, body = response(call(middleware, "GET", "/api/v1/jobs/job-1/events"))
+
+        self.assertEqual(status, 200)
+        self.assertEqual(body, b"0\n1\n2\n3\n4\n")
+
+    def test_started_response_is_aborted_not_replaced(self):
+        middleware = TimeoutMiddleware(streaming_app(chunks=5, interval=0.03), default_timeout=0.05)
+
+        with self.assertLogs("app.core.timeout", "WARNING"), self.assertRaises(asyncio.TimeoutError):
+            call(middleware)
+
+    def test_non_http_scopes_are_untouched(self):
+        calls = []
+
+        async def app(scope, receive, send):
+            await asyncio.sleep(0.1)
+            calls.append(scope["type"])
+
+        asyncio.run(TimeoutMiddleware(app, default_timeout=0.01)({"type": "lifespan"}, None, None))
+        self.assertEqual(calls, ["lifespan"])
+
+class RequestTimeoutRoutesTests(unittest.TestCase):
+    def timeout_for(self, method: str, path: str):
+        return TimeoutMiddleware(json_app())._timeout_for(method, path)
+
+    def test_long_running_routes(self):
+        self.assertEqual(self.timeout_for("POST", "/api/v1/upload"), 3600)
+        self.assertEqual(self.timeout_for("GET", "/api/v1/projects/p1/scenes"), 900)
+        self.assertIsNone(self.timeout_for("GET", "/api/v1/jobs/job-1/events"))
+        self.assertEqual(self.timeout_for("GET", "/api/v1/projects/p1"), DEFAULT_REQUEST_TIMEOUT)
+
+    def test_every_route_has_a_valid_entry(self):
+        for method, pattern, timeout in REQUEST_TIMEOUT_ROUTES:
+            with self.subTest(pattern=pattern.pattern):
+                self.assertIn(method, ("GET", "POST", "PUT", "PATCH", "DELETE"))
+                self.assertTrue(pattern.pattern.startswith("^/api/v1/") and pattern.pattern.endswith("$"))
+                self.assertTrue(timeout is None or timeout > DEFAULT_REQUEST_TIMEOUT)
+
+if __name__ == "__main__":
+    unittest.main()
@@ -0,0 +1,124 @@
+import os
+import shutil
+import tempfile
+import subprocess
+import unittest
+from unittest import mock
+from app.services import ffmpeg_service
+from app.services.ffmpeg_service import (
+    parse_rotation, StreamInfo, get_video_info, rotate_video, transcode, TranscodeOptions, probe_metadata
+)
+
+def video_stream(width=1920, height=1080, codec_name="h264", **extra) -> dict:
+    return {"index": 0, "codec_type": "video", "codec_name": codec_name, "width": width, "height": height, **extra}
+
+def audio_stream(codec_name: str) -> dict:
+    return {"index": 1, "codec_type": "audio", "codec_name": codec_name}
+
+def display_matrix(rotation: float) -> dict:
+    return {"side_data_list": [{"side_data_type": "Display Matrix", "rotation": rotation}]}
+
+def probe(*streams, duration="10.0") -> dict:
+    return {"format": {"duration": duration, "format_name": "mov,mp4,m4a,3gp,3g2,mj2"}, "streams": list(streams)}
+
+class ParseRotationTests(unittest.TestCase):
+    def test_unrotated(self):
+        self.assertEqual(parse_rotation(video_stream()), 0)
+        self.assertEqual(parse_rotation(video_stream(side_data_list=[{"side_data_type": "CPB properties"}])), 0)
+
+    def test_legacy_rotate_tag(self):
+        for tag, expected in [("90", 90), ("180", 180), ("270", 270), ("-90", 270), ("360", 0), ("bogus", 0)]:
+            with self.subTest(tag=tag):
+                self.assertEqual(parse_rotation(video_stream(tags={"rotate": tag})), expected)
+
+    def test_display_matrix_is_counter_clockwise(self):
+        # A phone held upright records -90 in its display matrix, which players show turned 90° clockwise
+        for rotation, expected in [(-90, 90), (90, 270), (180, 180), (-180, 180), (-89.98, 90)]:
+            with self.subTest(rotation=rotation):
+                self.assertEqual(parse_rotation(video_stream(**display_matrix(rotation))), expected)
+
+    def test_rotate_tag_wins_over_display_matrix(self):
+        self.assertEqual(parse_rotation(video_stream(tags={"rotate": "180"}, **display_matrix(-90))), 180)
+
+class DisplayDimensionsTests(unittest.TestCase):
+    def test_quarter_turns_swap_dimensions(self):
+        for rotation, expected in [(0, (1920, 1080)), (90, (1080, 1920)), (180, (1920, 1080)), (270, (1080, 1920))]:
+            with self.subTest(rotation=rotation):
+                stream = StreamInfo.from_probe(video_stream(tags={"rotate": str(rotation)}))
+                self.assertEqual((stream.display_width, stream.display_height), expected)
+
+    def test_video_info_records_displayed_dimensions(self):
+        with mock.patch.object(ffmpeg_service, "probe_video", return_value=probe(video_stream(**display_matrix(-90)))):
+            info = get_video_info("portrait.mp4")
+
+        self.assertEqual((info["width"], info["height"]), (1080, 1920))
+
+class RotationCommandTests(unittest.TestCase):
+    def setUp(self):
+        for name, value in [("require_capabilities", None), ("validate_output", 1024), ("get_video_duration", 10.0)]:
+            patcher = mock.patch.object(ffmpeg_service, name, return_value=value)
+            patcher.start()
+            self.addCleanup(patcher.stop)
+        patcher = mock.patch.object(ffmpeg_service, "run_ffmpeg_with_progress")
+        self.run_ffmpeg = patcher.start()
+        self.addCleanup(patcher.stop)
+
+    def ffmpeg_args(self) -> list:
+        return self.run_ffmpeg.call_args.args[0]
+
+    def option(self, name: str) -> str:
+        args = self.ffmpeg_args()
+        return args[args.index(name) + 1]
+
+    def test_rotate_applies_transposes(self):
+        for degrees, video_filter in [(90, "transpose=clock"), (180, "transpose=clock,transpose=clock"), (270, "transpose=cclock")]:
+            with self.subTest(degrees=degrees):
+                rotate_video("in.mp4", "out.mp4", degrees)
+                self.assertEqual(self.option("-vf"), video_filter)
+                self.assertEqual(self.option("-metadata:s:v:0"), "rotate=0")
+
+    def test_rotate_rejects_other_angles(self):
+        for degrees in (0, 45, 360, -90):
+            with self.subTest(degrees=degrees), self.assertRaises(ValueError):
+                rotate_video("in.mp4", "out.mp4", degrees)
+        self.run_ffmpeg.assert_not_called()
+
+    def transcode_source(self, *streams: dict) -> bool:
+        with mock.patch.object(ffmpeg_service, "probe_video", return_value=probe(*streams)):
+            return transcode("in.mp4", "out.mp4", TranscodeOptions(height=1080))
+
+    def test_transcode_copies_an_unrotated_match(self):
+        self.assertTrue(self.transcode_source(video_stream(), audio_stream("aac")))
+        self.assertEqual((self.option("-c:v"), self.option("-c:a")), ("copy", "copy"))
+
+    def test_transcode_copy_encodes_audio_mp4_cannot_hold(self):
+        self.assertTrue(self.transcode_source(video_stream(), audio_stream("aac"), audio_stream("opus")))
+        self.assertEqual((self.option("-c:v"), self.option("-c:a"), self.option("-b:a")), ("copy", "aac", "128k"))
+
+    def test_transcode_reencodes_a_rotated_source(self):
+        self.assertFalse(self.transcode_source(video_stream(**display_matrix(-90))))
+        self.assertEqual(self.option("-c:v"), "libx264")
+        self.assertEqual(self.option("-metadata:s:v:0"), "rotate=0")
+
+@unittest.skipUnless(shutil.which("ffmpeg") and shutil.which("ffprobe"), "ffmpeg is not installed")
+class RotateVideoTests(unittest.TestCase):
+    def setUp(self):
+        self.temp_dir = tempfile.mkdtemp()
+        self.addCleanup(shutil.rmtree, self.temp_dir, ignore_errors=True)
+        self.source = os.path.join(self.temp_dir, "landscape.mp4")
+        subprocess.run([
+            'ffmpeg', '-f', 'lavfi', '-i', 'testsrc=size=320x240:duration=1:rate=10',
+            '-c:v', 'libx264', '-pix_fmt', 'yuv420p', '-y', self.source
+        ], capture_output=True, check=True)
+
+    def test_quarter_turn_swaps_dimensions(self):
+        output_path = os.path.join(self.temp_dir, "portrait.mp4")
+
+        rotate_video(self.source, output_path, 90)
+
+        video = probe_metadata(output_path).video
+        self.assertEqual((video.display_width, video.display_height), (240, 320))
+        self.assertEqual(video.rotation, 0)
+
+if __name__ == "__main__":
+    unittest.main()
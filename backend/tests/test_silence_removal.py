@@ -0,0 +1,42 @@
+import unittest
+from unittest import mock
+from app.services import ffmpeg_service
+from app.services.ffmpeg_service import remove_silence, SilenceRange, MAX_SILENCE_CUTS
+
+class RemoveSilenceCommandTests(unittest.TestCase):
+    def setUp(self):
+        for name, value in [("require_capabilities", None), ("validate_output", 1024), ("get_video_duration", 60.0)]:
+            patcher = mock.patch.object(ffmpeg_service, name, return_value=value)
+            patcher.start()
+            self.addCleanup(patcher.stop)
+        patcher = mock.patch.object(ffmpeg_service, "run_ffmpeg_with_progress")
+        self.run_ffmpeg = patcher.start()
+        self.addCleanup(patcher.stop)
+
+    def filter_graph(self, silences: list) -> str:
+        with mock.patch.object(ffmpeg_service, "detect_silence", return_value=silences):
+            remove_silence("in.mp4", "out.mp4")
+        args = self.run_ffmpeg.call_args.args[0]
+        return args[args.index('-filter_complex') + 1]
+
+    def test_selects_the_parts_around_silences(self):
+        graph = self.filter_graph([SilenceRange(start=0.0, end=2.0), SilenceRange(start=10.0, end=14.0)])
+
+        kept = "between(t,1.900,10.100)+between(t,13.900,60.000)"
+        self.assertEqual(graph, (
+            f"[0:v:0]select='{kept}',setpts=N/FRAME_RATE/TB[v];"
+            f"[0:a:0]aselect='{kept}',asetpts=N/SR/TB[a]"
+        ))
+        self.assertAlmostEqual(self.run_ffmpeg.call_args.args[1], 54.3)
+
+    def test_many_cuts_still_read_each_stream_once(self):
+        silences = [SilenceRange(start=i * 0.1 + 0.02, end=i * 0.1 + 0.08) for i in range(1, MAX_SILENCE_CUTS + 1)]
+        with mock.patch.object(ffmpeg_service, "SILENCE_PADDING", 0.0):
+            graph = self.filter_graph(silences)
+
+        self.assertEqual((graph.count("[0:v:0]"), graph.count("[0:a:0]")), (1, 1))
+        self.assertEqual(graph.count("between("), 2 * (MAX_SILENCE_CUTS + 1))
+        self.assertNotIn("trim", graph)
+
+if __name__ == "__main__":
+    unittest.main()
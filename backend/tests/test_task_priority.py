@@ -0,0 +1,34 @@
+import unittest
+from app.core.celery_app import celery_app, PRIORITY_HIGH, PRIORITY_NORMAL, PRIORITY_LOW
+from app.tasks import media
+from app.tasks.transcription import transcribe_video_task
+
+MEDIA_TASKS = [
+    media.generate_thumbnail_task, media.transcode_video_task, media.package_hls_task, media.overlay_watermark_task,
+    media.generate_gif_task, media.change_speed_task, media.normalize_loudness_task, media.rotate_video_task,
+    media.reframe_video_task, media.trim_silence_task,
+]
+
+class TaskPriorityTests(unittest.TestCase):
+    def test_transcription_outranks_derived_media(self):
+        # The Redis transport treats lower numbers as more urgent
+        self.assertEqual(transcribe_video_task.priority, PRIORITY_HIGH)
+        for task in MEDIA_TASKS:
+            with self.subTest(task=task.name):
+                self.assertEqual(task.priority, PRIORITY_LOW)
+                self.assertLess(transcribe_video_task.priority, task.priority)
+
+    def test_broker_orders_queues_by_priority(self):
+        options = celery_app.conf["broker_transport_options"]
+
+        self.assertEqual(options["queue_order_strategy"], "priority")
+        for priority in (PRIORITY_HIGH, PRIORITY_NORMAL, PRIORITY_LOW):
+            self.assertIn(priority, options["priority_steps"])
+        self.assertEqual(celery_app.conf["task_default_priority"], PRIORITY_NORMAL)
+
+    def test_workers_take_one_task_at_a_time(self):
+        # A worker holding prefetched low-priority tasks would run them before a newly queued transcription
+        self.assertEqual(celery_app.conf["worker_prefetch_multiplier"], 1)
+
+if __name__ == "__main__":
+    unittest.main()
@@ -0,0 +1,101 @@
+import os
+import dataclasses
+import time
+import shutil
+import tempfile
+import unittest
+from unittest import mock
+from app.core import temp_storage
+from app.core.temp_storage import sweep_orphaned_uploads, ensure_free_space, InsufficientStorageError
+
+HOUR = 3600
+
+class SweepOrphanedUploadsTests(unittest.TestCase):
+    def setUp(self):
+        self.base_dir = tempfile.mkdtemp()
+        self.addCleanup(shutil.rmtree, self.base_dir, ignore_errors=True)
+        self.now = time.time()
+
+    def write(self, relative_path: str, size: int, age_hours: float) -> str:
+        path = os.path.join(self.base_dir, relative_path)
+        os.makedirs(os.path.dirname(path), exist_ok=True)
+        with open(path, "wb") as f:
+            f.write(b"\0" * size)
+        self.age(path, age_hours)
+        return path
+
+    def age(self, path: str, age_hours: float):
+        modified = self.now - age_hours * HOUR
+        os.utime(path, (modified, modified))
+
+    def upload_dir(self, name: str, chunk_ages: list, size: int = 100) -> str:
+        for i, age_hours in enumerate(chunk_ages):
+            self.write(os.path.join(name, f"chunk_{i}"), size, age_hours)
+        path = os.path.join(self.base_dir, name)
+        self.age(path, max(chunk_ages))
+        return path
+
+    def test_removes_only_abandoned_uploads(self):
+        self.upload_dir("abandoned", [30, 26], size=1000)
+        self.upload_dir("fresh", [1, 0.5])
+        self.write("stale_direct_upload.mp4", 500, 48)
+        self.write("new_direct_upload.mp4", 500, 0)
+
+        removed, reclaimed = sweep_orphaned_uploads(self.base_dir, 24 * HOUR)
+
+        self.assertEqual((removed, reclaimed), (2, 2500))
+        self.assertEqual(sorted(os.listdir(self.base_dir)), ["fresh", "new_direct_upload.mp4"])
+
+    def test_resumed_upload_is_kept(self):
+        # Only the rewritten chunk is recent, but that makes the whole upload active
+        self.upload_dir("resumed", [40, 40, 40, 0.1])
+
+        self.assertEqual(sweep_orphaned_uploads(self.base_dir, 24 * HOUR), (0, 0))
+        self.assertTrue(os.path.isdir(os.path.join(self.base_dir, "resumed")))
+
+    def test_nested_directories_count_towards_age_and_size(self):
+        self.write(os.path.join("upload", "parts", "chunk_0"), 300, 30)
+        self.write(os.path.join("upload", "chunk_1"), 200, 30)
+        for path in (os.path.join(self.base_dir, "upload", "parts"), os.path.join(self.base_dir, "upload")):
+            self.age(path, 30)
+
+        self.assertEqual(sweep_orphaned_uploads(self.base_dir, 24 * HOUR), (1, 500))
+
+    def test_missing_base_dir(self):
+        self.assertEqual(sweep_orphaned_uploads(os.path.join(self.base_dir, "missing"), 24 * HOUR), (0, 0))
+
+    def test_removal_failure_is_skipped(self):
+        self.upload_dir("locked", [30])
+        self.upload_dir("abandoned", [30])
+        real_rmtree = shutil.rmtree
+
+        def rmtree(path, *args, **kwargs):
+            if path.endswith("locked"):
+                raise PermissionError("Operation not permitted")
+            return real_rmtree(path, *args, **kwargs)
+
+        with mock.patch.object(temp_storage.shutil, "rmtree", rmtree), self.assertLogs("app.core.temp_storage", "WARNING"):
+            removed, _ = sweep_orphaned_uploads(self.base_dir, 24 * HOUR)
+
+        self.assertEqual(removed, 1)
+        self.assertEqual(os.listdir(self.base_dir), ["locked"])
+
+class EnsureFreeSpaceTests(unittest.TestCase):
+    def setUp(self):
+        patcher = mock.patch.object(temp_storage.shutil, "disk_usage", return_value=mock.Mock(free=1000))
+        patcher.start()
+        self.addCleanup(patcher.stop)
+        settings = dataclasses.replace(temp_storage.temp_storage_settings, min_free_bytes=100)
+        patcher = mock.patch.object(temp_storage, "temp_storage_settings", settings)
+        patcher.start()
+        self.addCleanup(patcher.stop)
+
+    def test_allows_writes_that_leave_the_minimum_free(self):
+        ensure_free_space("/tmp", 600, reserved_bytes=300)
+
+    def test_counts_space_reserved_by_other_uploads(self):
+        with self.assertRaises(InsufficientStorageError):
+            ensure_free_space("/tmp", 600, reserved_bytes=301)
+
+if __name__ == "__main__":
+    unittest.main()
@@ -0,0 +1,96 @@
+import os
+import tempfile
+import unittest
+from unittest import mock
+from fastapi import HTTPException
+from app.api import endpoints
+from app.api.endpoints import (
+    validate_upload_format, detect_video_container, video_content_type, load_allowed_video_extensions, VIDEO_MIME_TYPES
+)
+
+MP4_HEADER = b'\x00\x00\x00\x20ftypisom'
+WEBM_HEADER = b'\x1a\x45\xdf\xa3\x9f\x42\x86\x81\x01\x42\xf7\x81'
+AVI_HEADER = b'RIFF\x00\x00\x00\x00AVI '
+
+class ValidateUploadFormatTests(unittest.TestCase):
+    def assertStatus(self, status_code, file_name, claimed_type):
+        with self.assertRaises(HTTPException) as raised:
+            validate_upload_format(file_name, claimed_type)
+        self.assertEqual(raised.exception.status_code, status_code)
+
+    def test_accepts_matching_types(self):
+        for extension, mime_type in VIDEO_MIME_TYPES.items():
+            with self.subTest(extension=extension):
+                self.assertEqual(validate_upload_format(f"clip{extension.upper()}", mime_type), extension)
+
+    def test_accepts_aliases_and_generic_types(self):
+        for file_name, claimed_type in [
+            ("clip.avi", "video/avi"),
+            ("clip.mkv", "video/mkv"),
+            ("clip.mp4", "application/octet-stream"),
+            ("clip.mp4", "video/mp4; codecs=avc1"),
+            ("clip.mov", None),
+        ]:
+            with self.subTest(file_name=file_name, claimed_type=claimed_type):
+                validate_upload_format(file_name, claimed_type)
+
+    def test_unsupported_extension_is_415(self):
+        for file_name in ["notes.txt", "clip.flv", "clip", None]:
+            with self.subTest(file_name=file_name):
+                self.assertStatus(415, file_name, "video/mp4")
+
+    def test_mismatched_type_is_400(self):
+        self.assertStatus(400, "clip.mp4", "video/webm")
+        self.assertStatus(400, "clip.webm", "image/png")
+
+    def test_allowlist_restricts_formats(self):
+        with mock.patch.object(endpoints, "ALLOWED_VIDEO_EXTENSIONS", {".mp4"}):
+            validate_upload_format("clip.mp4", "video/mp4")
+            self.assertStatus(415, "clip.webm", "video/webm")
+
+class AllowedFormatsTests(unittest.TestCase):
+    def test_defaults_to_every_known_format(self):
+        with mock.patch.dict(os.environ, {"ALLOWED_VIDEO_FORMATS": ""}):
+            self.assertEqual(load_allowed_video_extensions(), set(VIDEO_MIME_TYPES))
+
+    def test_reads_configured_formats_and_drops_unknown_ones(self):
+        with mock.patch.dict(os.environ, {"ALLOWED_VIDEO_FORMATS": " MP4, .webm ,flv,"}):
+            self.assertEqual(load_allowed_video_extensions(), {".mp4", ".webm"})
+
+class DetectVideoContainerTests(unittest.TestCase):
+    def upload(self, header: bytes) -> str:
+        with tempfile.NamedTemporaryFile(delete=False) as f:
+            f.write(header + b'\x00' * 64)
+        self.addCleanup(os.unlink, f.name)
+        return f.name
+
+    def test_recognizes_containers_by_their_bytes(self):
+        self.assertEqual(detect_video_container(self.upload(MP4_HEADER), ".mp4"), 'mov,mp4,m4a,3gp,3g2,mj2')
+        self.assertEqual(detect_video_container(self.upload(WEBM_HEADER), ".mkv"), 'matroska,webm')
+        # A misnamed file is still accepted as what it really is
+        self.assertEqual(detect_video_container(self.upload(AVI_HEADER), ".mp4"), 'avi')
+
+    def test_non_video_is_415(self):
+        for header in [b'%PDF-1.7\n%\xe2\xe3', b'\x89PNG\r\n\x1a\n\x00\x00\x00\x0d']:
+            with self.subTest(header=header), self.assertRaises(HTTPException) as raised:
+                detect_video_container(self.upload(header), ".mp4")
+            self.assertEqual(raised.exception.status_code, 415)
+
+    def test_container_outside_allowlist_is_415(self):
+        with mock.patch.object(endpoints, "ALLOWED_VIDEO_EXTENSIONS", {".mp4", ".mov"}):
+            with self.assertRaises(HTTPException) as raised:
+                detect_video_container(self.upload(WEBM_HEADER), ".webm")
+        self.assertEqual(raised.exception.status_code, 415)
+
+class VideoContentTypeTests(unittest.TestCase):
+    def test_probed_format_wins_over_extension(self):
+        self.assertEqual(video_content_type("clip.mov", 'mov,mp4,m4a,3gp,3g2,mj2'), 'video/quicktime')
+        self.assertEqual(video_content_type("clip.avi", 'mov,mp4,m4a,3gp,3g2,mj2'), 'video/mp4')
+        self.assertEqual(video_content_type("clip.mp4", 'matroska,webm'), 'video/webm')
+
+    def test_falls_back_to_extension(self):
+        self.assertEqual(video_content_type("clip.MKV"), 'video/x-matroska')
+        self.assertEqual(video_content_type("clip.bin", "unknown"), 'application/octet-stream')
+
+if __name__ == "__main__":
+    unittest.main()
@@ -0,0 +1,123 @@
+import os
+import json
+import socket
+import unittest
+from unittest import mock
+import httpx
+from celery.exceptions import Retry
+from app.services import webhook_service
+from app.services.webhook_service import deliver_webhook, check_callback_url, sign_payload, UnsafeCallbackURL, SIGNATURE_HEADER
+from app.tasks import notifications
+from app.tasks.notifications import send_job_webhook_task
+
+CALLBACK_URL = "https://hooks.example.com/yovideo"
+
+def resolves_to(*addresses):
+    """Patch DNS so every host resolves to the given addresses."""
+    infos = [(socket.AF_INET6 if ":" in a else socket.AF_INET, socket.SOCK_STREAM, 6, "", (a, 443)) for a in addresses]
+    return mock.patch.object(webhook_service.socket, "getaddrinfo", return_value=infos)
+
+def http_response(status_code: int) -> httpx.Response:
+    return httpx.Response(status_code, request=httpx.Request("POST", CALLBACK_URL))
+
+class DeliverWebhookTests(unittest.TestCase):
+    def test_signs_body_with_webhook_secret(self):
+        payload = {"job_id": "job-1", "status": "completed"}
+        
+        with resolves_to("93.184.216.34"), \
+                mock.patch.dict(os.environ, {"WEBHOOK_SECRET": "s3cret"}), \
+                mock.patch.object(webhook_service.httpx, "post", return_value=http_response(200)) as post:
+            self.assertEqual(deliver_webhook(CALLBACK_URL, payload), 200)
+        
+        body = post.call_args.kwargs["content"]
+        self.assertEqual(json.loads(body), payload)
+        self.assertEqual(post.call_args.kwargs["headers"][SIGNATURE_HEADER], sign_payload(body, "s3cret"))
+    
+    def test_sends_unsigned_without_secret(self):
+        with resolves_to("93.184.216.34"), \
+                mock.patch.dict(os.environ, {}, clear=True), \
+                mock.patch.object(webhook_service.httpx, "post", return_value=http_response(204)) as post:
+            deliver_webhook(CALLBACK_URL, {"job_id": "job-1"})
+        
+        self.assertNotIn(SIGNATURE_HEADER, post.call_args.kwargs["headers"])
+    
+    def test_raises_on_server_error(self):
+        with resolves_to("93.184.216.34"), \
+                mock.patch.object(webhook_service.httpx, "post", return_value=http_response(500)):
+            with self.assertRaises(httpx.HTTPStatusError):
+                deliver_webhook(CALLBACK_URL, {"job_id": "job-1"})
+
+class CheckCallbackURLTests(unittest.TestCase):
+    def test_accepts_public_address(self):
+        with resolves_to("93.184.216.34", "2606:2800:220:1:248:1893:25c8:1946"):
+            check_callback_url(CALLBACK_URL)
+    
+    def test_rejects_internal_addresses(self):
+        for address in ["169.254.169.254", "127.0.0.1", "10.0.0.5", "192.168.1.20", "172.16.0.1", "0.0.0.0", "::1", "fe80::1", "fd00::1"]:
+            with self.subTest(address=address), resolves_to(address):
+                with self.assertRaises(UnsafeCallbackURL):
+                    check_callback_url("http://internal.example.com/hook")
+    
+    def test_rejects_host_with_any_private_address(self):
+        with resolves_to("93.184.216.34", "10.0.0.5"):
+            with self.assertRaises(UnsafeCallbackURL):
+                check_callback_url(CALLBACK_URL)
+    
+    def test_rejects_non_http_schemes(self):
+        for url in ["ftp://example.com/hook", "file:///etc/passwd", "example.com/hook"]:
+            with self.subTest(url=url), self.assertRaises(UnsafeCallbackURL):
+                check_callback_url(url)
+    
+    def test_rejects_unresolvable_host(self):
+        with mock.patch.object(webhook_service.socket, "getaddrinfo", side_effect=socket.gaierror("no such host")):
+            with self.assertRaises(UnsafeCallbackURL):
+                check_callback_url(CALLBACK_URL)
+
+class SendJobWebhookTaskTests(unittest.TestCase):
+    job = {
+        "id": "job-1",
+        "project_id": "project-1",
+        "job_type": "gif",
+        "status": "completed",
+        "error_message": None,
+        "callback_url": CALLBACK_URL,
+        "output_details": {"path": "gifs/project-1.gif"},
+    }
+    
+    def setUp(self):
+        supabase = mock.MagicMock()
+        supabase.table.return_value.select.return_value.eq.return_value.execute.return_value.data = [self.job]
+        patcher = mock.patch.object(notifications, "supabase", supabase)
+        patcher.start()
+        self.addCleanup(patcher.stop)
+    
+    def test_payload_includes_output_details(self):
+        with mock.patch.object(notifications, "deliver_webhook") as deliver:
+            send_job_webhook_task.run("job-1")
+        
+        url, payload = deliver.call_args.args
+        self.assertEqual(url, CALLBACK_URL)
+        self.assertEqual(payload["output_details"], {"path": "gifs/project-1.gif"})
+        self.assertEqual(payload["status"], "completed")
+    
+    def test_retries_when_receiver_returns_500(self):
+        with resolves_to("93.184.216.34"), \
+                mock.patch.object(webhook_service.httpx, "post", return_value=http_response(500)), \
+                mock.patch.object(send_job_webhook_task, "retry", side_effect=Retry()) as retry:
+            with self.assertRaises(Retry):
+                send_job_webhook_task.run("job-1")
+        
+        self.assertIsInstance(retry.call_args.kwargs["exc"], httpx.HTTPStatusError)
+        self.assertEqual(retry.call_args.kwargs["countdown"], 5)
+    
+    def test_does_not_retry_internal_callback(self):
+        with resolves_to("169.254.169.254"), \
+                mock.patch.object(webhook_service.httpx, "post") as post, \
+                mock.patch.object(send_job_webhook_task, "retry") as retry:
+            send_job_webhook_task.run("job-1")
+        
+        post.assert_not_called()
+        retry.assert_not_called()
+
+if __name__ == "__main__":
+    unittest.main()
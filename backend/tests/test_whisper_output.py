@@ -0,0 +1,46 @@
+import io
+import os
+import json
+import shutil
+import tempfile
+import unittest
+from unittest import mock
+from app.tasks import transcription
+from app.tasks.transcription import run_whisper_subprocess
+
+class FakeWhisper:
+    """Stands in for the whisper CLI, writing its JSON where --output_dir points."""
+
+    def __init__(self, cmd, **kwargs):
+        output_dir = cmd[cmd.index('--output_dir') + 1]
+        video_name = os.path.splitext(os.path.basename(cmd[1]))[0]
+        with open(os.path.join(output_dir, f"{video_name}.json"), "w") as f:
+            json.dump({"text": f"heard in {output_dir}", "segments": []}, f)
+        self.stdout = io.StringIO("[00:00.000 --> 00:01.000]  Hello\n")
+        self.stderr = io.StringIO("")
+        self.returncode = 0
+
+    def wait(self):
+        return self.returncode
+
+class RunWhisperSubprocessTests(unittest.TestCase):
+    def output_dir(self):
+        path = tempfile.mkdtemp(prefix="whisper_test_")
+        self.addCleanup(shutil.rmtree, path, ignore_errors=True)
+        return path
+
+    def test_reads_the_result_from_its_own_output_dir(self):
+        first, second = self.output_dir(), self.output_dir()
+        segments = []
+
+        with mock.patch.object(transcription.subprocess, "Popen", FakeWhisper), self.assertLogs("app.tasks.transcription", "INFO"):
+            first_result = run_whisper_subprocess("/jobs/a/audio.mp3", first, on_segment=segments.append)
+            second_result = run_whisper_subprocess("/jobs/b/audio.mp3", second)
+
+        # Same file name from two jobs, yet each reads back its own transcript
+        self.assertEqual(first_result["text"], f"heard in {first}")
+        self.assertEqual(second_result["text"], f"heard in {second}")
+        self.assertEqual(segments, [{"start": 0.0, "end": 1.0, "text": "Hello"}])
+
+if __name__ == "__main__":
+    unittest.main()
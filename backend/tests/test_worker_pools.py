@@ -0,0 +1,61 @@
+import unittest
+from unittest import mock
+from pydantic import ValidationError
+from app.core import queue_stats
+from app.core.queue_stats import resize_worker_pools, INSPECT_TIMEOUT
+from app.api.endpoints import WorkerPoolRequest
+
+def worker_stats(**concurrency_by_worker) -> dict:
+    return {f"celery@{name}": {"pool": {"max-concurrency": concurrency}} for name, concurrency in concurrency_by_worker.items()}
+
+class ResizeWorkerPoolsTests(unittest.TestCase):
+    def setUp(self):
+        patcher = mock.patch.object(queue_stats, "celery_app")
+        self.control = patcher.start().control
+        self.addCleanup(patcher.stop)
+
+    def answer(self, stats):
+        self.control.inspect.return_value.stats.return_value = stats
+
+    def test_grows_and_shrinks_each_worker_to_the_target(self):
+        self.answer(worker_stats(small=2, large=8, exact=4))
+
+        with self.assertLogs("app.core.queue_stats", "INFO"):
+            changes = resize_worker_pools(4)
+
+        self.control.inspect.assert_called_once_with(timeout=INSPECT_TIMEOUT, destination=None)
+        self.control.pool_grow.assert_called_once_with(2, destination=["celery@small"])
+        self.control.pool_shrink.assert_called_once_with(4, destination=["celery@large"])
+        self.assertEqual(changes, [
+            {"name": "celery@exact", "from": 4, "to": 4},
+            {"name": "celery@large", "from": 8, "to": 4},
+            {"name": "celery@small", "from": 2, "to": 4},
+        ])
+
+    def test_only_the_named_worker_is_asked(self):
+        self.answer(worker_stats(small=2))
+
+        with self.assertLogs("app.core.queue_stats", "INFO"):
+            changes = resize_worker_pools(3, worker="celery@small")
+
+        self.control.inspect.assert_called_once_with(timeout=INSPECT_TIMEOUT, destination=["celery@small"])
+        self.control.pool_grow.assert_called_once_with(1, destination=["celery@small"])
+        self.assertEqual(changes, [{"name": "celery@small", "from": 2, "to": 3}])
+
+    def test_no_workers_answering(self):
+        self.answer(None)
+
+        self.assertEqual(resize_worker_pools(4), [])
+        self.control.pool_grow.assert_not_called()
+        self.control.pool_shrink.assert_not_called()
+
+class WorkerPoolRequestTests(unittest.TestCase):
+    def test_concurrency_is_bounded(self):
+        WorkerPoolRequest(concurrency=1)
+        WorkerPoolRequest(concurrency=64, worker="celery@host")
+        for concurrency in (0, 65):
+            with self.subTest(concurrency=concurrency), self.assertRaises(ValidationError):
+                WorkerPoolRequest(concurrency=concurrency)
+
+if __name__ == "__main__":
+    unittest.main()
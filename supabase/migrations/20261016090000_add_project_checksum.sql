@@ -0,0 +1,7 @@
+-- Add checksum column to projects table
+-- Stores the digest of the assembled upload once it has been verified
+
+ALTER TABLE projects ADD COLUMN checksum TEXT;
+
+-- Add comment to document the column
+COMMENT ON COLUMN projects.checksum IS 'Hex digest of the uploaded video file, verified on chunked upload completion';
@@ -0,0 +1,7 @@
+-- Add thumbnail_path column to projects table
+-- This will store the path to the generated poster frame
+
+ALTER TABLE projects ADD COLUMN thumbnail_path TEXT;
+
+-- Add comment to document the column
+COMMENT ON COLUMN projects.thumbnail_path IS 'Path to the JPEG poster frame generated from the project video';
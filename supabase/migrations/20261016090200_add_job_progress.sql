@@ -0,0 +1,7 @@
+-- Add progress column to processing_jobs table
+-- Updated from ffmpeg's -progress output while a job runs
+
+ALTER TABLE processing_jobs ADD COLUMN progress REAL NOT NULL DEFAULT 0;
+
+-- Add comment to document the column
+COMMENT ON COLUMN processing_jobs.progress IS 'Fraction of the job completed, between 0 and 1';
@@ -0,0 +1,13 @@
+-- Add video metadata columns to projects table
+-- Populated by probing the uploaded file before temporary files are removed
+
+ALTER TABLE projects ADD COLUMN width INTEGER;
+ALTER TABLE projects ADD COLUMN height INTEGER;
+ALTER TABLE projects ADD COLUMN duration INTEGER;
+ALTER TABLE projects ADD COLUMN format TEXT;
+
+-- Add comments to document the columns
+COMMENT ON COLUMN projects.width IS 'Width in pixels of the first video stream';
+COMMENT ON COLUMN projects.height IS 'Height in pixels of the first video stream';
+COMMENT ON COLUMN projects.duration IS 'Container duration rounded to whole seconds';
+COMMENT ON COLUMN projects.format IS 'Container format name reported by ffprobe';
@@ -0,0 +1,7 @@
+-- Add download_urls column to projects table
+-- Caches signed download URLs per variant ("original", "processed") with their expiry
+
+ALTER TABLE projects ADD COLUMN download_urls JSONB;
+
+-- Add comment to document the column
+COMMENT ON COLUMN projects.download_urls IS 'Cached signed URLs keyed by variant: {url, path, expires_at}';
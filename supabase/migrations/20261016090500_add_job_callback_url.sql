@@ -0,0 +1,7 @@
+-- Add callback_url column to processing_jobs table
+-- A webhook is POSTed here when the job completes or fails
+
+ALTER TABLE processing_jobs ADD COLUMN callback_url TEXT;
+
+-- Add comment to document the column
+COMMENT ON COLUMN processing_jobs.callback_url IS 'Webhook URL notified with the job status once the job finishes';
@@ -0,0 +1,7 @@
+-- Add error_message column to projects table
+-- Holds a user-facing explanation when processing fails
+
+ALTER TABLE projects ADD COLUMN error_message TEXT;
+
+-- Add comment to document the column
+COMMENT ON COLUMN projects.error_message IS 'User-facing reason the last processing run failed, cleared on success';
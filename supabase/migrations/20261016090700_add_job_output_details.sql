@@ -0,0 +1,7 @@
+-- Add output_details column to processing_jobs table
+-- Records what a job produced, e.g. transcoded variants by resolution
+
+ALTER TABLE processing_jobs ADD COLUMN output_details JSONB;
+
+-- Add comment to document the column
+COMMENT ON COLUMN processing_jobs.output_details IS 'Job outputs, e.g. {"720p": "transcode_<project_id>_720p.mp4"} for transcode jobs';
@@ -0,0 +1,7 @@
+-- Add hls_playlist_path column to projects table
+-- Points at the HLS playlist produced for streaming playback
+
+ALTER TABLE projects ADD COLUMN hls_playlist_path TEXT;
+
+-- Add comment to document the column
+COMMENT ON COLUMN projects.hls_playlist_path IS 'R2 object key of the HLS playlist; segments live alongside it under hls/<project_id>/';
@@ -0,0 +1,7 @@
+-- Add language column to projects table
+-- Records the language a project's video was transcribed in
+
+ALTER TABLE projects ADD COLUMN language TEXT;
+
+-- Add comment to document the column
+COMMENT ON COLUMN projects.language IS 'ISO 639-1 code of the transcription language: the requested hint, or the language whisper detected';
@@ -0,0 +1,7 @@
+-- Add heartbeat_at column to processing_jobs table
+-- Workers refresh it while a job runs; a stale heartbeat lets another worker reclaim the job
+
+ALTER TABLE processing_jobs ADD COLUMN heartbeat_at TIMESTAMPTZ;
+
+-- Add comment to document the column
+COMMENT ON COLUMN processing_jobs.heartbeat_at IS 'Last time the worker running this job reported it was alive';
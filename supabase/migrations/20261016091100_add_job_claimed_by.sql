@@ -0,0 +1,7 @@
+-- Add claimed_by column to processing_jobs table
+-- Records which worker process claimed a job, so only one runs it at a time
+
+ALTER TABLE processing_jobs ADD COLUMN claimed_by TEXT;
+
+-- Add comment to document the column
+COMMENT ON COLUMN processing_jobs.claimed_by IS 'Worker (hostname:pid) that claimed the job; set by the same conditional update that moves it to processing';
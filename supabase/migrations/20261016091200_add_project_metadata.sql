@@ -0,0 +1,7 @@
+-- Add metadata column to projects table
+-- Caches the probed summary of the project's video (codecs, dimensions, audio tracks, bitrate)
+
+ALTER TABLE projects ADD COLUMN metadata JSONB;
+
+-- Add comment to document the column
+COMMENT ON COLUMN projects.metadata IS 'Summary of the uploaded video from ffprobe, filled the first time it is requested';
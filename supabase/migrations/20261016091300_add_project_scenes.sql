@@ -0,0 +1,7 @@
+-- Add scenes column to projects table
+-- Caches detected scene cuts so suggesting clip boundaries doesn't decode the video again
+
+ALTER TABLE projects ADD COLUMN scenes JSONB;
+
+-- Add comment to document the column
+COMMENT ON COLUMN projects.scenes IS 'Scene cut timestamps in seconds, keyed by the detection threshold they were found with';
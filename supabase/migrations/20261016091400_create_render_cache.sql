@@ -0,0 +1,27 @@
+-- Create render_cache table
+-- Maps a hash of a render's source video and parameters to the job output that already holds it,
+-- so an identical render request reuses the stored file instead of running ffmpeg again
+
+CREATE TABLE render_cache (
+    key TEXT PRIMARY KEY,
+    project_id uuid REFERENCES projects(id) ON DELETE CASCADE NOT NULL,
+    job_type TEXT NOT NULL,
+    output_details JSONB NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    expires_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX render_cache_expires_at_idx ON render_cache (expires_at);
+
+ALTER TABLE render_cache ENABLE ROW LEVEL SECURITY;
+
+-- Only the backend reads and writes the cache
+CREATE POLICY "Allow backend service to manage the render cache"
+ON render_cache FOR ALL
+TO anon
+USING (true);
+
+-- Add comments to document the table
+COMMENT ON TABLE render_cache IS 'Rendered outputs reusable by jobs with the same source video and parameters';
+COMMENT ON COLUMN render_cache.key IS 'SHA-256 of the source video path and checksum, job type and render parameters';
+COMMENT ON COLUMN render_cache.expires_at IS 'After this the entry is ignored and removed; the output itself stays with its job';
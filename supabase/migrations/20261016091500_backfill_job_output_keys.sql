@@ -0,0 +1,30 @@
+-- Backfill output_keys in processing_jobs and render_cache output_details
+-- Storage files a job wrote are now listed explicitly, so other string fields in
+-- output_details are never mistaken for them; earlier rows get the list from the
+-- fields that held storage paths: "video", "gif", "watermark_image" and transcode
+-- variants such as "720p"
+
+UPDATE processing_jobs
+SET output_details = output_details || jsonb_build_object(
+    'output_keys',
+    COALESCE((
+        SELECT jsonb_agg(value)
+        FROM jsonb_each_text(output_details)
+        WHERE key IN ('video', 'gif', 'watermark_image') OR key ~ '^[0-9]+p$'
+    ), '[]'::jsonb)
+)
+WHERE output_details IS NOT NULL AND NOT output_details ? 'output_keys';
+
+UPDATE render_cache
+SET output_details = output_details || jsonb_build_object(
+    'output_keys',
+    COALESCE((
+        SELECT jsonb_agg(value)
+        FROM jsonb_each_text(output_details)
+        WHERE key IN ('video', 'gif') OR key ~ '^[0-9]+p$'
+    ), '[]'::jsonb)
+)
+WHERE NOT output_details ? 'output_keys';
+
+-- Update comment to document the column
+COMMENT ON COLUMN processing_jobs.output_details IS 'Job outputs, e.g. {"720p": "transcode_<project_id>_720p.mp4"} for transcode jobs; output_keys lists every storage file the job owns';